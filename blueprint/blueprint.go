@@ -0,0 +1,189 @@
+package blueprint
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/contracts/freezer"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// A Plutus contract blueprint, as described by CIP-57, and produced by `aiken build` as plutus.json
+type Blueprint struct {
+	Preamble    Preamble           `json:"preamble"`
+	Validators  []*Validator       `json:"validators"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+}
+
+type Preamble struct {
+	Title         string `json:"title"`
+	Description   string `json:"description,omitempty"`
+	Version       string `json:"version"`
+	PlutusVersion string `json:"plutusVersion,omitempty"`
+	License       string `json:"license,omitempty"`
+}
+
+type Validator struct {
+	Title        string     `json:"title"`
+	Description  string     `json:"description,omitempty"`
+	Datum        *Argument  `json:"datum,omitempty"`
+	Redeemer     *Argument  `json:"redeemer,omitempty"`
+	Parameters   []Argument `json:"parameters,omitempty"`
+	CompiledCode string     `json:"compiledCode"`
+	Hash         string     `json:"hash"`
+
+	blueprint *Blueprint
+}
+
+// A datum, redeemer or parameter of a validator
+type Argument struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+// The title of the freezer validator, in contracts/freezer/plutus.json
+const FreezerValidator = "freezer.stake"
+
+// Scripts are hashed with a tag for their language in front of them
+var languageTags = map[string]byte{
+	"v1": 0x01,
+	"v2": 0x02,
+	"v3": 0x03,
+}
+
+// The hash of a script, which is also its credential, from its language tag and compiled code
+func scriptHash(tag byte, code []byte) []byte {
+	b2, err := blake2b.New(224/8, nil)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create hash: %v", err))
+	}
+	b2.Write([]byte{tag})
+	b2.Write(code)
+	return b2.Sum(nil)
+}
+
+// Parse a blueprint, checking that each validator's compiled code matches its hash
+func Parse(bytes []byte) (*Blueprint, error) {
+	var blueprint Blueprint
+	if err := json.Unmarshal(bytes, &blueprint); err != nil {
+		return nil, fmt.Errorf("invalid blueprint: %w", err)
+	}
+	version := blueprint.Preamble.PlutusVersion
+	if version == "" {
+		version = "v2"
+	}
+	tag, ok := languageTags[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported plutus version %v", blueprint.Preamble.PlutusVersion)
+	}
+	for _, validator := range blueprint.Validators {
+		validator.blueprint = &blueprint
+		code, err := validator.Code()
+		if err != nil {
+			return nil, err
+		}
+		if hash := hex.EncodeToString(scriptHash(tag, code)); hash != validator.Hash {
+			return nil, fmt.Errorf("%v hashes to %v, but the blueprint says %v", validator.Title, hash, validator.Hash)
+		}
+	}
+	return &blueprint, nil
+}
+
+// Load a blueprint from a file, such as contracts/freezer/plutus.json
+func Load(path string) (*Blueprint, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blueprint: %w", err)
+	}
+	return Parse(bytes)
+}
+
+// The blueprint of the freezer contract, as built into this module
+func Freezer() (*Validator, error) {
+	blueprint, err := Parse(freezer.Blueprint)
+	if err != nil {
+		return nil, err
+	}
+	return blueprint.Validator(FreezerValidator)
+}
+
+func (b *Blueprint) Validator(title string) (*Validator, error) {
+	for _, validator := range b.Validators {
+		if validator.Title == title {
+			return validator, nil
+		}
+	}
+	return nil, fmt.Errorf("blueprint %v has no validator %v", b.Preamble.Title, title)
+}
+
+// Follow a reference to one of the blueprint's definitions, such as "#/definitions/freezer~1StakeDatum"
+func (b *Blueprint) Resolve(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/definitions/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported reference %v", ref)
+	}
+	// References are JSON pointers, which escape "/" and "~"
+	name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+	schema, ok := b.Definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("no definition for %v", ref)
+	}
+	return schema, nil
+}
+
+// The compiled code of the validator, as used to build a transaction
+func (v *Validator) Code() ([]byte, error) {
+	code, err := hex.DecodeString(v.CompiledCode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compiled code for %v: %w", v.Title, err)
+	}
+	return code, nil
+}
+
+// The script credential of the validator; its hash was checked against the compiled code when the blueprint was parsed
+func (v *Validator) Credential() (types.Credential, error) {
+	hash, err := hex.DecodeString(v.Hash)
+	if err != nil {
+		return types.Credential{}, fmt.Errorf("invalid hash for %v: %w", v.Title, err)
+	}
+	return types.Credential{Kind: types.ScriptCredential, Hash: hash}, nil
+}
+
+// The address of the validator on the network, without a staking credential
+func (v *Validator) Address(network types.Network) (string, error) {
+	credential, err := v.Credential()
+	if err != nil {
+		return "", err
+	}
+	return types.EnterpriseAddress(network, credential)
+}
+
+// Check that a CBOR encoded datum matches the validator's datum schema
+func (v *Validator) ValidateDatum(datum []byte) error {
+	if v.Datum == nil {
+		return fmt.Errorf("%v doesn't take a datum", v.Title)
+	}
+	var data any
+	if err := cbor.Unmarshal(datum, &data); err != nil {
+		return fmt.Errorf("invalid datum: %w", err)
+	}
+	if err := v.blueprint.validate(&v.Datum.Schema, data, v.Datum.Title); err != nil {
+		return fmt.Errorf("invalid datum for %v: %w", v.Title, err)
+	}
+	return nil
+}
+
+// Check that a stake datum, as it would be encoded on-chain, matches the validator's datum schema
+func (v *Validator) ValidateStakeDatum(datum types.StakeDatum) error {
+	encoded, err := cbor.Marshal(&datum)
+	if err != nil {
+		return fmt.Errorf("failed to encode datum: %w", err)
+	}
+	return v.ValidateDatum(encoded)
+}
@@ -0,0 +1,83 @@
+package blueprint
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/contracts/freezer"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_Freezer(t *testing.T) {
+	validator, err := Freezer()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "73275b9e267fd927bfc14cf653d904d1538ad8869260ab638bf73f5c", validator.Hash)
+	code, err := validator.Code()
+	assert.Nil(t, err)
+	assert.EqualValues(t, validator.Hash, hex.EncodeToString(scriptHash(languageTags["v2"], code)))
+
+	credential, err := validator.Credential()
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.ScriptCredential, credential.Kind)
+	assert.EqualValues(t, validator.Hash, hex.EncodeToString(credential.Hash))
+	for _, network := range []types.Network{types.Mainnet, types.Testnet} {
+		address, err := validator.Address(network)
+		assert.Nil(t, err)
+		parsed, err := types.ParseAddress(address)
+		assert.Nil(t, err)
+		assert.EqualValues(t, types.Address{Network: network, Payment: credential}, parsed)
+	}
+
+	// Loading the file gives the same blueprint
+	loaded, err := Load("../contracts/freezer/plutus.json")
+	assert.Nil(t, err)
+	fromFile, err := loaded.Validator(FreezerValidator)
+	assert.Nil(t, err)
+	assert.EqualValues(t, validator.CompiledCode, fromFile.CompiledCode)
+	assert.EqualValues(t, "v2", loaded.Preamble.PlutusVersion)
+
+	_, err = loaded.Validator("freezer.other")
+	assert.NotNil(t, err)
+}
+
+func Test_Parse_HashMismatch(t *testing.T) {
+	stale := strings.Replace(string(freezer.Blueprint), "73275b9e", "00000000", 1)
+	_, err := Parse([]byte(stale))
+	assert.NotNil(t, err)
+}
+
+func Test_ValidateStakeDatum(t *testing.T) {
+	validator, err := Freezer()
+	assert.Nil(t, err)
+	keyHash, _ := hex.DecodeString("c279a3fb3b4e62bbc78e288783b58045d4ae82a18867d8352d02775a")
+	signature := types.MultisigScript{Signature: &types.Signature{KeyHash: keyHash}}
+	for _, owner := range []types.MultisigScript{
+		signature,
+		{AllOf: &types.AllOf{Scripts: []types.MultisigScript{signature, {After: &types.After{Time: time.Unix(100, 0)}}}}},
+		{AtLeast: &types.AtLeast{Required: 1, Scripts: []types.MultisigScript{signature, {Before: &types.Before{Time: time.Unix(100, 0)}}}}},
+	} {
+		datum := types.StakeDatum{
+			Owner:       owner,
+			Delegations: []types.Delegation{{Program: "RBERRY", PoolIdent: "01", Weight: 5}},
+		}
+		assert.Nil(t, validator.ValidateStakeDatum(datum))
+	}
+	assert.Nil(t, validator.ValidateStakeDatum(types.StakeDatum{Owner: signature}))
+
+	// The datum from an actual lock transaction
+	bytes, _ := hex.DecodeString("d8799fd8799f581cc279a3fb3b4e62bbc78e288783b58045d4ae82a18867d8352d02775aff9fd8799f46524245525259410105ffd8799f46524245525259410d02ffd8799f46534245525259410101ffffff")
+	assert.Nil(t, validator.ValidateDatum(bytes))
+
+	// An owner that's an integer, rather than a script
+	bytes, _ = hex.DecodeString("d8799f0180ff")
+	assert.EqualError(t, validator.ValidateDatum(bytes), "invalid datum for freezer.stake: datum.owner: matches none of the alternatives for MultisigScript")
+	// A signature with an integer key hash
+	bytes, _ = hex.DecodeString("d8799fd8799f01ff80ff")
+	assert.EqualError(t, validator.ValidateDatum(bytes), "invalid datum for freezer.stake: datum.owner.key_hash: expected bytes, not uint64")
+	// A datum missing its data
+	bytes, _ = hex.DecodeString("d8799fd8799f41aaffff")
+	assert.EqualError(t, validator.ValidateDatum(bytes), "invalid datum for freezer.stake: datum: StakeDatum has 2 fields, not 1")
+}
@@ -0,0 +1,217 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// The shape of some Plutus data, as described by CIP-57; a schema with no data type, and no alternatives, is any data at all
+type Schema struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+
+	// One of integer, bytes, list, map or constructor
+	DataType string    `json:"dataType,omitempty"`
+	AnyOf    []*Schema `json:"anyOf,omitempty"`
+
+	// For constructors
+	Index  int       `json:"index,omitempty"`
+	Fields []*Schema `json:"fields,omitempty"`
+
+	// For lists
+	Items *Items `json:"items,omitempty"`
+
+	// For maps
+	Keys   *Schema `json:"keys,omitempty"`
+	Values *Schema `json:"values,omitempty"`
+}
+
+// The items of a list; either one schema for every item, or one for each item of a tuple
+type Items struct {
+	Schema *Schema
+	Tuple  []*Schema
+}
+
+func (i *Items) UnmarshalJSON(bytes []byte) error {
+	if err := json.Unmarshal(bytes, &i.Tuple); err == nil {
+		return nil
+	}
+	i.Tuple = nil
+	return json.Unmarshal(bytes, &i.Schema)
+}
+
+func (i Items) MarshalJSON() ([]byte, error) {
+	if i.Schema != nil {
+		return json.Marshal(i.Schema)
+	}
+	return json.Marshal(i.Tuple)
+}
+
+// Constructors 0 to 6 are tagged from 121, and 7 to 127 from 1280; anything else is tagged 102, with the index alongside the fields
+const (
+	compactConstructorTag    = 121
+	compactConstructorCount  = 7
+	extendedConstructorTag   = 1280
+	extendedConstructorCount = 121
+	generalConstructorTag    = 102
+)
+
+// Decode the index and fields of a constructor, from however it was tagged
+func constructor(data any) (int, []any, bool) {
+	tag, ok := data.(cbor.Tag)
+	if !ok {
+		return 0, nil, false
+	}
+	var index int
+	var content any
+	switch {
+	case tag.Number >= compactConstructorTag && tag.Number < compactConstructorTag+compactConstructorCount:
+		index, content = int(tag.Number-compactConstructorTag), tag.Content
+	case tag.Number >= extendedConstructorTag && tag.Number < extendedConstructorTag+extendedConstructorCount:
+		index, content = int(tag.Number-extendedConstructorTag)+compactConstructorCount, tag.Content
+	case tag.Number == generalConstructorTag:
+		pair, ok := tag.Content.([]any)
+		if !ok || len(pair) != 2 {
+			return 0, nil, false
+		}
+		i, ok := pair[0].(uint64)
+		if !ok {
+			return 0, nil, false
+		}
+		index, content = int(i), pair[1]
+	default:
+		return 0, nil, false
+	}
+	fields, ok := content.([]any)
+	if !ok {
+		return 0, nil, false
+	}
+	return index, fields, true
+}
+
+func isInteger(data any) bool {
+	switch data.(type) {
+	case uint64, int64, big.Int, *big.Int:
+		return true
+	}
+	return false
+}
+
+func name(schema *Schema, fallback string) string {
+	if schema.Title != "" {
+		return schema.Title
+	}
+	return fallback
+}
+
+// Check that decoded Plutus data matches the schema; path is where in the data we are, for errors
+func (b *Blueprint) validate(schema *Schema, data any, path string) error {
+	if schema.Ref != "" {
+		resolved, err := b.Resolve(schema.Ref)
+		if err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+		return b.validate(resolved, data, path)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		// Constructors are told apart by their index, so report why the matching one didn't fit, if there is one
+		index, _, isConstructor := constructor(data)
+		for _, option := range schema.AnyOf {
+			err := b.validate(option, data, path)
+			if err == nil {
+				return nil
+			}
+			if isConstructor && option.DataType == "constructor" && option.Index == index {
+				return err
+			}
+		}
+		return fmt.Errorf("%v: matches none of the alternatives for %v", path, name(schema, "the data"))
+	}
+
+	switch schema.DataType {
+	case "":
+		// Any data at all
+		return nil
+	case "integer":
+		if !isInteger(data) {
+			return fmt.Errorf("%v: expected an integer, not %T", path, data)
+		}
+	case "bytes":
+		if _, ok := data.([]byte); !ok {
+			return fmt.Errorf("%v: expected bytes, not %T", path, data)
+		}
+	case "list":
+		list, ok := data.([]any)
+		if !ok {
+			return fmt.Errorf("%v: expected a list, not %T", path, data)
+		}
+		if schema.Items == nil {
+			return nil
+		}
+		if schema.Items.Schema == nil {
+			if len(list) != len(schema.Items.Tuple) {
+				return fmt.Errorf("%v: expected %v items, not %v", path, len(schema.Items.Tuple), len(list))
+			}
+		}
+		for i, item := range list {
+			itemSchema := schema.Items.Schema
+			if itemSchema == nil {
+				itemSchema = schema.Items.Tuple[i]
+			}
+			if err := b.validate(itemSchema, item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "map":
+		entries, ok := data.(map[any]any)
+		if !ok {
+			return fmt.Errorf("%v: expected a map, not %T", path, data)
+		}
+		for key, value := range entries {
+			if key, ok := key.(cbor.ByteString); ok {
+				// Byte string keys are decoded as a ByteString, so they can be map keys
+				if err := b.validateKey(schema, []byte(key), path); err != nil {
+					return err
+				}
+			} else if err := b.validateKey(schema, key, path); err != nil {
+				return err
+			}
+			if schema.Values != nil {
+				if err := b.validate(schema.Values, value, fmt.Sprintf("%v[%v]", path, key)); err != nil {
+					return err
+				}
+			}
+		}
+	case "constructor":
+		index, fields, ok := constructor(data)
+		if !ok {
+			return fmt.Errorf("%v: expected a constructor, not %T", path, data)
+		}
+		if index != schema.Index {
+			return fmt.Errorf("%v: expected constructor %v, not %v", path, schema.Index, index)
+		}
+		if len(fields) != len(schema.Fields) {
+			return fmt.Errorf("%v: %v has %v fields, not %v", path, name(schema, "constructor"), len(schema.Fields), len(fields))
+		}
+		for i, field := range fields {
+			if err := b.validate(schema.Fields[i], field, path+"."+name(schema.Fields[i], fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%v: unsupported data type %v", path, schema.DataType)
+	}
+	return nil
+}
+
+func (b *Blueprint) validateKey(schema *Schema, key any, path string) error {
+	if schema.Keys == nil {
+		return nil
+	}
+	return b.validate(schema.Keys, key, fmt.Sprintf("%v key %v", path, key))
+}
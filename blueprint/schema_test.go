@@ -0,0 +1,49 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tj/assert"
+)
+
+func Test_Validate(t *testing.T) {
+	var blueprint Blueprint
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"definitions": {
+			"Int": {"dataType": "integer"},
+			"a/Pair": {"dataType": "list", "items": [{"$ref": "#/definitions/Int"}, {"dataType": "bytes"}]},
+			"Amounts": {"dataType": "map", "keys": {"dataType": "bytes"}, "values": {"$ref": "#/definitions/Int"}},
+			"Wide": {"anyOf": [
+				{"dataType": "constructor", "index": 0, "fields": []},
+				{"dataType": "constructor", "index": 7, "fields": [{"title": "amount", "$ref": "#/definitions/Int"}]},
+				{"dataType": "constructor", "index": 200, "fields": [{"$ref": "#/definitions/a~1Pair"}]}
+			]}
+		}
+	}`), &blueprint))
+	validate := func(ref string, value any) error {
+		bytes, err := cbor.Marshal(value)
+		assert.Nil(t, err)
+		var data any
+		assert.Nil(t, cbor.Unmarshal(bytes, &data))
+		return blueprint.validate(&Schema{Ref: ref}, data, "value")
+	}
+
+	assert.Nil(t, validate("#/definitions/a~1Pair", []any{1, []byte("a")}))
+	assert.EqualError(t, validate("#/definitions/a~1Pair", []any{1}), "value: expected 2 items, not 1")
+	assert.EqualError(t, validate("#/definitions/a~1Pair", []any{1, 2}), "value[1]: expected bytes, not uint64")
+
+	assert.Nil(t, validate("#/definitions/Amounts", map[string]any{}))
+	assert.Nil(t, validate("#/definitions/Amounts", map[cbor.ByteString]int{"a": 1, "b": -2}))
+	assert.NotNil(t, validate("#/definitions/Amounts", map[cbor.ByteString][]byte{"a": []byte("b")}))
+
+	// Each way of tagging a constructor
+	assert.Nil(t, validate("#/definitions/Wide", cbor.Tag{Number: 121, Content: []any{}}))
+	assert.Nil(t, validate("#/definitions/Wide", cbor.Tag{Number: 1280, Content: []any{5}}))
+	assert.EqualError(t, validate("#/definitions/Wide", cbor.Tag{Number: 1280, Content: []any{[]byte{}}}), "value.amount: expected an integer, not []uint8")
+	assert.Nil(t, validate("#/definitions/Wide", cbor.Tag{Number: 102, Content: []any{200, []any{[]any{1, []byte{}}}}}))
+	assert.EqualError(t, validate("#/definitions/Wide", cbor.Tag{Number: 122, Content: []any{}}), "value: matches none of the alternatives for the data")
+
+	assert.NotNil(t, validate("#/definitions/Missing", 1))
+}
@@ -0,0 +1,155 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/store"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// Supplies the inputs for a single days calculation
+type InputProvider interface {
+	// The positions that existed at any point during the slots, and a pool lookup as of the end of them
+	Inputs(ctx context.Context, program types.YieldProgram, date types.Date, startSlot uint64, endSlot uint64) ([]types.Position, types.PoolLookup, error)
+}
+
+type InputProviderFunc func(ctx context.Context, program types.YieldProgram, date types.Date, startSlot uint64, endSlot uint64) ([]types.Position, types.PoolLookup, error)
+
+func (f InputProviderFunc) Inputs(ctx context.Context, program types.YieldProgram, date types.Date, startSlot uint64, endSlot uint64) ([]types.Position, types.PoolLookup, error) {
+	return f(ctx, program, date, startSlot, endSlot)
+}
+
+// An InputProvider that can also stream a days positions, so the calculation doesn't have to hold them all in memory;
+// the runner reads positions from Source whenever the provider has it
+type SourceProvider interface {
+	InputProvider
+	Source(ctx context.Context, program types.YieldProgram, date types.Date, startSlot uint64, endSlot uint64) (types.PositionSource, types.PoolLookup, error)
+}
+
+// Runs the calculation for each day of a date range, in order, feeding each days outputs into the delegation window of the next.
+// Each day is saved to the store as soon as it's calculated, which doubles as a checkpoint:
+// days already in the store are skipped, so a failed run can simply be started again
+type Runner struct {
+	Program types.YieldProgram
+	Store   store.ResultStore
+	Inputs  InputProvider
+	Slots   types.SlotConfig
+	Options []yield.Option
+
+	// Called after each day is calculated, or found to already be in the store
+	OnDay func(date types.Date, outputs yield.CalculationOutputs, skipped bool)
+}
+
+// What a run did; on failure, everything up to the failed day
+type Report struct {
+	Calculated []types.Date
+	Skipped    []types.Date
+}
+
+// Calculate every day from `from` to `to`, inclusive; days outside the program are left out
+func (r *Runner) Run(ctx context.Context, from types.Date, to types.Date) (Report, error) {
+	var report Report
+	start, err := time.Parse(types.DateFormat, from)
+	if err != nil {
+		return report, fmt.Errorf("invalid date %v: %w", from, err)
+	}
+	end, err := time.Parse(types.DateFormat, to)
+	if err != nil {
+		return report, fmt.Errorf("invalid date %v: %w", to, err)
+	}
+	if end.Before(start) {
+		return report, fmt.Errorf("%v is after %v", from, to)
+	}
+	if err := r.Slots.Validate(); err != nil {
+		return report, err
+	}
+	// The days in the store were calculated with the stored program, so running a different program with the same ID
+	// would mix the two; the store refuses to replace it
+	if err := r.Store.SaveProgram(ctx, r.Program); err != nil {
+		return report, err
+	}
+
+	var history []yield.CalculationOutputs
+	historyLoaded := false
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(types.DateFormat)
+		if date < r.Program.FirstDailyRewards || (r.Program.LastDailyRewards != "" && date > r.Program.LastDailyRewards) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		// The first day's window comes from the store, after that we keep it up to date as we go
+		if !historyLoaded {
+			history, err = store.PreviousResults(ctx, r.Store, r.Program, date)
+			if err != nil {
+				return report, err
+			}
+			historyLoaded = true
+		}
+
+		outputs, skipped, err := r.runDay(ctx, date, history)
+		if err != nil {
+			return report, fmt.Errorf("failed to calculate %v: %w", date, err)
+		}
+		if skipped {
+			report.Skipped = append(report.Skipped, date)
+		} else {
+			report.Calculated = append(report.Calculated, date)
+		}
+		if r.OnDay != nil {
+			r.OnDay(date, outputs, skipped)
+		}
+
+		history = append(history, outputs)
+		window := r.Program.ConsecutiveDelegationWindow - 1
+		if window < 0 {
+			window = 0
+		}
+		if len(history) > window {
+			history = history[len(history)-window:]
+		}
+	}
+	return report, nil
+}
+
+func (r *Runner) runDay(ctx context.Context, date types.Date, history []yield.CalculationOutputs) (yield.CalculationOutputs, bool, error) {
+	existing, err := r.Store.Outputs(ctx, r.Program.ID, date)
+	if err == nil {
+		return existing, true, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return yield.CalculationOutputs{}, false, err
+	}
+
+	startSlot, endSlot, err := r.Slots.DaySlots(date)
+	if err != nil {
+		return yield.CalculationOutputs{}, false, err
+	}
+	outputs, err := r.calculate(ctx, date, startSlot, endSlot, history)
+	if err != nil {
+		return yield.CalculationOutputs{}, false, err
+	}
+	if err := r.Store.SaveOutputs(ctx, r.Program.ID, date, outputs); err != nil {
+		return yield.CalculationOutputs{}, false, err
+	}
+	return outputs, false, nil
+}
+
+func (r *Runner) calculate(ctx context.Context, date types.Date, startSlot uint64, endSlot uint64, history []yield.CalculationOutputs) (yield.CalculationOutputs, error) {
+	if sources, ok := r.Inputs.(SourceProvider); ok {
+		source, poolLookup, err := sources.Source(ctx, r.Program, date, startSlot, endSlot)
+		if err != nil {
+			return yield.CalculationOutputs{}, fmt.Errorf("failed to fetch inputs: %w", err)
+		}
+		return yield.CalculateEarningsFromSource(ctx, date, startSlot, endSlot, r.Program, history, source, poolLookup, r.Options...)
+	}
+	positions, poolLookup, err := r.Inputs.Inputs(ctx, r.Program, date, startSlot, endSlot)
+	if err != nil {
+		return yield.CalculationOutputs{}, fmt.Errorf("failed to fetch inputs: %w", err)
+	}
+	return yield.CalculateEarnings(ctx, date, startSlot, endSlot, r.Program, history, positions, poolLookup, r.Options...)
+}
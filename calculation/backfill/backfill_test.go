@@ -0,0 +1,168 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/store"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func sampleRunner(t *testing.T, failOn types.Date) (*Runner, map[types.Date][2]uint64) {
+	program := utilities.SampleYieldProgram(1000)
+	program.FirstDailyRewards = "2024-01-01"
+	program.ConsecutiveDelegationWindow = 3
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	position := utilities.SamplePosition("A", 100, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1})
+	value := shared.Value(position.Value)
+	value.AddAsset(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(100)})
+	position.Value = compatibility.CompatibleValue(value)
+
+	slots := map[types.Date][2]uint64{}
+	return &Runner{
+		Program: program,
+		Store:   store.NewFileStore(t.TempDir()),
+		Slots:   types.MainnetSlotConfig,
+		Inputs: InputProviderFunc(func(ctx context.Context, program types.YieldProgram, date types.Date, startSlot uint64, endSlot uint64) ([]types.Position, types.PoolLookup, error) {
+			if date == failOn {
+				return nil, nil, fmt.Errorf("node unavailable")
+			}
+			slots[date] = [2]uint64{startSlot, endSlot}
+			return []types.Position{position}, pools, nil
+		}),
+	}, slots
+}
+
+func Test_Runner(t *testing.T) {
+	ctx := context.Background()
+	runner, slots := sampleRunner(t, "")
+	var days []types.Date
+	runner.OnDay = func(date types.Date, outputs yield.CalculationOutputs, skipped bool) {
+		days = append(days, date)
+	}
+
+	// Days before the program starts are left out
+	report, err := runner.Run(ctx, "2023-12-30", "2024-01-05")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05"}, report.Calculated)
+	assert.Len(t, report.Skipped, 0)
+	assert.EqualValues(t, report.Calculated, days)
+
+	// Each day gets its own slots
+	start, end, err := types.MainnetSlotConfig.DaySlots("2024-01-03")
+	assert.Nil(t, err)
+	assert.EqualValues(t, [2]uint64{start, end}, slots["2024-01-03"])
+
+	// And each days window is built from the days before it, as the program starts up
+	for date, window := range map[types.Date]uint64{"2024-01-01": 100, "2024-01-02": 200, "2024-01-03": 300, "2024-01-05": 300} {
+		outputs, err := runner.Store.Outputs(ctx, runner.Program.ID, date)
+		assert.Nil(t, err)
+		assert.EqualValues(t, date, outputs.Date)
+		assert.EqualValues(t, window, outputs.DelegationOverWindowByPool["01"], date)
+		assert.EqualValues(t, 1000, outputs.EmissionsByOwner["A"])
+	}
+
+	// Continuing later picks the window up from the store
+	report, err = runner.Run(ctx, "2024-01-06", "2024-01-06")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-01-06"}, report.Calculated)
+	outputs, err := runner.Store.Outputs(ctx, runner.Program.ID, "2024-01-06")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 300, outputs.DelegationOverWindowByPool["01"])
+
+	_, err = runner.Run(ctx, "2024-01-06", "2024-01-05")
+	assert.NotNil(t, err)
+
+	// Without slots, nothing can be calculated
+	runner.Slots = types.SlotConfig{}
+	_, err = runner.Run(ctx, "2024-01-07", "2024-01-07")
+	assert.NotNil(t, err)
+}
+
+func Test_Runner_Resume(t *testing.T) {
+	ctx := context.Background()
+	runner, _ := sampleRunner(t, "2024-01-03")
+	report, err := runner.Run(ctx, "2024-01-01", "2024-01-05")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "2024-01-03")
+	assert.EqualValues(t, []types.Date{"2024-01-01", "2024-01-02"}, report.Calculated)
+
+	// Once the inputs are available again, the run picks up where it left off
+	resumed, _ := sampleRunner(t, "")
+	resumed.Store = runner.Store
+	report, err = resumed.Run(ctx, "2024-01-01", "2024-01-05")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-01-01", "2024-01-02"}, report.Skipped)
+	assert.EqualValues(t, []types.Date{"2024-01-03", "2024-01-04", "2024-01-05"}, report.Calculated)
+	outputs, err := resumed.Store.Outputs(ctx, resumed.Program.ID, "2024-01-03")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 300, outputs.DelegationOverWindowByPool["01"])
+
+	// Starting in the middle of a gap fails, rather than calculating with a short window
+	gap, _ := sampleRunner(t, "")
+	_, err = gap.Run(ctx, "2024-01-03", "2024-01-05")
+	assert.True(t, errors.Is(err, store.ErrNotFound))
+}
+
+func Test_Runner_ProgramChanged(t *testing.T) {
+	ctx := context.Background()
+	runner, _ := sampleRunner(t, "")
+	_, err := runner.Run(ctx, "2024-01-01", "2024-01-02")
+	assert.Nil(t, err)
+
+	// The days already in the store were calculated with the stored program, so a changed program isn't run over them
+	changed, slots := sampleRunner(t, "")
+	changed.Store = runner.Store
+	changed.Program.EmittedAsset = "Other"
+	report, err := changed.Run(ctx, "2024-01-01", "2024-01-03")
+	assert.True(t, errors.Is(err, store.ErrAlreadyExists))
+	assert.Len(t, report.Calculated, 0)
+	assert.Len(t, slots, 0)
+	stored, err := runner.Store.Program(ctx, runner.Program.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, runner.Program.EmittedAsset, stored.EmittedAsset)
+}
+
+type streamingInputs struct {
+	InputProvider
+	streamed []types.Date
+}
+
+func (s *streamingInputs) Source(ctx context.Context, program types.YieldProgram, date types.Date, startSlot uint64, endSlot uint64) (types.PositionSource, types.PoolLookup, error) {
+	positions, poolLookup, err := s.InputProvider.Inputs(ctx, program, date, startSlot, endSlot)
+	s.streamed = append(s.streamed, date)
+	return types.NewSlicePositionSource(positions), poolLookup, err
+}
+
+func Test_Runner_Streaming(t *testing.T) {
+	ctx := context.Background()
+	expected, _ := sampleRunner(t, "")
+	_, err := expected.Run(ctx, "2024-01-01", "2024-01-03")
+	assert.Nil(t, err)
+
+	// Providers that can stream the positions are read from that way, with the same results
+	runner, _ := sampleRunner(t, "")
+	inputs := &streamingInputs{InputProvider: runner.Inputs}
+	runner.Inputs = inputs
+	_, err = runner.Run(ctx, "2024-01-01", "2024-01-03")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-01-01", "2024-01-02", "2024-01-03"}, inputs.streamed)
+	for _, date := range inputs.streamed {
+		want, err := expected.Store.Outputs(ctx, expected.Program.ID, date)
+		assert.Nil(t, err)
+		got, err := runner.Store.Outputs(ctx, runner.Program.ID, date)
+		assert.Nil(t, err)
+		assert.EqualValues(t, want.EarningsRoot, got.EarningsRoot, date)
+		assert.EqualValues(t, want.Inputs, got.Inputs, date)
+	}
+}
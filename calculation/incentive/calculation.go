@@ -10,6 +10,7 @@ import (
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/pricing"
 	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
 )
 
@@ -27,6 +28,13 @@ type CalculationOutputs struct {
 	EmissionsByOwner map[string]uint64
 
 	Earnings []types.Earning
+	// The merkle root of the earnings, so each owner can be shown to be included; see types.EarningsTree
+	EarningsRoot string
+
+	Warnings []types.Warning
+
+	// Digests of the program, positions and pools these outputs were calculated from
+	Inputs types.InputDigests
 }
 
 func PositionsToOwners(positions []types.Position) map[string]types.MultisigScript {
@@ -43,58 +51,105 @@ func CalculateDelegationWeights(
 	positions []types.Position,
 	startSlot, endSlot uint64,
 	poolLookup types.PoolLookup,
+	opts ...Option,
 ) (map[string]uint64, num.Int, error) {
+	weights, total, _, err := CalculateDelegationWeightsFromSource(ctx, program, types.NewSlicePositionSource(positions), startSlot, endSlot, poolLookup, opts...)
+	return weights, total, err
+}
+
+// Calculate the delegation weight of each owner in a single pass over the positions, without holding them all in memory;
+// also returns the owner of each OwnerID, for building the earnings
+func CalculateDelegationWeightsFromSource(
+	ctx context.Context,
+	program types.IncentiveProgram,
+	source types.PositionSource,
+	startSlot, endSlot uint64,
+	poolLookup types.PoolLookup,
+	opts ...Option,
+) (map[string]uint64, num.Int, map[string]types.MultisigScript, error) {
+	o := applyOptions(opts)
 	delegationWeightByOwner := map[string]uint64{}
-	windowLength := num.Uint64(endSlot - startSlot)
+	ownersById := map[string]types.MultisigScript{}
 	total := num.Uint64(0)
-	for _, position := range positions {
-		if len(position.Delegation) == 0 {
-			continue
-		}
-		truncatedStart := position.Slot
-		if truncatedStart < startSlot {
-			truncatedStart = startSlot
+	err := types.ForEachPosition(ctx, source, func(position types.Position) error {
+		ownersById[position.OwnerID] = position.Owner
+		weight, err := delegationWeight(ctx, program, position, startSlot, endSlot, poolLookup, o)
+		if err != nil {
+			return err
 		}
-		truncatedEnd := position.SpentSlot
-		if position.SpentTransaction == "" || truncatedEnd > endSlot {
-			truncatedEnd = endSlot
+		if weight.Uint64() == 0 {
+			return nil
 		}
-		programValue := shared.Value(position.Value)
-		stakedAsset := programValue.AssetAmount(program.StakedAsset)
-		for policyId, assets := range programValue {
-			for assetName, amount := range assets {
-				assetId := shared.FromSeparate(policyId, assetName)
-				if poolLookup.IsLPToken(assetId) {
-
-					pool, err := poolLookup.PoolByLPToken(ctx, assetId)
-					if err != nil {
-						return nil, num.Int64(0), fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
-					}
+		total = total.Add(weight)
+		delegationWeightByOwner[position.OwnerID] += weight.Uint64()
+		return nil
+	})
+	if err != nil {
+		return nil, num.Int64(0), nil, err
+	}
+	return delegationWeightByOwner, total, ownersById, nil
+}
+
+// The delegation weight of a single position, scaled by the fraction of the window it was locked for
+func delegationWeight(
+	ctx context.Context,
+	program types.IncentiveProgram,
+	position types.Position,
+	startSlot, endSlot uint64,
+	poolLookup types.PoolLookup,
+	o calculationOptions,
+) (num.Int, error) {
+	if len(position.Delegation) == 0 {
+		return num.Uint64(0), nil
+	}
+	windowLength := num.Uint64(endSlot - startSlot)
+	truncatedStart := position.Slot
+	if truncatedStart < startSlot {
+		truncatedStart = startSlot
+	}
+	truncatedEnd := position.SpentSlot
+	if position.SpentTransaction == "" || truncatedEnd > endSlot {
+		truncatedEnd = endSlot
+	}
+	programValue := shared.Value(position.Value)
+	stakedAsset := programValue.AssetAmount(program.StakedAsset)
+	for policyId, assets := range programValue {
+		for assetName, amount := range assets {
+			assetId := shared.FromSeparate(policyId, assetName)
+			if poolLookup.IsLPToken(assetId) {
 
-					if pool.AssetA == program.StakedAsset || pool.AssetB == program.StakedAsset {
-						frac := big.NewInt(amount.Int64())
-						if pool.AssetA == program.StakedAsset {
-							frac = frac.Mul(frac, big.NewInt(int64(pool.AssetAQuantity)))
-						} else if pool.AssetB == program.StakedAsset {
-							frac = frac.Mul(frac, big.NewInt(int64(pool.AssetBQuantity)))
-						}
-						frac = frac.Div(frac, big.NewInt(int64(pool.TotalLPTokens)))
-						stakedAsset = stakedAsset.Add(num.Int(*frac))
+				pool, err := poolLookup.PoolByLPToken(ctx, assetId)
+				if err != nil {
+					return num.Int64(0), fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
+				}
+				if pool.TotalLPTokens == 0 {
+					// The pool has since been deleted, so skip this LP asset
+					o.warn(types.Warning{
+						Code:      types.WarningDeletedPoolLP,
+						PoolIdent: pool.PoolIdent,
+						OwnerID:   position.OwnerID,
+						Message:   fmt.Sprintf("skipped %v of LP token %v for a deleted pool", amount.Uint64(), assetId),
+					})
+					continue
+				}
+
+				if pool.AssetA == program.StakedAsset || pool.AssetB == program.StakedAsset {
+					frac := big.NewInt(amount.Int64())
+					if pool.AssetA == program.StakedAsset {
+						frac = frac.Mul(frac, big.NewInt(int64(pool.AssetAQuantity)))
+					} else if pool.AssetB == program.StakedAsset {
+						frac = frac.Mul(frac, big.NewInt(int64(pool.AssetBQuantity)))
 					}
+					frac = frac.Div(frac, big.NewInt(int64(pool.TotalLPTokens)))
+					stakedAsset = stakedAsset.Add(num.Int(*frac))
 				}
 			}
 		}
-
-		positionLength := num.Uint64(truncatedEnd - truncatedStart)
-		numerator := stakedAsset.Mul(positionLength)
-		weight := numerator.Div(windowLength)
-		if weight.Uint64() == 0 {
-			continue
-		}
-		total = total.Add(weight)
-		delegationWeightByOwner[position.OwnerID] += weight.Uint64()
 	}
-	return delegationWeightByOwner, total, nil
+
+	positionLength := num.Uint64(truncatedEnd - truncatedStart)
+	numerator := stakedAsset.Mul(positionLength)
+	return numerator.Div(windowLength), nil
 }
 
 func SplitEmissionPerOwner(
@@ -179,6 +234,20 @@ func EstimateLovelaceValue(
 	}
 }
 
+// Estimate the lovelace value of an amount of some asset, according to a price oracle
+func EstimateLovelaceValueFromOracle(
+	ctx context.Context,
+	amount uint64,
+	asset shared.AssetID,
+	oracle pricing.PriceOracle,
+) (uint64, error) {
+	value, err := pricing.LovelaceValue(ctx, oracle, num.Uint64(amount).BigInt(), asset)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to price %v: %w", asset, err)
+	}
+	return value.Uint64(), nil
+}
+
 func CalculateEarnings(
 	ctx context.Context,
 	startDate, endDate types.Date,
@@ -187,27 +256,80 @@ func CalculateEarnings(
 	program types.IncentiveProgram,
 	positions []types.Position,
 	poolLookup types.PoolLookup,
+	opts ...Option,
 ) (CalculationOutputs, error) {
-	weightByOwner, total, err := CalculateDelegationWeights(ctx, program, positions, startSlot, endSlot, poolLookup)
+	return CalculateEarningsFromSource(ctx, startDate, endDate, startSlot, endSlot, emission, program, types.NewSlicePositionSource(positions), poolLookup, opts...)
+}
+
+// Calculate the earnings in a single pass over the positions, without holding them all in memory
+func CalculateEarningsFromSource(
+	ctx context.Context,
+	startDate, endDate types.Date,
+	startSlot, endSlot uint64,
+	emission uint64,
+	program types.IncentiveProgram,
+	source types.PositionSource,
+	poolLookup types.PoolLookup,
+	opts ...Option,
+) (CalculationOutputs, error) {
+	o := applyOptions(opts)
+
+	// Collect every warning on the outputs, while still passing them on to the callers logger
+	warnings := &types.WarningCollector{Next: o.logger}
+	opts = append(append([]Option{}, opts...), WithLogger(warnings))
+
+	// Record what went into the calculation, including every pool it looks up
+	programDigest, err := types.Digest(program)
 	if err != nil {
-		return CalculationOutputs{}, fmt.Errorf("Failed to calculate delegation by weights")
+		return CalculationOutputs{}, fmt.Errorf("failed to digest program: %w", err)
 	}
-	emissionsByOwner := SplitEmissionPerOwner(emission, weightByOwner, total)
-	ownersById := PositionsToOwners(positions)
-	earnings := EmissionsToEarnings(program, endDate, emissionsByOwner, ownersById)
+	positions := types.NewDigestingPositionSource(source)
+	pools := types.NewPoolRecorder(poolLookup)
+	source, poolLookup = positions, pools
 
-	emittedLovelaceValue, err := EstimateLovelaceValue(ctx, emission, program.EmittedAsset, program.EmittedReferencePool, poolLookup)
+	weightByOwner, total, ownersById, err := CalculateDelegationWeightsFromSource(ctx, program, source, startSlot, endSlot, poolLookup, opts...)
 	if err != nil {
-		return CalculationOutputs{}, fmt.Errorf("Failed to estimate lovelace value: %w", err)
+		return CalculationOutputs{}, fmt.Errorf("Failed to calculate delegation by weights: %w", err)
 	}
-	stakedLovelaceValue, err := EstimateLovelaceValue(ctx, total.Uint64(), program.StakedAsset, program.StakedReferencePool, poolLookup)
+	emissionsByOwner := SplitEmissionPerOwner(emission, weightByOwner, total)
+	earnings := EmissionsToEarnings(program, endDate, emissionsByOwner, ownersById)
+	earningsTree, err := types.NewEarningsTree(earnings)
 	if err != nil {
-		return CalculationOutputs{}, fmt.Errorf("Failed to estimate lovelace value: %w", err)
+		return CalculationOutputs{}, fmt.Errorf("failed to commit to earnings: %w", err)
+	}
+
+	var emittedLovelaceValue, stakedLovelaceValue uint64
+	if o.priceOracle != nil {
+		emittedLovelaceValue, err = EstimateLovelaceValueFromOracle(ctx, emission, program.EmittedAsset, o.priceOracle)
+		if err != nil {
+			return CalculationOutputs{}, fmt.Errorf("Failed to estimate lovelace value: %w", err)
+		}
+		stakedLovelaceValue, err = EstimateLovelaceValueFromOracle(ctx, total.Uint64(), program.StakedAsset, o.priceOracle)
+		if err != nil {
+			return CalculationOutputs{}, fmt.Errorf("Failed to estimate lovelace value: %w", err)
+		}
+	} else {
+		emittedLovelaceValue, err = EstimateLovelaceValue(ctx, emission, program.EmittedAsset, program.EmittedReferencePool, poolLookup)
+		if err != nil {
+			return CalculationOutputs{}, fmt.Errorf("Failed to estimate lovelace value: %w", err)
+		}
+		stakedLovelaceValue, err = EstimateLovelaceValue(ctx, total.Uint64(), program.StakedAsset, program.StakedReferencePool, poolLookup)
+		if err != nil {
+			return CalculationOutputs{}, fmt.Errorf("Failed to estimate lovelace value: %w", err)
+		}
+	}
+	inputs := types.InputDigests{Program: programDigest}
+	if inputs.Positions, err = positions.Digest(); err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to digest positions: %w", err)
+	}
+	if inputs.Pools, err = pools.Digest(); err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to digest pools: %w", err)
 	}
 	return CalculationOutputs{
 		Timestamp:                 time.Now().Format(time.RFC3339),
 		StartDate:                 startDate,
 		EndDate:                   endDate,
+		Inputs:                    inputs,
 		TotalEmissions:            emission,
 		EmittedAssetLovelaceValue: emittedLovelaceValue,
 		StakedAssetLovelaceValue:  stakedLovelaceValue,
@@ -216,5 +338,7 @@ func CalculateEarnings(
 		DelegatorWeights:          weightByOwner,
 		EmissionsByOwner:          emissionsByOwner,
 		Earnings:                  earnings,
+		EarningsRoot:              earningsTree.Root(),
+		Warnings:                  warnings.Warnings(),
 	}, nil
 }
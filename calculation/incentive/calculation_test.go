@@ -7,6 +7,7 @@ import (
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/pricing"
 	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
 	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
 	"github.com/tj/assert"
@@ -79,6 +80,55 @@ func Test_CalculateDelegationWeights_WithLP(t *testing.T) {
 	assert.EqualValues(t, 150, weights["B"])
 }
 
+func Test_CalculateDelegationWeights_WithDeletedPool(t *testing.T) {
+	delegation := types.Delegation{Program: "A", PoolIdent: "B", Weight: 10}
+	program := utilities.SampleIncentiveProgram()
+	positions := []types.Position{
+		utilities.SamplePosition("A", 100, delegation),
+		utilities.SamplePosition("B", 50, delegation),
+	}
+	positions[0].Value = compatibility.CompatibleValue(shared.ValueFromCoins(
+		shared.Coin{AssetId: shared.AssetID("Staked"), Amount: num.Uint64(100)},
+		shared.Coin{AssetId: shared.AssetID("LP_X"), Amount: num.Uint64(100)},
+	))
+	pools := utilities.MockLookup{
+		"X": {PoolIdent: "X", LPAsset: "LP_X", AssetA: shared.AdaAssetID, AssetB: shared.AssetID("Staked"), TotalLPTokens: 0},
+	}
+
+	// The LP for a deleted pool counts for nothing, rather than dividing by its 0 LP tokens; the rest of the position,
+	// and every other position, still counts
+	weights, total, err := CalculateDelegationWeights(context.Background(), program, positions, 0, 2592000, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 150, total.Uint64())
+	assert.EqualValues(t, map[string]uint64{"A": 100, "B": 50}, weights)
+}
+
+func Test_CalculateDelegationWeights_WarnsOfDeletedPool(t *testing.T) {
+	delegation := types.Delegation{Program: "A", PoolIdent: "B", Weight: 10}
+	program := utilities.SampleIncentiveProgram()
+	positions := []types.Position{
+		utilities.SamplePosition("A", 100, delegation),
+	}
+	positions[0].Value = compatibility.CompatibleValue(shared.ValueFromCoins(
+		shared.Coin{AssetId: shared.AssetID("Staked"), Amount: num.Uint64(100)},
+		shared.Coin{AssetId: shared.AssetID("LP_X"), Amount: num.Uint64(100)},
+	))
+	pools := utilities.MockLookup{
+		"X": {PoolIdent: "X", LPAsset: "LP_X", AssetA: shared.AdaAssetID, AssetB: shared.AssetID("Staked"), TotalLPTokens: 0},
+	}
+
+	var logged []types.Warning
+	logger := types.WarningLoggerFunc(func(warning types.Warning) {
+		logged = append(logged, warning)
+	})
+	_, _, err := CalculateDelegationWeights(context.Background(), program, positions, 0, 2592000, pools, WithLogger(logger))
+	assert.Nil(t, err)
+	assert.Len(t, logged, 1)
+	assert.EqualValues(t, types.WarningDeletedPoolLP, logged[0].Code)
+	assert.EqualValues(t, "X", logged[0].PoolIdent)
+	assert.EqualValues(t, "A", logged[0].OwnerID)
+}
+
 func Test_CalculationDelegationWeights_WithTimedPositions(t *testing.T) {
 	delegation := types.Delegation{Program: "A", PoolIdent: "B", Weight: 10}
 	program := utilities.SampleIncentiveProgram()
@@ -136,3 +186,58 @@ func Test_CalculateLovelaceValue(t *testing.T) {
 	assert.Nil(t, err)
 	assert.EqualValues(t, 2_635_299_245_059, value)
 }
+
+func Test_CalculateLovelaceValueFromOracle(t *testing.T) {
+	history := utilities.MockPoolHistory{
+		"X": {
+			{PoolIdent: "X", Slot: 0, AssetA: shared.AdaAssetID, AssetB: "Staked", AssetAQuantity: 1000, AssetBQuantity: 1000},
+			{PoolIdent: "X", Slot: 2592000 - 1, AssetA: shared.AdaAssetID, AssetB: "Staked", AssetAQuantity: 1_000_000, AssetBQuantity: 1000},
+		},
+	}
+	oracle := pricing.TWAPOracle{
+		ReferencePools: map[shared.AssetID]string{"Staked": "X"},
+		History:        history,
+		StartSlot:      0,
+		EndSlot:        2592000,
+	}
+	// The pump in the last slot barely moves the price
+	value, err := EstimateLovelaceValueFromOracle(context.Background(), 2_592_000, "Staked", oracle)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2_592_000-1+1000, value)
+
+	_, err = EstimateLovelaceValueFromOracle(context.Background(), 100, utilities.EmittedAsset, oracle)
+	assert.NotNil(t, err)
+}
+
+func Test_CalculateEarningsFromSource(t *testing.T) {
+	delegation := types.Delegation{Program: "A", PoolIdent: "B", Weight: 10}
+	program := utilities.SampleIncentiveProgram()
+	positions := []types.Position{
+		utilities.SamplePosition("A", 100, delegation),
+		utilities.SampleTimedPosition("A", 200, 0, 1296000, delegation),
+		utilities.SamplePosition("B", 150, delegation),
+		utilities.SamplePosition("C", 150),
+	}
+	pools := utilities.MockLookup{
+		"X": {PoolIdent: "X", AssetA: shared.AdaAssetID, AssetB: "Staked", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"Y": {PoolIdent: "Y", AssetA: shared.AdaAssetID, AssetB: utilities.EmittedAsset, AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	fromSlice, err := CalculateEarnings(context.Background(), "2024-01-01", "2024-01-30", 0, 2592000, 1000, program, positions, pools)
+	assert.Nil(t, err)
+	fromSource, err := CalculateEarningsFromSource(context.Background(), "2024-01-01", "2024-01-30", 0, 2592000, 1000, program, types.NewSlicePositionSource(positions), pools)
+	assert.Nil(t, err)
+	fromSlice.Timestamp, fromSource.Timestamp = "", ""
+	assert.ElementsMatch(t, fromSlice.Earnings, fromSource.Earnings)
+	fromSlice.Earnings, fromSource.Earnings = nil, nil
+	assert.EqualValues(t, fromSlice, fromSource)
+	assert.EqualValues(t, map[string]uint64{"A": 200, "B": 150}, fromSource.DelegatorWeights)
+
+	// The outputs record exactly what they were calculated from
+	programDigest, err := types.Digest(program)
+	assert.Nil(t, err)
+	positionsDigest, err := types.DigestPositions(positions)
+	assert.Nil(t, err)
+	poolsDigest, err := types.DigestPools([]types.Pool{pools["X"], pools["Y"]})
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.InputDigests{Program: programDigest, Positions: positionsDigest, Pools: poolsDigest}, fromSource.Inputs)
+}
@@ -0,0 +1,42 @@
+package incentive
+
+import (
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/pricing"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+type calculationOptions struct {
+	priceOracle pricing.PriceOracle
+	logger      types.WarningLogger
+}
+
+// Configures optional behavior of the calculation
+type Option func(*calculationOptions)
+
+func applyOptions(opts []Option) calculationOptions {
+	o := calculationOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Estimate lovelace values using the given price oracle, rather than the spot price of the programs reference pools
+func WithPriceOracle(oracle pricing.PriceOracle) Option {
+	return func(o *calculationOptions) {
+		o.priceOracle = oracle
+	}
+}
+
+// Report each warning to the given logger as it's encountered, in addition to collecting them on the outputs
+func WithLogger(logger types.WarningLogger) Option {
+	return func(o *calculationOptions) {
+		o.logger = logger
+	}
+}
+
+func (o calculationOptions) warn(warning types.Warning) {
+	if o.logger != nil {
+		o.logger.Warn(warning)
+	}
+}
@@ -0,0 +1,271 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// How many pools to fetch at once when prefetching from a lookup that can't fetch them in bulk
+const DefaultPrefetchConcurrency = 8
+
+// A PoolLookup that remembers every pool it has fetched, so each pool is fetched at most once;
+// the pool data is a snapshot, so create a new one for each run. Safe for concurrent use
+type CachingPoolLookup struct {
+	PoolLookup types.PoolLookup
+
+	// How many pools to fetch at once when prefetching, if the lookup doesn't implement types.BatchPoolLookup
+	PrefetchConcurrency int
+
+	onCacheHit func(method string)
+	mu         sync.Mutex
+	byIdent    map[string]types.Pool
+	byLPToken  map[shared.AssetID]types.Pool
+	isLPToken  map[shared.AssetID]bool
+	allPools   []types.Pool
+	inFlight   map[string]*call
+	allFetched bool
+}
+
+// A single fetch, which concurrent lookups for the same key wait on rather than repeating
+type call struct {
+	done chan struct{}
+	pool types.Pool
+	err  error
+}
+
+type CacheOption func(c *CachingPoolLookup)
+
+// Call the hook whenever a lookup is served from the cache, for example to count hits
+func WithCacheHitHook(hook func(method string)) CacheOption {
+	return func(c *CachingPoolLookup) {
+		c.onCacheHit = hook
+	}
+}
+
+func NewCachingPoolLookup(poolLookup types.PoolLookup, opts ...CacheOption) *CachingPoolLookup {
+	c := &CachingPoolLookup{PoolLookup: poolLookup}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *CachingPoolLookup) init() {
+	if c.byIdent == nil {
+		c.byIdent = map[string]types.Pool{}
+		c.byLPToken = map[shared.AssetID]types.Pool{}
+		c.isLPToken = map[shared.AssetID]bool{}
+		c.inFlight = map[string]*call{}
+	}
+}
+
+func (c *CachingPoolLookup) hit(method string) {
+	if c.onCacheHit != nil {
+		c.onCacheHit(method)
+	}
+}
+
+// Remember a pool under both its ident and its LP token; the caller must hold the lock
+func (c *CachingPoolLookup) store(pool types.Pool) {
+	c.byIdent[pool.PoolIdent] = pool
+	if pool.LPAsset != "" {
+		c.byLPToken[pool.LPAsset] = pool
+		c.isLPToken[pool.LPAsset] = true
+	}
+}
+
+// Remember a pool under the LP token it was fetched by, as well as its own ident and LP token, which may not be the
+// same token, or may be missing; the caller must hold the lock
+func (c *CachingPoolLookup) storeByLPToken(lpToken shared.AssetID, pool types.Pool) {
+	c.store(pool)
+	c.byLPToken[lpToken] = pool
+	c.isLPToken[lpToken] = true
+}
+
+// Look up a pool in the cache, or fetch it and remember it, making sure that only one fetch for each key is ever in flight
+func (c *CachingPoolLookup) get(method string, key string, cached func() (types.Pool, bool), fetch func() (types.Pool, error), store func(pool types.Pool)) (types.Pool, error) {
+	c.mu.Lock()
+	c.init()
+	if pool, ok := cached(); ok {
+		c.mu.Unlock()
+		c.hit(method)
+		return pool, nil
+	}
+	if pending, ok := c.inFlight[key]; ok {
+		c.mu.Unlock()
+		<-pending.done
+		if pending.err == nil {
+			c.hit(method)
+		}
+		return pending.pool, pending.err
+	}
+	pending := &call{done: make(chan struct{})}
+	c.inFlight[key] = pending
+	c.mu.Unlock()
+
+	pending.pool, pending.err = fetch()
+
+	c.mu.Lock()
+	// Errors aren't cached, so that a transient failure can be retried
+	if pending.err == nil {
+		store(pending.pool)
+	}
+	delete(c.inFlight, key)
+	c.mu.Unlock()
+	close(pending.done)
+	return pending.pool, pending.err
+}
+
+func (c *CachingPoolLookup) PoolByIdent(ctx context.Context, poolIdent string) (types.Pool, error) {
+	return c.get("PoolByIdent", "ident:"+poolIdent, func() (types.Pool, bool) {
+		pool, ok := c.byIdent[poolIdent]
+		return pool, ok
+	}, func() (types.Pool, error) {
+		return c.PoolLookup.PoolByIdent(ctx, poolIdent)
+	}, c.store)
+}
+
+func (c *CachingPoolLookup) PoolByLPToken(ctx context.Context, lpToken shared.AssetID) (types.Pool, error) {
+	return c.get("PoolByLPToken", "lp:"+string(lpToken), func() (types.Pool, bool) {
+		pool, ok := c.byLPToken[lpToken]
+		return pool, ok
+	}, func() (types.Pool, error) {
+		return c.PoolLookup.PoolByLPToken(ctx, lpToken)
+	}, func(pool types.Pool) {
+		c.storeByLPToken(lpToken, pool)
+	})
+}
+
+func (c *CachingPoolLookup) IsLPToken(assetId shared.AssetID) bool {
+	c.mu.Lock()
+	c.init()
+	isLP, ok := c.isLPToken[assetId]
+	c.mu.Unlock()
+	if ok {
+		c.hit("IsLPToken")
+		return isLP
+	}
+	isLP = c.PoolLookup.IsLPToken(assetId)
+	c.mu.Lock()
+	c.isLPToken[assetId] = isLP
+	c.mu.Unlock()
+	return isLP
+}
+
+func (c *CachingPoolLookup) LPTokenToPoolIdent(lpToken shared.AssetID) (string, error) {
+	c.mu.Lock()
+	c.init()
+	pool, ok := c.byLPToken[lpToken]
+	c.mu.Unlock()
+	if ok {
+		c.hit("LPTokenToPoolIdent")
+		return pool.PoolIdent, nil
+	}
+	return c.PoolLookup.LPTokenToPoolIdent(lpToken)
+}
+
+// List every pool, if the underlying lookup can; also fills the cache with every pool
+func (c *CachingPoolLookup) AllPools(ctx context.Context) ([]types.Pool, error) {
+	snapshot, ok := c.PoolLookup.(types.PoolSnapshot)
+	if !ok {
+		return nil, fmt.Errorf("caching a %T: %w", c.PoolLookup, types.ErrSnapshotUnsupported)
+	}
+	c.mu.Lock()
+	c.init()
+	if c.allFetched {
+		pools := append([]types.Pool{}, c.allPools...)
+		c.mu.Unlock()
+		c.hit("AllPools")
+		return pools, nil
+	}
+	c.mu.Unlock()
+
+	pools, err := snapshot.AllPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	for _, pool := range pools {
+		c.store(pool)
+	}
+	c.allPools = append([]types.Pool{}, pools...)
+	c.allFetched = true
+	c.mu.Unlock()
+	return pools, nil
+}
+
+// Fetch the pool for every LP token held by the positions ahead of time,
+// in a single round trip if the underlying lookup implements types.BatchPoolLookup
+func (c *CachingPoolLookup) Prefetch(ctx context.Context, positions []types.Position) error {
+	seen := map[shared.AssetID]bool{}
+	var lpTokens []shared.AssetID
+	for _, position := range positions {
+		for policy, policyMap := range position.Value {
+			for assetName := range policyMap {
+				assetId := shared.FromSeparate(policy, assetName)
+				if seen[assetId] || !c.IsLPToken(assetId) {
+					continue
+				}
+				seen[assetId] = true
+				c.mu.Lock()
+				_, cached := c.byLPToken[assetId]
+				c.mu.Unlock()
+				if !cached {
+					lpTokens = append(lpTokens, assetId)
+				}
+			}
+		}
+	}
+	if len(lpTokens) == 0 {
+		return nil
+	}
+	sort.Slice(lpTokens, func(i, j int) bool {
+		return lpTokens[i] < lpTokens[j]
+	})
+
+	if batch, ok := c.PoolLookup.(types.BatchPoolLookup); ok {
+		pools, err := batch.PoolsByLPTokens(ctx, lpTokens)
+		if err != nil {
+			return fmt.Errorf("failed to prefetch %v pools: %w", len(lpTokens), err)
+		}
+		c.mu.Lock()
+		for lpToken, pool := range pools {
+			c.storeByLPToken(lpToken, pool)
+		}
+		c.mu.Unlock()
+		return nil
+	}
+
+	concurrency := c.PrefetchConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPrefetchConcurrency
+	}
+	errs := make([]error, len(lpTokens))
+	tokens := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tokens {
+				_, errs[i] = c.PoolByLPToken(ctx, lpTokens[i])
+			}
+		}()
+	}
+	for i := range lpTokens {
+		tokens <- i
+	}
+	close(tokens)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to prefetch pool for LP token %v: %w", lpTokens[i], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+// Counts the calls that make it through to the underlying lookup
+type countingLookup struct {
+	utilities.MockLookup
+	delay time.Duration
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (l *countingLookup) count(method string) {
+	time.Sleep(l.delay)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.calls == nil {
+		l.calls = map[string]int{}
+	}
+	l.calls[method] += 1
+}
+
+func (l *countingLookup) Calls(method string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.calls[method]
+}
+
+func (l *countingLookup) PoolByIdent(ctx context.Context, poolIdent string) (types.Pool, error) {
+	l.count("PoolByIdent")
+	return l.MockLookup.PoolByIdent(ctx, poolIdent)
+}
+
+func (l *countingLookup) PoolByLPToken(ctx context.Context, lpToken shared.AssetID) (types.Pool, error) {
+	l.count("PoolByLPToken")
+	return l.MockLookup.PoolByLPToken(ctx, lpToken)
+}
+
+// Can't list every pool
+type plainLookup struct {
+	types.PoolLookup
+}
+
+type batchLookup struct {
+	*countingLookup
+}
+
+func (l batchLookup) PoolsByLPTokens(ctx context.Context, lpTokens []shared.AssetID) (map[shared.AssetID]types.Pool, error) {
+	l.count("PoolsByLPTokens")
+	pools := map[shared.AssetID]types.Pool{}
+	for _, lpToken := range lpTokens {
+		pool, err := l.MockLookup.PoolByLPToken(ctx, lpToken)
+		if err != nil {
+			return nil, err
+		}
+		pools[lpToken] = pool
+	}
+	return pools, nil
+}
+
+func samplePools() utilities.MockLookup {
+	pools := utilities.MockLookup{}
+	for i := 0; i < 10; i++ {
+		ident := fmt.Sprintf("%02d", i)
+		pools[ident] = types.Pool{PoolIdent: ident, LPAsset: shared.AssetID("LP_" + ident), TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "Staked", AssetAQuantity: 1000, AssetBQuantity: 1000}
+	}
+	return pools
+}
+
+func samplePositions(program types.YieldProgram) []types.Position {
+	var positions []types.Position
+	for i := 0; i < 30; i++ {
+		ident := fmt.Sprintf("%02d", i%10)
+		position := utilities.SamplePosition(fmt.Sprintf("Owner%v", i), 1000, types.Delegation{Program: program.ID, PoolIdent: ident, Weight: 1})
+		value := shared.Value(position.Value)
+		value.AddAsset(shared.Coin{AssetId: shared.AssetID("LP_" + ident), Amount: num.Uint64(100)})
+		position.Value = compatibility.CompatibleValue(value)
+		positions = append(positions, position)
+	}
+	return positions
+}
+
+func Test_CachingPoolLookup(t *testing.T) {
+	underlying := &countingLookup{MockLookup: samplePools()}
+	hits := 0
+	cache := NewCachingPoolLookup(underlying, WithCacheHitHook(func(method string) { hits += 1 }))
+
+	pool, err := cache.PoolByIdent(context.Background(), "01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "LP_01", pool.LPAsset)
+	pool, err = cache.PoolByIdent(context.Background(), "01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "LP_01", pool.LPAsset)
+	assert.EqualValues(t, 1, underlying.Calls("PoolByIdent"))
+	assert.EqualValues(t, 1, hits)
+
+	// Fetching by ident also caches by LP token
+	pool, err = cache.PoolByLPToken(context.Background(), "LP_01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "01", pool.PoolIdent)
+	assert.EqualValues(t, 0, underlying.Calls("PoolByLPToken"))
+	ident, err := cache.LPTokenToPoolIdent("LP_01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "01", ident)
+
+	// Errors aren't cached
+	_, err = cache.PoolByIdent(context.Background(), "99")
+	assert.NotNil(t, err)
+	_, err = cache.PoolByIdent(context.Background(), "99")
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 3, underlying.Calls("PoolByIdent"))
+
+	// Listing every pool fills the cache
+	pools, err := cache.AllPools(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, pools, 10)
+	_, err = cache.PoolByIdent(context.Background(), "05")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, underlying.Calls("PoolByIdent"))
+}
+
+// Returns pools without their LP token, as a lookup that only knows the token it was asked about might
+type unnamedLPLookup struct {
+	*countingLookup
+}
+
+func (l unnamedLPLookup) PoolByLPToken(ctx context.Context, lpToken shared.AssetID) (types.Pool, error) {
+	pool, err := l.countingLookup.PoolByLPToken(ctx, lpToken)
+	pool.LPAsset = ""
+	return pool, err
+}
+
+func Test_CachingPoolLookup_ByQueriedLPToken(t *testing.T) {
+	underlying := &countingLookup{MockLookup: samplePools()}
+	cache := NewCachingPoolLookup(unnamedLPLookup{underlying})
+
+	// The pool is remembered under the token it was looked up by, even though it doesn't say what its own is
+	for i := 0; i < 3; i++ {
+		pool, err := cache.PoolByLPToken(context.Background(), "LP_01")
+		assert.Nil(t, err)
+		assert.EqualValues(t, "01", pool.PoolIdent)
+	}
+	assert.EqualValues(t, 1, underlying.Calls("PoolByLPToken"))
+	ident, err := cache.LPTokenToPoolIdent("LP_01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "01", ident)
+	_, err = cache.PoolByIdent(context.Background(), "01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, underlying.Calls("PoolByIdent"))
+}
+
+func Test_CachingPoolLookup_Concurrent(t *testing.T) {
+	underlying := &countingLookup{MockLookup: samplePools(), delay: 10 * time.Millisecond}
+	cache := NewCachingPoolLookup(underlying)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ident := fmt.Sprintf("%02d", i%3)
+			pool, err := cache.PoolByIdent(context.Background(), ident)
+			assert.Nil(t, err)
+			assert.EqualValues(t, ident, pool.PoolIdent)
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 3, underlying.Calls("PoolByIdent"))
+}
+
+func Test_CachingPoolLookup_Prefetch(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000)
+	program.ConsecutiveDelegationWindow = 1
+	positions := samplePositions(program)
+
+	underlying := &countingLookup{MockLookup: samplePools()}
+	cache := NewCachingPoolLookup(underlying)
+	assert.Nil(t, cache.Prefetch(context.Background(), positions))
+	assert.EqualValues(t, 10, underlying.Calls("PoolByLPToken"))
+
+	// After prefetching, the whole calculation runs without going back to the underlying lookup
+	cached, err := yield.CalculateEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, cache)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 10, underlying.Calls("PoolByLPToken"))
+	assert.EqualValues(t, 0, underlying.Calls("PoolByIdent"))
+
+	// And gives the same results as without the cache
+	uncached, err := yield.CalculateEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, samplePools())
+	assert.Nil(t, err)
+	cached.Timestamp, uncached.Timestamp = "", ""
+	assert.EqualValues(t, uncached, cached)
+
+	// A lookup that can fetch in bulk is only called once
+	batch := batchLookup{&countingLookup{MockLookup: samplePools()}}
+	cache = NewCachingPoolLookup(batch)
+	assert.Nil(t, cache.Prefetch(context.Background(), positions))
+	assert.EqualValues(t, 1, batch.Calls("PoolsByLPTokens"))
+	assert.EqualValues(t, 0, batch.Calls("PoolByLPToken"))
+	_, err = cache.PoolByLPToken(context.Background(), "LP_03")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, batch.Calls("PoolByLPToken"))
+}
+
+func Test_CachingPoolLookup_SnapshotUnsupported(t *testing.T) {
+	cache := NewCachingPoolLookup(plainLookup{&countingLookup{MockLookup: samplePools()}})
+	_, err := cache.AllPools(context.Background())
+	assert.True(t, errors.Is(err, types.ErrSnapshotUnsupported))
+
+	// Pricing falls back to the pools in the positions
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: "X", AssetB: "Y", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	positions := []types.Position{
+		{OwnerID: "A", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(100)}))},
+		{OwnerID: "B", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_02", Amount: num.Uint64(100)}))},
+	}
+	cache = NewCachingPoolLookup(plainLookup{&countingLookup{MockLookup: pools}})
+	snapshot, err := yield.CalculateLPSnapshot(context.Background(), 0, positions, nil, cache)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"01": 200, "02": 200}, snapshot.EstimatedLovelaceByPool)
+}
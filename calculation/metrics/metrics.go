@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/incentive"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/lookup"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sundae_yield"
+
+// The Prometheus metrics describing each calculation run
+type Metrics struct {
+	Runs        *prometheus.CounterVec
+	RunDuration *prometheus.HistogramVec
+
+	Positions         *prometheus.GaugeVec
+	DisqualifiedPools *prometheus.GaugeVec
+	Emissions         *prometheus.GaugeVec
+	EmissionBudget    *prometheus.GaugeVec
+	Warnings          *prometheus.CounterVec
+
+	PoolLookupCalls     *prometheus.CounterVec
+	PoolLookupCacheHits *prometheus.CounterVec
+	PoolLookupDuration  *prometheus.HistogramVec
+}
+
+// Create the metrics, and register them with the registerer
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		Runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "Number of calculation runs, by calculator, program and result",
+		}, []string{"calculator", "program", "result"}),
+		RunDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "run_duration_seconds",
+			Help:      "How long each calculation run took",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"calculator", "program"}),
+		Positions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "positions",
+			Help:      "Number of positions considered by the latest run",
+		}, []string{"calculator", "program"}),
+		DisqualifiedPools: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "disqualified_pools",
+			Help:      "Number of pools disqualified from emissions by the latest run",
+		}, []string{"program"}),
+		Emissions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "emissions",
+			Help:      "Amount of the emitted asset earned by owners in the latest run",
+		}, []string{"calculator", "program"}),
+		EmissionBudget: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "emission_budget",
+			Help:      "Amount of the emitted asset the program allowed for the latest run",
+		}, []string{"calculator", "program"}),
+		Warnings: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "warnings_total",
+			Help:      "Number of warnings raised by calculation runs, by code",
+		}, []string{"calculator", "program", "code"}),
+		PoolLookupCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pool_lookup_calls_total",
+			Help:      "Number of calls to the pool lookup, by method",
+		}, []string{"method"}),
+		PoolLookupCacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pool_lookup_cache_hits_total",
+			Help:      "Number of pool lookups served from a cache, by method",
+		}, []string{"method"}),
+		PoolLookupDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "pool_lookup_duration_seconds",
+			Help:      "Latency of calls to the pool lookup, by method",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"method"}),
+	}
+	for _, collector := range []prometheus.Collector{
+		m.Runs, m.RunDuration,
+		m.Positions, m.DisqualifiedPools, m.Emissions, m.EmissionBudget, m.Warnings,
+		m.PoolLookupCalls, m.PoolLookupCacheHits, m.PoolLookupDuration,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// Record that a pool lookup was served from a cache, rather than from the underlying source; suitable as a
+// lookup.CachingPoolLookup's cache hit hook
+func (m *Metrics) CacheHit(method string) {
+	m.PoolLookupCacheHits.WithLabelValues(method).Inc()
+}
+
+// Cache a pool lookup, reporting each lookup served from the cache
+func (m *Metrics) NewCachingPoolLookup(poolLookup types.PoolLookup, opts ...lookup.CacheOption) *lookup.CachingPoolLookup {
+	return lookup.NewCachingPoolLookup(poolLookup, append(opts, lookup.WithCacheHitHook(m.CacheHit))...)
+}
+
+func (m *Metrics) observeLookup(method string, start time.Time) {
+	m.PoolLookupCalls.WithLabelValues(method).Inc()
+	m.PoolLookupDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) observeRun(calculator, program string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.Runs.WithLabelValues(calculator, program, result).Inc()
+	m.RunDuration.WithLabelValues(calculator, program).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) observeWarnings(calculator, program string, warnings []types.Warning) {
+	for _, warning := range warnings {
+		m.Warnings.WithLabelValues(calculator, program, string(warning.Code)).Inc()
+	}
+}
+
+// Run yield.CalculateEarnings, recording metrics about the run and every pool lookup it makes
+func (m *Metrics) CalculateYieldEarnings(ctx context.Context, date types.Date, startSlot uint64, endSlot uint64, program types.YieldProgram, previousResults []yield.CalculationOutputs, positions []types.Position, poolLookup types.PoolLookup, opts ...yield.Option) (yield.CalculationOutputs, error) {
+	start := time.Now()
+	outputs, err := yield.CalculateEarnings(ctx, date, startSlot, endSlot, program, previousResults, positions, m.InstrumentPoolLookup(poolLookup), opts...)
+	m.observeRun("yield", program.ID, start, err)
+	if err != nil {
+		return outputs, err
+	}
+
+	m.Positions.WithLabelValues("yield", program.ID).Set(float64(len(positions)))
+	m.DisqualifiedPools.WithLabelValues(program.ID).Set(float64(len(outputs.PoolDisqualificationReasons)))
+	m.Emissions.WithLabelValues("yield", program.ID).Set(float64(outputs.TotalEmissions))
+	m.EmissionBudget.WithLabelValues("yield", program.ID).Set(float64(program.DailyEmission))
+	m.observeWarnings("yield", program.ID, outputs.Warnings)
+	return outputs, nil
+}
+
+// Run incentive.CalculateEarnings, recording metrics about the run and every pool lookup it makes
+func (m *Metrics) CalculateIncentiveEarnings(ctx context.Context, startDate, endDate types.Date, startSlot, endSlot uint64, emission uint64, program types.IncentiveProgram, positions []types.Position, poolLookup types.PoolLookup, opts ...incentive.Option) (incentive.CalculationOutputs, error) {
+	start := time.Now()
+	outputs, err := incentive.CalculateEarnings(ctx, startDate, endDate, startSlot, endSlot, emission, program, positions, m.InstrumentPoolLookup(poolLookup), opts...)
+	m.observeRun("incentive", program.ID, start, err)
+	if err != nil {
+		return outputs, err
+	}
+
+	// Every owner's share of the emission is rounded, so sum the earnings to see what was actually handed out
+	earned := uint64(0)
+	for _, amount := range outputs.EmissionsByOwner {
+		earned += amount
+	}
+	m.Positions.WithLabelValues("incentive", program.ID).Set(float64(len(positions)))
+	m.Emissions.WithLabelValues("incentive", program.ID).Set(float64(earned))
+	m.EmissionBudget.WithLabelValues("incentive", program.ID).Set(float64(emission))
+	m.observeWarnings("incentive", program.ID, outputs.Warnings)
+	return outputs, nil
+}
+
+// Wrap a pool lookup, counting and timing each call; the wrapper can list every pool, or fetch pools in bulk, only if
+// the underlying lookup can. To count cache hits too, create the cache with NewCachingPoolLookup
+func (m *Metrics) InstrumentPoolLookup(poolLookup types.PoolLookup) types.PoolLookup {
+	instrumented := instrumentedPoolLookup{poolLookup: poolLookup, metrics: m}
+	snapshot, isSnapshot := poolLookup.(types.PoolSnapshot)
+	batch, isBatch := poolLookup.(types.BatchPoolLookup)
+	switch {
+	case isSnapshot && isBatch:
+		return struct {
+			instrumentedPoolSnapshot
+			instrumentedBatch
+		}{instrumentedPoolSnapshot{instrumented, snapshot}, instrumentedBatch{batch, m}}
+	case isSnapshot:
+		return instrumentedPoolSnapshot{instrumentedPoolLookup: instrumented, snapshot: snapshot}
+	case isBatch:
+		return struct {
+			instrumentedPoolLookup
+			instrumentedBatch
+		}{instrumented, instrumentedBatch{batch, m}}
+	}
+	return instrumented
+}
+
+type instrumentedPoolLookup struct {
+	poolLookup types.PoolLookup
+	metrics    *Metrics
+}
+
+func (l instrumentedPoolLookup) observe(method string, start time.Time) {
+	l.metrics.observeLookup(method, start)
+}
+
+func (l instrumentedPoolLookup) PoolByIdent(ctx context.Context, poolIdent string) (types.Pool, error) {
+	defer l.observe("PoolByIdent", time.Now())
+	return l.poolLookup.PoolByIdent(ctx, poolIdent)
+}
+
+func (l instrumentedPoolLookup) PoolByLPToken(ctx context.Context, lpToken shared.AssetID) (types.Pool, error) {
+	defer l.observe("PoolByLPToken", time.Now())
+	return l.poolLookup.PoolByLPToken(ctx, lpToken)
+}
+
+func (l instrumentedPoolLookup) IsLPToken(assetId shared.AssetID) bool {
+	defer l.observe("IsLPToken", time.Now())
+	return l.poolLookup.IsLPToken(assetId)
+}
+
+func (l instrumentedPoolLookup) LPTokenToPoolIdent(lpToken shared.AssetID) (string, error) {
+	defer l.observe("LPTokenToPoolIdent", time.Now())
+	return l.poolLookup.LPTokenToPoolIdent(lpToken)
+}
+
+type instrumentedPoolSnapshot struct {
+	instrumentedPoolLookup
+	snapshot types.PoolSnapshot
+}
+
+func (l instrumentedPoolSnapshot) AllPools(ctx context.Context) ([]types.Pool, error) {
+	defer l.observe("AllPools", time.Now())
+	return l.snapshot.AllPools(ctx)
+}
+
+type instrumentedBatch struct {
+	batch   types.BatchPoolLookup
+	metrics *Metrics
+}
+
+func (l instrumentedBatch) PoolsByLPTokens(ctx context.Context, lpTokens []shared.AssetID) (map[shared.AssetID]types.Pool, error) {
+	defer l.metrics.observeLookup("PoolsByLPTokens", time.Now())
+	return l.batch.PoolsByLPTokens(ctx, lpTokens)
+}
+
+// An HTTP handler that serves the gathered metrics in the Prometheus exposition format
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+// Serve the gathered metrics at /metrics on the given address, until the context is cancelled
+func Serve(ctx context.Context, addr string, gatherer prometheus.Gatherer) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(gatherer))
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("metrics server failed: %w", err)
+	case <-ctx.Done():
+		if err := server.Shutdown(context.Background()); err != nil {
+			return fmt.Errorf("failed to shut down metrics server: %w", err)
+		}
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("metrics server failed: %w", err)
+		}
+		return nil
+	}
+}
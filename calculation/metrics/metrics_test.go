@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/lookup"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tj/assert"
+)
+
+func Test_CalculateYieldEarnings(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := NewMetrics(registry)
+	assert.Nil(t, err)
+
+	program := utilities.SampleYieldProgram(500_000_000)
+	program.ConsecutiveDelegationWindow = 1
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: program.StakedAsset, AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	position := utilities.SamplePosition("Me", 100_000, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1})
+	value := shared.Value(position.Value)
+	value.AddAsset(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(500)})
+	position.Value = compatibility.CompatibleValue(value)
+
+	outputs, err := m.CalculateYieldEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, []types.Position{position}, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 500_000_000, outputs.TotalEmissions)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(m.Runs.WithLabelValues("yield", program.ID, "success")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(m.Positions.WithLabelValues("yield", program.ID)))
+	assert.EqualValues(t, 0, testutil.ToFloat64(m.DisqualifiedPools.WithLabelValues(program.ID)))
+	assert.EqualValues(t, 500_000_000, testutil.ToFloat64(m.Emissions.WithLabelValues("yield", program.ID)))
+	assert.EqualValues(t, 500_000_000, testutil.ToFloat64(m.EmissionBudget.WithLabelValues("yield", program.ID)))
+	assert.Greater(t, testutil.ToFloat64(m.PoolLookupCalls.WithLabelValues("IsLPToken")), float64(0))
+	assert.Greater(t, testutil.ToFloat64(m.PoolLookupCalls.WithLabelValues("PoolByLPToken")), float64(0))
+
+	// Failed runs are counted too
+	program.EmissionWeighting = "Unknown"
+	_, err = m.CalculateYieldEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, []types.Position{position}, pools)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 1, testutil.ToFloat64(m.Runs.WithLabelValues("yield", program.ID, "failure")))
+
+	server := httptest.NewServer(Handler(registry))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `sundae_yield_runs_total{calculator="yield",program="TestYield",result="success"} 1`)
+}
+
+func Test_CalculateIncentiveEarnings(t *testing.T) {
+	m, err := NewMetrics(prometheus.NewRegistry())
+	assert.Nil(t, err)
+
+	program := utilities.SampleIncentiveProgram()
+	pools := utilities.MockLookup{
+		"X": {PoolIdent: "X", AssetA: shared.AdaAssetID, AssetB: "Staked", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"Y": {PoolIdent: "Y", AssetA: shared.AdaAssetID, AssetB: utilities.EmittedAsset, AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	delegation := types.Delegation{Program: program.ID, PoolIdent: "B", Weight: 1}
+	positions := []types.Position{
+		utilities.SamplePosition("A", 100, delegation),
+		utilities.SamplePosition("B", 200, delegation),
+	}
+	_, err = m.CalculateIncentiveEarnings(context.Background(), "2024-01-01", "2024-01-30", 0, 2592000, 1000, program, positions, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, testutil.ToFloat64(m.Runs.WithLabelValues("incentive", program.ID, "success")))
+	assert.EqualValues(t, 2, testutil.ToFloat64(m.Positions.WithLabelValues("incentive", program.ID)))
+	assert.EqualValues(t, 1000, testutil.ToFloat64(m.Emissions.WithLabelValues("incentive", program.ID)))
+	assert.EqualValues(t, 1000, testutil.ToFloat64(m.EmissionBudget.WithLabelValues("incentive", program.ID)))
+	assert.EqualValues(t, 2, testutil.ToFloat64(m.PoolLookupCalls.WithLabelValues("PoolByIdent")))
+}
+
+func Test_InstrumentPoolLookup(t *testing.T) {
+	m, err := NewMetrics(prometheus.NewRegistry())
+	assert.Nil(t, err)
+
+	// The instrumented lookup can only list every pool if the underlying one can
+	_, ok := m.InstrumentPoolLookup(utilities.MockLookup{}).(types.PoolSnapshot)
+	assert.True(t, ok)
+	_, ok = m.InstrumentPoolLookup(struct{ types.PoolLookup }{utilities.MockLookup{}}).(types.PoolSnapshot)
+	assert.False(t, ok)
+
+	// Or fetch pools in bulk, if the underlying one can
+	_, ok = m.InstrumentPoolLookup(batchLookup{utilities.MockLookup{}}).(types.BatchPoolLookup)
+	assert.True(t, ok)
+	_, ok = m.InstrumentPoolLookup(batchLookup{utilities.MockLookup{}}).(types.PoolSnapshot)
+	assert.True(t, ok)
+	_, ok = m.InstrumentPoolLookup(utilities.MockLookup{}).(types.BatchPoolLookup)
+	assert.False(t, ok)
+	pools := utilities.MockLookup{"01": {PoolIdent: "01", LPAsset: "LP_01"}}
+	batchOnly := m.InstrumentPoolLookup(struct {
+		types.PoolLookup
+		types.BatchPoolLookup
+	}{pools, batchLookup{pools}})
+	_, ok = batchOnly.(types.PoolSnapshot)
+	assert.False(t, ok)
+	batch, ok := batchOnly.(types.BatchPoolLookup)
+	assert.True(t, ok)
+	_, err = batch.PoolsByLPTokens(context.Background(), []shared.AssetID{"LP_01"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, testutil.ToFloat64(m.PoolLookupCalls.WithLabelValues("PoolsByLPTokens")))
+
+	m.CacheHit("PoolByIdent")
+	assert.EqualValues(t, 1, testutil.ToFloat64(m.PoolLookupCacheHits.WithLabelValues("PoolByIdent")))
+
+	// A cache reports its hits, every call after the first, as well as every call being counted
+	m, err = NewMetrics(prometheus.NewRegistry())
+	assert.Nil(t, err)
+	cache := m.NewCachingPoolLookup(utilities.MockLookup{"02": {PoolIdent: "02"}})
+	instrumented := m.InstrumentPoolLookup(cache)
+	for i := 0; i < 3; i++ {
+		_, err = instrumented.PoolByIdent(context.Background(), "02")
+		assert.Nil(t, err)
+	}
+	assert.EqualValues(t, 3, testutil.ToFloat64(m.PoolLookupCalls.WithLabelValues("PoolByIdent")))
+	assert.EqualValues(t, 2, testutil.ToFloat64(m.PoolLookupCacheHits.WithLabelValues("PoolByIdent")))
+
+	// Instrumenting a cache created elsewhere counts its calls, but leaves the cache as it is
+	m, err = NewMetrics(prometheus.NewRegistry())
+	assert.Nil(t, err)
+	instrumented = m.InstrumentPoolLookup(lookup.NewCachingPoolLookup(utilities.MockLookup{"02": {PoolIdent: "02"}}))
+	for i := 0; i < 3; i++ {
+		_, err = instrumented.PoolByIdent(context.Background(), "02")
+		assert.Nil(t, err)
+	}
+	assert.EqualValues(t, 3, testutil.ToFloat64(m.PoolLookupCalls.WithLabelValues("PoolByIdent")))
+	assert.EqualValues(t, 0, testutil.ToFloat64(m.PoolLookupCacheHits.WithLabelValues("PoolByIdent")))
+
+	// Registering the same metrics twice is an error
+	registry := prometheus.NewRegistry()
+	_, err = NewMetrics(registry)
+	assert.Nil(t, err)
+	_, err = NewMetrics(registry)
+	assert.NotNil(t, err)
+}
+
+// A lookup that can fetch pools in bulk
+type batchLookup struct {
+	utilities.MockLookup
+}
+
+func (l batchLookup) PoolsByLPTokens(ctx context.Context, lpTokens []shared.AssetID) (map[shared.AssetID]types.Pool, error) {
+	pools := map[shared.AssetID]types.Pool{}
+	for _, lpToken := range lpTokens {
+		pool, err := l.PoolByLPToken(ctx, lpToken)
+		if err != nil {
+			return nil, err
+		}
+		pools[lpToken] = pool
+	}
+	return pools, nil
+}
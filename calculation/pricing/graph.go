@@ -0,0 +1,195 @@
+package pricing
+
+import (
+	"container/heap"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// We're currently transitioning from "" and "." to "ada.lovelace", so treat all of these as ADA
+func IsAda(asset shared.AssetID) bool {
+	return asset == "" || asset == "." || asset == shared.AdaAssetID
+}
+
+func normalize(asset shared.AssetID) shared.AssetID {
+	if IsAda(asset) {
+		return shared.AdaAssetID
+	}
+	return asset
+}
+
+// A path through a sequence of pools, by which an asset can be priced in lovelace
+type Route struct {
+	// The assets visited, starting with the asset being priced and ending with ADA
+	Assets []shared.AssetID
+	// The pools traded through, in order
+	Pools []string
+	// The price of one unit of the asset, in lovelace
+	Price *big.Rat
+	// The shallowest liquidity, in lovelace, of any pool along the route
+	Depth *big.Rat
+}
+
+func (r Route) String() string {
+	if len(r.Pools) == 0 {
+		return string(shared.AdaAssetID)
+	}
+	var sb strings.Builder
+	for i, pool := range r.Pools {
+		sb.WriteString(fmt.Sprintf("%v -[%v]-> ", r.Assets[i], pool))
+	}
+	sb.WriteString(string(r.Assets[len(r.Assets)-1]))
+	return sb.String()
+}
+
+// Convert an amount of the routes asset into lovelace, rounding down
+func (r Route) LovelaceValue(amount *big.Int) *big.Int {
+	value := big.NewInt(0).Mul(amount, r.Price.Num())
+	return value.Div(value, r.Price.Denom())
+}
+
+// A graph of the pools in a snapshot, used to price assets in lovelace even when they don't have a pool directly against ADA
+type Graph struct {
+	routes map[shared.AssetID]Route
+}
+
+type edge struct {
+	pool        types.Pool
+	from        shared.AssetID
+	to          shared.AssetID
+	reserveFrom uint64
+	reserveTo   uint64
+}
+
+// Build a pricing graph from a set of pools, finding for every reachable asset the route to ADA with the deepest liquidity;
+// that is, the route whose shallowest pool holds the most value
+func NewGraph(pools []types.Pool) *Graph {
+	// Sort the pools, so ties are always broken the same way
+	sorted := make([]types.Pool, len(pools))
+	copy(sorted, pools)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PoolIdent < sorted[j].PoolIdent
+	})
+
+	edges := map[shared.AssetID][]edge{}
+	seen := map[string]bool{}
+	for _, pool := range sorted {
+		if seen[pool.PoolIdent] || pool.AssetAQuantity == 0 || pool.AssetBQuantity == 0 {
+			continue
+		}
+		seen[pool.PoolIdent] = true
+		a, b := normalize(pool.AssetA), normalize(pool.AssetB)
+		if a == b {
+			continue
+		}
+		edges[a] = append(edges[a], edge{pool: pool, from: a, to: b, reserveFrom: pool.AssetAQuantity, reserveTo: pool.AssetBQuantity})
+		edges[b] = append(edges[b], edge{pool: pool, from: b, to: a, reserveFrom: pool.AssetBQuantity, reserveTo: pool.AssetAQuantity})
+	}
+
+	// Search outward from ADA, always expanding the asset with the deepest route found so far;
+	// since a route can only get shallower as it gets longer, the first route we settle on for each asset is the deepest
+	routes := map[shared.AssetID]Route{
+		shared.AdaAssetID: {
+			Assets: []shared.AssetID{shared.AdaAssetID},
+			Price:  big.NewRat(1, 1),
+			Depth:  nil, // Unbounded
+		},
+	}
+	settled := map[shared.AssetID]bool{}
+	queue := &routeQueue{}
+	heap.Push(queue, queued{asset: shared.AdaAssetID, route: routes[shared.AdaAssetID]})
+	for queue.Len() > 0 {
+		next := heap.Pop(queue).(queued)
+		if settled[next.asset] {
+			continue
+		}
+		settled[next.asset] = true
+		for _, e := range edges[next.asset] {
+			if settled[e.to] {
+				continue
+			}
+			// The liquidity of this hop is the value of the side we already know the price of
+			depth := big.NewRat(0, 1).SetInt(big.NewInt(0).SetUint64(e.reserveFrom))
+			depth = depth.Mul(depth, next.route.Price)
+			if next.route.Depth != nil && next.route.Depth.Cmp(depth) < 0 {
+				depth = next.route.Depth
+			}
+			price := big.NewRat(0, 1).SetFrac(big.NewInt(0).SetUint64(e.reserveFrom), big.NewInt(0).SetUint64(e.reserveTo))
+			price = price.Mul(price, next.route.Price)
+			candidate := Route{
+				Assets: append([]shared.AssetID{e.to}, next.route.Assets...),
+				Pools:  append([]string{e.pool.PoolIdent}, next.route.Pools...),
+				Price:  price,
+				Depth:  depth,
+			}
+			if existing, ok := routes[e.to]; ok && !deeper(candidate, existing) {
+				continue
+			}
+			routes[e.to] = candidate
+			heap.Push(queue, queued{asset: e.to, route: candidate})
+		}
+	}
+	return &Graph{routes: routes}
+}
+
+// Whether route a should be preferred over route b; deeper liquidity first, then fewer hops, then by pool ident
+func deeper(a, b Route) bool {
+	if a.Depth == nil || b.Depth == nil {
+		return a.Depth == nil && b.Depth != nil
+	}
+	if c := a.Depth.Cmp(b.Depth); c != 0 {
+		return c > 0
+	}
+	if len(a.Pools) != len(b.Pools) {
+		return len(a.Pools) < len(b.Pools)
+	}
+	return strings.Join(a.Pools, ",") < strings.Join(b.Pools, ",")
+}
+
+// Find the deepest route to price the asset in lovelace, if there is one
+func (g *Graph) Route(asset shared.AssetID) (Route, bool) {
+	route, ok := g.routes[normalize(asset)]
+	return route, ok
+}
+
+// Estimate the lovelace value of an amount of some asset, along with the route used to price it
+func (g *Graph) LovelaceValue(amount *big.Int, asset shared.AssetID) (*big.Int, Route, bool) {
+	route, ok := g.Route(asset)
+	if !ok {
+		return big.NewInt(0), Route{}, false
+	}
+	return route.LovelaceValue(amount), route, true
+}
+
+type queued struct {
+	asset shared.AssetID
+	route Route
+}
+
+// A max-heap of routes, deepest first
+type routeQueue []queued
+
+func (q routeQueue) Len() int { return len(q) }
+func (q routeQueue) Less(i, j int) bool {
+	if deeper(q[i].route, q[j].route) {
+		return true
+	}
+	if deeper(q[j].route, q[i].route) {
+		return false
+	}
+	return q[i].asset < q[j].asset
+}
+func (q routeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *routeQueue) Push(x any)   { *q = append(*q, x.(queued)) }
+func (q *routeQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,80 @@
+package pricing
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func samplePools() []types.Pool {
+	return []types.Pool{
+		{PoolIdent: "01", AssetA: "", AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+		{PoolIdent: "02", AssetA: shared.AdaAssetID, AssetB: "Y", AssetAQuantity: 100, AssetBQuantity: 100},
+		{PoolIdent: "03", AssetA: "X", AssetB: "Y", AssetAQuantity: 10000, AssetBQuantity: 5000},
+		{PoolIdent: "04", AssetA: "Y", AssetB: "Z", AssetAQuantity: 50, AssetBQuantity: 100},
+		{PoolIdent: "05", AssetA: "P", AssetB: "Q", AssetAQuantity: 50, AssetBQuantity: 100},
+	}
+}
+
+func Test_DirectRoute(t *testing.T) {
+	graph := NewGraph(samplePools())
+	route, ok := graph.Route("X")
+	assert.True(t, ok)
+	assert.EqualValues(t, []string{"01"}, route.Pools)
+	assert.EqualValues(t, "X -[01]-> ada.lovelace", route.String())
+	assert.EqualValues(t, big.NewRat(1, 2), route.Price)
+	assert.EqualValues(t, big.NewRat(1000, 1), route.Depth)
+
+	route, ok = graph.Route(".")
+	assert.True(t, ok)
+	assert.EqualValues(t, "ada.lovelace", route.String())
+}
+
+func Test_DeepestRoute(t *testing.T) {
+	graph := NewGraph(samplePools())
+	// Y has a direct ADA pool, but it's much shallower than going through X
+	route, ok := graph.Route("Y")
+	assert.True(t, ok)
+	assert.EqualValues(t, "Y -[03]-> X -[01]-> ada.lovelace", route.String())
+	assert.EqualValues(t, big.NewRat(1, 1), route.Price)
+	assert.EqualValues(t, big.NewRat(1000, 1), route.Depth)
+
+	value, route, ok := graph.LovelaceValue(big.NewInt(1_000), "Z")
+	assert.True(t, ok)
+	assert.EqualValues(t, "Z -[04]-> Y -[03]-> X -[01]-> ada.lovelace", route.String())
+	assert.EqualValues(t, big.NewRat(50, 1), route.Depth)
+	assert.EqualValues(t, 500, value.Int64())
+
+	// When the shallow pool gets deeper, it should be preferred
+	pools := samplePools()
+	pools[1].AssetAQuantity = 1_000_000
+	pools[1].AssetBQuantity = 1_000_000
+	route, ok = NewGraph(pools).Route("Y")
+	assert.True(t, ok)
+	assert.EqualValues(t, "Y -[02]-> ada.lovelace", route.String())
+}
+
+func Test_UnreachableRoute(t *testing.T) {
+	graph := NewGraph(samplePools())
+	value, _, ok := graph.LovelaceValue(big.NewInt(1_000), "P")
+	assert.False(t, ok)
+	assert.EqualValues(t, 0, value.Int64())
+	_, ok = graph.Route("Missing")
+	assert.False(t, ok)
+}
+
+func Test_RouteIsDeterministic(t *testing.T) {
+	pools := []types.Pool{
+		{PoolIdent: "02", AssetA: "", AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		{PoolIdent: "01", AssetA: "", AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+	}
+	for i := 0; i < 10; i++ {
+		route, ok := NewGraph(pools).Route("X")
+		assert.True(t, ok)
+		assert.EqualValues(t, "X -[01]-> ada.lovelace", route.String())
+		pools[0], pools[1] = pools[1], pools[0]
+	}
+}
@@ -0,0 +1,161 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// Returned (wrapped) by an oracle that has no way to price an asset, as opposed to failing to price it
+var ErrNoPrice = errors.New("no price available")
+
+// A source of prices for estimating the lovelace value of assets
+type PriceOracle interface {
+	// The price of one unit of the asset, in lovelace
+	LovelacePrice(ctx context.Context, asset shared.AssetID) (*big.Rat, error)
+}
+
+// Estimate the lovelace value of an amount of some asset, rounding down
+func LovelaceValue(ctx context.Context, oracle PriceOracle, amount *big.Int, asset shared.AssetID) (*big.Int, error) {
+	price, err := oracle.LovelacePrice(ctx, asset)
+	if err != nil {
+		return big.NewInt(0), err
+	}
+	value := big.NewInt(0).Mul(amount, price.Num())
+	return value.Div(value, price.Denom()), nil
+}
+
+// The price of the non-ADA asset of an ADA/X pool
+func spotPrice(pool types.Pool, asset shared.AssetID) (*big.Rat, error) {
+	if !IsAda(pool.AssetA) {
+		return nil, fmt.Errorf("reference pool %v doesn't have ADA as assetA", pool.PoolIdent)
+	}
+	if pool.AssetB != asset {
+		return nil, fmt.Errorf("reference pool %v is for the wrong asset: %v", pool.PoolIdent, pool.AssetB)
+	}
+	if pool.AssetBQuantity == 0 {
+		return nil, fmt.Errorf("reference pool %v has no %v: %w", pool.PoolIdent, asset, ErrNoPrice)
+	}
+	return big.NewRat(0, 1).SetFrac(big.NewInt(0).SetUint64(pool.AssetAQuantity), big.NewInt(0).SetUint64(pool.AssetBQuantity)), nil
+}
+
+// Prices each asset by the reserves of its ADA reference pool at the snapshot
+type SpotOracle struct {
+	ReferencePools map[shared.AssetID]string
+	PoolLookup     types.PoolLookup
+}
+
+func (o SpotOracle) LovelacePrice(ctx context.Context, asset shared.AssetID) (*big.Rat, error) {
+	if IsAda(asset) {
+		return big.NewRat(1, 1), nil
+	}
+	poolIdent, ok := o.ReferencePools[asset]
+	if !ok {
+		return nil, fmt.Errorf("no reference pool for %v: %w", asset, ErrNoPrice)
+	}
+	pool, err := o.PoolLookup.PoolByIdent(ctx, poolIdent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup reference pool %v: %w", poolIdent, err)
+	}
+	return spotPrice(pool, asset)
+}
+
+// Prices each asset by the time-weighted average of its ADA reference pool's price over a window, such as the day being calculated;
+// this makes the price much more expensive to manipulate than the spot price in any one block
+type TWAPOracle struct {
+	ReferencePools map[shared.AssetID]string
+	History        types.PoolHistory
+	StartSlot      uint64
+	EndSlot        uint64
+}
+
+func (o TWAPOracle) LovelacePrice(ctx context.Context, asset shared.AssetID) (*big.Rat, error) {
+	if IsAda(asset) {
+		return big.NewRat(1, 1), nil
+	}
+	poolIdent, ok := o.ReferencePools[asset]
+	if !ok {
+		return nil, fmt.Errorf("no reference pool for %v: %w", asset, ErrNoPrice)
+	}
+	states, err := o.History.PoolStates(ctx, poolIdent, o.StartSlot, o.EndSlot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup history for reference pool %v: %w", poolIdent, err)
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no history for reference pool %v: %w", poolIdent, ErrNoPrice)
+	}
+
+	// Each state is in effect from its slot (or the start of the window) until the next state (or the end of the window)
+	weighted := big.NewRat(0, 1)
+	duration := uint64(0)
+	for i, state := range states {
+		from := state.Slot
+		if from < o.StartSlot {
+			from = o.StartSlot
+		}
+		to := o.EndSlot
+		if i+1 < len(states) && states[i+1].Slot < to {
+			to = states[i+1].Slot
+		}
+		if to <= from {
+			continue
+		}
+		price, err := spotPrice(state, asset)
+		if errors.Is(err, ErrNoPrice) {
+			// The pool was empty for this stretch, so it can't tell us anything
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		weighted = weighted.Add(weighted, price.Mul(price, big.NewRat(int64(to-from), 1)))
+		duration += to - from
+	}
+	if duration == 0 {
+		// The window is empty, so the best we can do is the latest price
+		return spotPrice(states[len(states)-1], asset)
+	}
+	return weighted.Quo(weighted, big.NewRat(int64(duration), 1)), nil
+}
+
+// Prices each asset by the median spot price across several of its ADA pools, so no single pool can move the price
+type MedianOracle struct {
+	Pools      map[shared.AssetID][]string
+	PoolLookup types.PoolLookup
+}
+
+func (o MedianOracle) LovelacePrice(ctx context.Context, asset shared.AssetID) (*big.Rat, error) {
+	if IsAda(asset) {
+		return big.NewRat(1, 1), nil
+	}
+	var prices []*big.Rat
+	for _, poolIdent := range o.Pools[asset] {
+		pool, err := o.PoolLookup.PoolByIdent(ctx, poolIdent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup reference pool %v: %w", poolIdent, err)
+		}
+		price, err := spotPrice(pool, asset)
+		if errors.Is(err, ErrNoPrice) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no reference pools for %v: %w", asset, ErrNoPrice)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+	mid := len(prices) / 2
+	if len(prices)%2 == 1 {
+		return prices[mid], nil
+	}
+	median := big.NewRat(0, 1).Add(prices[mid-1], prices[mid])
+	return median.Quo(median, big.NewRat(2, 1)), nil
+}
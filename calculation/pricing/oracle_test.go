@@ -0,0 +1,101 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/tj/assert"
+)
+
+func Test_SpotOracle(t *testing.T) {
+	oracle := SpotOracle{
+		ReferencePools: map[shared.AssetID]string{"X": "01", "Y": "02"},
+		PoolLookup: utilities.MockLookup{
+			"01": {PoolIdent: "01", AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+			"02": {PoolIdent: "02", AssetA: "X", AssetB: "Y", AssetAQuantity: 1000, AssetBQuantity: 2000},
+		},
+	}
+	price, err := oracle.LovelacePrice(context.Background(), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(1, 2), price)
+
+	price, err = oracle.LovelacePrice(context.Background(), shared.AdaAssetID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(1, 1), price)
+
+	value, err := LovelaceValue(context.Background(), oracle, big.NewInt(1001), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 500, value.Int64())
+
+	_, err = oracle.LovelacePrice(context.Background(), "Z")
+	assert.True(t, errors.Is(err, ErrNoPrice))
+
+	// A misconfigured reference pool is an error, not a missing price
+	_, err = oracle.LovelacePrice(context.Background(), "Y")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrNoPrice))
+}
+
+func Test_TWAPOracle(t *testing.T) {
+	history := utilities.MockPoolHistory{
+		"01": {
+			{PoolIdent: "01", Slot: 0, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+			// Someone pumps the price for a quarter of the day
+			{PoolIdent: "01", Slot: 50, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 3000, AssetBQuantity: 1000},
+			{PoolIdent: "01", Slot: 75, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		},
+	}
+	oracle := TWAPOracle{
+		ReferencePools: map[shared.AssetID]string{"X": "01"},
+		History:        history,
+		StartSlot:      0,
+		EndSlot:        100,
+	}
+	price, err := oracle.LovelacePrice(context.Background(), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(3, 2), price)
+
+	// The state from before the window starts is in effect until the next change
+	oracle.StartSlot = 60
+	price, err = oracle.LovelacePrice(context.Background(), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(7, 4), price)
+
+	// An empty window uses the latest price
+	oracle.StartSlot = 100
+	price, err = oracle.LovelacePrice(context.Background(), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(1, 1), price)
+
+	_, err = oracle.LovelacePrice(context.Background(), "Y")
+	assert.True(t, errors.Is(err, ErrNoPrice))
+}
+
+func Test_MedianOracle(t *testing.T) {
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"02": {PoolIdent: "02", AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 2000, AssetBQuantity: 1000},
+		"03": {PoolIdent: "03", AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 100_000, AssetBQuantity: 1000},
+		"04": {PoolIdent: "04", AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 0, AssetBQuantity: 0},
+	}
+	oracle := MedianOracle{
+		Pools:      map[shared.AssetID][]string{"X": {"03", "01", "02", "04"}},
+		PoolLookup: pools,
+	}
+	price, err := oracle.LovelacePrice(context.Background(), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(2, 1), price)
+
+	oracle.Pools["X"] = []string{"01", "02"}
+	price, err = oracle.LovelacePrice(context.Background(), "X")
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewRat(3, 2), price)
+
+	oracle.Pools["X"] = []string{"04"}
+	_, err = oracle.LovelacePrice(context.Background(), "X")
+	assert.True(t, errors.Is(err, ErrNoPrice))
+}
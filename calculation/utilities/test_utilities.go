@@ -3,6 +3,7 @@ package utilities
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
@@ -11,6 +12,9 @@ import (
 	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
 )
 
+// The asset the sample programs emit; a real policy and asset name, since earnings are committed to the same way as on-chain
+const EmittedAsset = shared.AssetID("99b071ce8580d6a3a11b4902145adb8bfd0d2a03935af8cf66403e15.53554e444145")
+
 func SampleYieldProgram(emissions uint64) types.YieldProgram {
 	return types.YieldProgram{
 		ID:                  "TestYield",
@@ -18,7 +22,7 @@ func SampleYieldProgram(emissions uint64) types.YieldProgram {
 		LastDailyRewards:    "2099-01-01", // If this code is still in use in 2099, call the police (after updating tests)
 		StakedAsset:         shared.AssetID("Staked"),
 		MinLPIntegerPercent: 1,
-		EmittedAsset:        shared.AssetID("Emitted"),
+		EmittedAsset:        EmittedAsset,
 		DailyEmission:       emissions,
 	}
 }
@@ -29,7 +33,7 @@ func SampleIncentiveProgram() types.IncentiveProgram {
 		FirstDailyRewards:    "2001-01-01",
 		LastDailyRewards:     "2099-01-01",
 		StakedAsset:          shared.AssetID("Staked"),
-		EmittedAsset:         shared.AssetID("Emitted"),
+		EmittedAsset:         EmittedAsset,
 		StakedReferencePool:  "X",
 		EmittedReferencePool: "Y",
 	}
@@ -99,3 +103,37 @@ func (m MockLookup) LPTokenToPoolIdent(lpToken shared.AssetID) (string, error) {
 		return pool.PoolIdent, nil
 	}
 }
+func (m MockLookup) AllPools(ctx context.Context) ([]types.Pool, error) {
+	var pools []types.Pool
+	for _, pool := range m {
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// Replays a recorded sequence of states for each pool
+type MockPoolHistory map[string][]types.Pool
+
+func (m MockPoolHistory) PoolStates(ctx context.Context, poolIdent string, startSlot, endSlot uint64) ([]types.Pool, error) {
+	recorded, ok := m[poolIdent]
+	if !ok {
+		return nil, fmt.Errorf("pool not found")
+	}
+	sorted := make([]types.Pool, len(recorded))
+	copy(sorted, recorded)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Slot < sorted[j].Slot
+	})
+	var states []types.Pool
+	for _, state := range sorted {
+		if state.Slot > endSlot {
+			break
+		}
+		// Only keep the latest state from before the window starts
+		if state.Slot <= startSlot && len(states) > 0 && states[len(states)-1].Slot <= startSlot {
+			states = states[:len(states)-1]
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
@@ -2,14 +2,17 @@ package yield
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/pricing"
 	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
 )
 
@@ -19,7 +22,9 @@ func CalculateTotalDelegations(
 	program types.YieldProgram,
 	positions []types.Position,
 	poolLookup types.PoolLookup,
+	opts ...Option,
 ) (map[string]uint64, uint64, error) {
+	o := applyOptions(opts)
 	totalDelegationsByPoolIdent := map[string]uint64{}
 	if program.StakedAsset == "" {
 		for _, pool := range program.EligiblePools {
@@ -28,236 +33,558 @@ func CalculateTotalDelegations(
 		return totalDelegationsByPoolIdent, uint64(len(program.EligiblePools)), nil
 	}
 
-	for _, position := range positions {
-		totalDelegationAsset := shared.Value(position.Value).AssetAmount(program.StakedAsset)
+	shards := make([]map[string]uint64, o.shardCount(len(positions)))
+	err := runSharded(len(positions), len(shards), func(shard, start, end int) error {
+		shards[shard] = map[string]uint64{}
+		for _, position := range positions[start:end] {
+			if err := delegatePosition(ctx, program, position, poolLookup, o, shards[shard]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, shard := range shards {
+		for poolIdent, amount := range shard {
+			totalDelegationsByPoolIdent[poolIdent] += amount
+		}
+	}
 
-		// Add in the value of LP tokens, according to the ratio of the pools at the snapshot
+	totalDelegations := uint64(0)
+	for _, amt := range totalDelegationsByPoolIdent {
+		totalDelegations += amt
+	}
 
-		for policy, policyMap := range position.Value {
-			for assetName, amount := range policyMap {
+	return totalDelegationsByPoolIdent, totalDelegations, nil
+}
+
+// Add the delegation of a single position to the totals for each pool
+func delegatePosition(
+	ctx context.Context,
+	program types.YieldProgram,
+	position types.Position,
+	poolLookup types.PoolLookup,
+	o calculationOptions,
+	totals map[string]uint64,
+) error {
+	totalDelegationAsset := shared.Value(position.Value).AssetAmount(program.StakedAsset)
 
-				assetId := shared.FromSeparate(policy, assetName)
+	// Add in the value of LP tokens, according to the ratio of the pools at the snapshot
 
-				if poolLookup.IsLPToken(assetId) {
-					pool, err := poolLookup.PoolByLPToken(ctx, assetId)
-					if err != nil {
-						return nil, 0, fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
-					}
-					if pool.TotalLPTokens == 0 {
-						// The pool has since been deleted.
-						// So, as a corner case, we just skip this LP asset
-						continue
-					}
-					if pool.AssetA == program.StakedAsset || pool.AssetB == program.StakedAsset {
-						frac := big.NewInt(amount.Int64())
-						if pool.AssetA == program.StakedAsset {
-							frac = frac.Mul(frac, big.NewInt(int64(pool.AssetAQuantity)))
-						} else if pool.AssetB == program.StakedAsset {
-							frac = frac.Mul(frac, big.NewInt(int64(pool.AssetBQuantity)))
-						}
-						frac = frac.Div(frac, big.NewInt(int64(pool.TotalLPTokens)))
-						totalDelegationAsset = totalDelegationAsset.Add(num.Int(*frac))
+	for policy, policyMap := range position.Value {
+		for assetName, amount := range policyMap {
+
+			assetId := shared.FromSeparate(policy, assetName)
+
+			if poolLookup.IsLPToken(assetId) {
+				pool, err := poolLookup.PoolByLPToken(ctx, assetId)
+				if err != nil {
+					return fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
+				}
+				if pool.TotalLPTokens == 0 {
+					// The pool has since been deleted.
+					// So, as a corner case, we just skip this LP asset
+					o.warn(types.Warning{
+						Code:      types.WarningDeletedPoolLP,
+						PoolIdent: pool.PoolIdent,
+						OwnerID:   position.OwnerID,
+						Message:   fmt.Sprintf("skipped %v of LP token %v for a deleted pool", amount.Uint64(), assetId),
+					})
+					continue
+				}
+				if pool.AssetA == program.StakedAsset || pool.AssetB == program.StakedAsset {
+					frac := big.NewInt(amount.Int64())
+					if pool.AssetA == program.StakedAsset {
+						frac = frac.Mul(frac, big.NewInt(int64(pool.AssetAQuantity)))
+					} else if pool.AssetB == program.StakedAsset {
+						frac = frac.Mul(frac, big.NewInt(int64(pool.AssetBQuantity)))
 					}
+					frac = frac.Div(frac, big.NewInt(int64(pool.TotalLPTokens)))
+					totalDelegationAsset = totalDelegationAsset.Add(num.Int(*frac))
 				}
 			}
 		}
+	}
 
-		// Each UTXO of locked SUNDAE may encode a weighting for a set of pools, as described above;
-		totalWeight := uint64(0)
-		for _, w := range position.Delegation {
-			// Skip delegations for other programs
-			if w.Program != program.ID {
-				continue
-			}
-			totalWeight += uint64(w.Weight)
+	// Each UTXO of locked SUNDAE may encode a weighting for a set of pools, as described above;
+	totalWeight := uint64(0)
+	for _, w := range position.Delegation {
+		// Skip delegations for other programs
+		if w.Program != program.ID {
+			continue
 		}
-		// The absence of such a list will exclude all SUNDAE at that UTXO from consideration.
-		if totalWeight == 0 {
-			totalDelegationsByPoolIdent[""] += uint64(totalDelegationAsset.Int64())
+		totalWeight += uint64(w.Weight)
+	}
+	// The absence of such a list will exclude all SUNDAE at that UTXO from consideration.
+	if totalWeight == 0 {
+		totals[""] += uint64(totalDelegationAsset.Int64())
+		return nil
+	}
+
+	// ... then divide the SUNDAE at the UTXO among the selected options in accordance to the weight
+	delegatedAssetAmount := uint64(0)
+	for _, delegation := range position.Delegation {
+		// Skip delegations for other programs
+		if delegation.Program != program.ID {
 			continue
 		}
+		// rounding down
+		frac := big.NewInt(totalDelegationAsset.Int64())
+		frac = frac.Mul(frac, big.NewInt(int64(delegation.Weight)))
+		frac = frac.Div(frac, num.Uint64(totalWeight).BigInt())
+		allocation := frac.Uint64()
+		delegatedAssetAmount += allocation
+
+		// Some programs may map delegation to one pool (such as a v1 pool) to another (such as a corresponding v3 pool)
+		poolIdent := delegation.PoolIdent
+		if remappedTo, ok := program.DelegationRemap[poolIdent]; ok {
+			poolIdent = remappedTo
+		}
+
+		totals[poolIdent] += allocation
+	}
 
-		// ... then divide the SUNDAE at the UTXO among the selected options in accordance to the weight
-		delegatedAssetAmount := uint64(0)
-		for _, delegation := range position.Delegation {
-			// Skip delegations for other programs
-			if delegation.Program != program.ID {
+	// ... and distributing millionths of a SUNDAE among the options in order until the total SUNDAE allocated equals the SUNDAE held at the UTXO.
+	// Note: this is guaranteed to be small because of high precision arithmetic above
+	remainder := int(totalDelegationAsset.Uint64() - delegatedAssetAmount)
+	if remainder < 0 {
+		panic(fmt.Sprintf("allocated more asset (%v) to a pool than in the stake position (%v), somehow", delegatedAssetAmount, totalDelegationAsset))
+	} else if remainder > 0 {
+		for i := 0; remainder > 0; i++ {
+			idx := i % len(position.Delegation)
+			// Skip over delegations for other programs
+			if position.Delegation[idx].Program != program.ID {
 				continue
 			}
-			// rounding down
-			frac := big.NewInt(totalDelegationAsset.Int64())
-			frac = frac.Mul(frac, big.NewInt(int64(delegation.Weight)))
-			frac = frac.Div(frac, num.Uint64(totalWeight).BigInt())
-			allocation := frac.Uint64()
-			delegatedAssetAmount += allocation
+			delegation := position.Delegation[idx]
 
-			// Some programs may map delegation to one pool (such as a v1 pool) to another (such as a corresponding v3 pool)
 			poolIdent := delegation.PoolIdent
 			if remappedTo, ok := program.DelegationRemap[poolIdent]; ok {
 				poolIdent = remappedTo
 			}
 
-			totalDelegationsByPoolIdent[poolIdent] += allocation
+			totals[poolIdent] += 1
+			delegatedAssetAmount += 1
+			remainder -= 1
 		}
+	}
+	if totalDelegationAsset.Uint64() != delegatedAssetAmount {
+		// There's a bug in the round-robin distribution code, panic so we fix the bug
+		panic("round-robin distribution wasn't succesful")
+	}
+	return nil
+}
 
-		// ... and distributing millionths of a SUNDAE among the options in order until the total SUNDAE allocated equals the SUNDAE held at the UTXO.
-		// Note: this is guaranteed to be small because of high precision arithmetic above
-		remainder := int(totalDelegationAsset.Uint64() - delegatedAssetAmount)
-		if remainder < 0 {
-			panic(fmt.Sprintf("allocated more asset (%v) to a pool than in the stake position (%v), somehow", delegatedAssetAmount, totalDelegationAsset))
-		} else if remainder > 0 {
-			for i := 0; remainder > 0; i++ {
-				idx := i % len(position.Delegation)
-				// Skip over delegations for other programs
-				if position.Delegation[idx].Program != program.ID {
-					continue
-				}
-				delegation := position.Delegation[idx]
+// Calculate the locked LP, total LP, estimated lovelace value per pool and globally, as of the final snapshot
+func CalculateTotalLPAtSnapshot(
+	ctx context.Context,
+	maxSlot uint64,
+	positions []types.Position,
+	referencePools map[shared.AssetID]string,
+	poolLookup types.PoolLookup,
+) (map[string]uint64, map[string]uint64, map[string]uint64, uint64, error) {
+	snapshot, err := CalculateLPSnapshot(ctx, maxSlot, positions, referencePools, poolLookup)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	return snapshot.LockedLPByPool, snapshot.TotalLPByPool, snapshot.EstimatedLovelaceByPool, snapshot.EstimatedLovelace, nil
+}
 
-				poolIdent := delegation.PoolIdent
-				if remappedTo, ok := program.DelegationRemap[poolIdent]; ok {
-					poolIdent = remappedTo
-				}
+// The locked LP, total LP, and estimated lovelace value per pool and globally, as of the final snapshot
+type LPSnapshot struct {
+	LockedLPByPool          map[string]uint64
+	TotalLPByPool           map[string]uint64
+	EstimatedLovelaceByPool map[string]uint64
+	EstimatedLovelace       uint64
 
-				totalDelegationsByPoolIdent[poolIdent] += 1
-				delegatedAssetAmount += 1
-				remainder -= 1
+	// The route used to price each pool's LP in lovelace
+	PricingRouteByPool map[string]string
+}
+
+func activeAtSnapshot(position types.Position, maxSlot uint64) bool {
+	return position.SpentTransaction == "" || (position.Slot < maxSlot && position.SpentSlot >= maxSlot)
+}
+
+// Value the LP tokens held by a position at the per-pool prices from a days calculation,
+// by dividing each pools estimated locked value among the LP tokens locked for it
+func EstimatePositionLovelaceByPool(ctx context.Context, position types.Position, outputs CalculationOutputs, poolLookup types.PoolLookup) (map[string]uint64, error) {
+	valueByPool := map[string]uint64{}
+	for policy, policyMap := range position.Value {
+		for assetName, amount := range policyMap {
+			assetId := shared.FromSeparate(policy, assetName)
+			if !poolLookup.IsLPToken(assetId) {
+				continue
 			}
-		}
-		if totalDelegationAsset.Uint64() != delegatedAssetAmount {
-			// There's a bug in the round-robin distribution code, panic so we fix the bug
-			panic("round-robin distribution wasn't succesful")
+			pool, err := poolLookup.PoolByLPToken(ctx, assetId)
+			if err != nil {
+				return nil, fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
+			}
+			lockedLP := outputs.LockedLPByPool[pool.PoolIdent]
+			if lockedLP == 0 {
+				continue
+			}
+			value := big.NewInt(0).Mul(amount.BigInt(), big.NewInt(0).SetUint64(outputs.EstimatedLockedLovelaceByPool[pool.PoolIdent]))
+			valueByPool[pool.PoolIdent] += value.Div(value, big.NewInt(0).SetUint64(lockedLP)).Uint64()
 		}
 	}
+	return valueByPool, nil
+}
 
-	totalDelegations := uint64(0)
-	for _, amt := range totalDelegationsByPoolIdent {
-		totalDelegations += amt
-	}
+// The pricing graph over every pool in the snapshot, built the first time some LP has to be priced through other pools
+// and shared by every accumulator of the same snapshot; if the pool lookup can't list every pool, there's no graph, and
+// the LP is priced once the pools with LP locked are known instead
+type snapshotGraph struct {
+	ctx        context.Context
+	poolLookup types.PoolLookup
 
-	return totalDelegationsByPoolIdent, totalDelegations, nil
+	once  sync.Once
+	graph *pricing.Graph
+	err   error
 }
 
-// Calculate the locked LP, total LP, estimated lovelace value per pool and globally, as of the final snapshot
-func CalculateTotalLPAtSnapshot(
+func newSnapshotGraph(ctx context.Context, poolLookup types.PoolLookup) *snapshotGraph {
+	return &snapshotGraph{ctx: ctx, poolLookup: poolLookup}
+}
+
+func (g *snapshotGraph) get() (*pricing.Graph, error) {
+	g.once.Do(func() {
+		snapshot, ok := g.poolLookup.(types.PoolSnapshot)
+		if !ok {
+			return
+		}
+		pools, err := snapshot.AllPools(g.ctx)
+		if err == nil {
+			g.graph = pricing.NewGraph(pools)
+		} else if !errors.Is(err, types.ErrSnapshotUnsupported) {
+			g.err = fmt.Errorf("failed to build pricing graph: failed to list pools: %w", err)
+		}
+	})
+	return g.graph, g.err
+}
+
+// Build a graph for pricing assets through intermediate pools, when the pool lookup can't list every pool;
+// we make do with the pools that have LP locked, and the reference pools
+func buildPricingGraph(
 	ctx context.Context,
-	maxSlot uint64,
-	positions []types.Position,
+	lockedPools map[string]types.Pool,
 	referencePools map[shared.AssetID]string,
 	poolLookup types.PoolLookup,
-) (map[string]uint64, map[string]uint64, map[string]uint64, uint64, error) {
-	poolsByIdent := map[string]types.Pool{}
-	lockedLPByIdent := map[string]uint64{}
-	valueByIdent := map[string]uint64{}
-	totalValue := uint64(0)
-	for _, position := range positions {
-		// The values calculated by this method are only used for reporting purposes
-		// and for the 1% pool filter; So, we interpret the spec to be
-		// "only pools with 1% of the LP tokens locked at the snapshot are eligible"
-		// (as opposed to integrated over the day)
-		// This also avoids a subtle corner case where the pool can be deleted by the snapshot,
-		// but still have a position earlier in the day with locked LP, which would cause a divide by zero below
-		activeAtSnapshot := position.SpentTransaction == "" || (position.Slot < maxSlot && position.SpentSlot >= maxSlot)
-		if !activeAtSnapshot {
+) (*pricing.Graph, error) {
+	var pools []types.Pool
+	for _, pool := range lockedPools {
+		pools = append(pools, pool)
+	}
+	for _, poolIdent := range referencePools {
+		if _, ok := lockedPools[poolIdent]; ok {
 			continue
 		}
+		pool, err := poolLookup.PoolByIdent(ctx, poolIdent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup reference pool %v: %w", poolIdent, err)
+		}
+		pools = append(pools, pool)
+	}
+	return pricing.NewGraph(pools), nil
+}
+
+// Totals up the LP locked at the snapshot one position at a time, in memory that grows with the number of pools rather
+// than positions. LP that can only be priced through other pools is valued as it arrives, through the graph of every
+// pool; if the lookup can't list every pool, that LP is summed by pool instead, and valued through the pools with LP
+// locked once the snapshot is finished
+type lpAccumulator struct {
+	ctx            context.Context
+	maxSlot        uint64
+	referencePools map[shared.AssetID]string
+	poolLookup     types.PoolLookup
+	graph          *snapshotGraph
+	o              calculationOptions
+
+	poolsByIdent    map[string]types.Pool
+	lockedLPByIdent map[string]uint64
+	valueByIdent    map[string]uint64
+	routeByIdent    map[string]string
+	totalValue      uint64
+	// The LP locked for each pool that has to be priced through other pools, while there's no graph to price it with
+	unpricedByIdent map[string]*big.Int
+}
+
+func newLPAccumulator(
+	ctx context.Context,
+	maxSlot uint64,
+	referencePools map[shared.AssetID]string,
+	poolLookup types.PoolLookup,
+	graph *snapshotGraph,
+	o calculationOptions,
+) *lpAccumulator {
+	return &lpAccumulator{
+		ctx:             ctx,
+		maxSlot:         maxSlot,
+		referencePools:  referencePools,
+		poolLookup:      poolLookup,
+		graph:           graph,
+		o:               o,
+		poolsByIdent:    map[string]types.Pool{},
+		lockedLPByIdent: map[string]uint64{},
+		valueByIdent:    map[string]uint64{},
+		routeByIdent:    map[string]string{},
+		unpricedByIdent: map[string]*big.Int{},
+	}
+}
 
-		for policy, policyMap := range position.Value {
+// The amount of each asset that some LP tokens are worth, counting both halves of the pair
+func lpQuantities(lockedLP *big.Int, pool types.Pool) (*big.Int, *big.Int) {
+	totalLP := num.Uint64(pool.TotalLPTokens).BigInt()
+	quantityAssetA := big.NewInt(0).Div(
+		big.NewInt(0).Mul(
+			big.NewInt(2),
+			big.NewInt(0).Mul(
+				lockedLP,
+				big.NewInt(0).SetUint64(pool.AssetAQuantity),
+			),
+		),
+		totalLP,
+	)
+	quantityAssetB := big.NewInt(0).Div(
+		big.NewInt(0).Mul(
+			big.NewInt(2),
+			big.NewInt(0).Mul(
+				lockedLP,
+				big.NewInt(0).SetUint64(pool.AssetBQuantity),
+			),
+		),
+		totalLP,
+	)
+	return quantityAssetA, quantityAssetB
+}
 
-			for assetName, amount := range policyMap {
-				assetId := shared.FromSeparate(policy, assetName)
+func (a *lpAccumulator) add(position types.Position) error {
+	ctx, poolLookup, referencePools, o := a.ctx, a.poolLookup, a.referencePools, a.o
+	// The values calculated by this method are only used for reporting purposes
+	// and for the 1% pool filter; So, we interpret the spec to be
+	// "only pools with 1% of the LP tokens locked at the snapshot are eligible"
+	// (as opposed to integrated over the day)
+	// This also avoids a subtle corner case where the pool can be deleted by the snapshot,
+	// but still have a position earlier in the day with locked LP, which would cause a divide by zero below
+	if !activeAtSnapshot(position, a.maxSlot) {
+		return nil
+	}
 
-				if poolLookup.IsLPToken(assetId) {
+	for policy, policyMap := range position.Value {
 
-					pool, err := poolLookup.PoolByLPToken(ctx, assetId)
-					if err != nil {
-						return nil, nil, nil, 0, fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
-					}
+		for assetName, amount := range policyMap {
+			assetId := shared.FromSeparate(policy, assetName)
 
-					poolsByIdent[pool.PoolIdent] = pool
-					lockedLPByIdent[pool.PoolIdent] += amount.Uint64()
-
-					lockedLP := amount.BigInt()
-					totalLP := num.Uint64(pool.TotalLPTokens).BigInt()
-					lovelaceValue := big.NewInt(0)
-
-					quantityAssetA := big.NewInt(0).Div(
-						big.NewInt(0).Mul(
-							big.NewInt(2),
-							big.NewInt(0).Mul(
-								lockedLP,
-								big.NewInt(0).SetUint64(pool.AssetAQuantity),
-							),
-						),
-						totalLP,
-					)
-					quantityAssetB := big.NewInt(0).Div(
-						big.NewInt(0).Mul(
-							big.NewInt(2),
-							big.NewInt(0).Mul(
-								lockedLP,
-								big.NewInt(0).SetUint64(pool.AssetBQuantity),
-							),
-						),
-						totalLP,
-					)
-					// Now, we want to estimate the value of these LP tokens
-					// If it's an ADA/X pool, we can just estimate based on the ADA
-					if pool.AssetA == "" || pool.AssetA == "." || pool.AssetA == shared.AdaAssetID {
-						// We can use the quantityA as ada directly
-						lovelaceValue = quantityAssetA
-					} else if referencePools[pool.AssetA] != "" || referencePools[pool.AssetB] != "" {
-						refPoolIdent := referencePools[pool.AssetA]
-						if refPoolIdent == "" {
-							refPoolIdent = referencePools[pool.AssetB]
-						}
-						// Otherwise, we know how much equivalent assetA or assetB we have, so we can translate that into ADA through a reference pool
-						// Lookup the appropriate reference pool
-						referencePool, err := poolLookup.PoolByIdent(ctx, refPoolIdent)
-						if err != nil {
-							return nil, nil, nil, 0, fmt.Errorf("failed to lookup reference pool %v: %w", referencePools[pool.AssetA], err)
-						}
-						// Make sure it's an ADA/X pool
-						if referencePool.AssetA != "" && referencePool.AssetA != "." && referencePool.AssetA != shared.AdaAssetID {
-							return nil, nil, nil, 0, fmt.Errorf("reference pool %v doesn't have ADA as assetA", referencePools[pool.AssetA])
-						}
-
-						var relevantQuantity *big.Int
-
-						// If the other half of the pair is pool assetA, then we convert our A quantity to lovelace equivalent
-						// otherwise we convert our B quantity to lovelace equivalent
-						if referencePool.AssetB == pool.AssetA {
-							relevantQuantity = quantityAssetA
-						} else if referencePool.AssetB == pool.AssetB {
-							relevantQuantity = quantityAssetB
-						} else {
-							// The reference pool is misconfigured, because it doesn't actually refer to an ADA/X pool for one of the items of the pair
-							return nil, nil, nil, 0, fmt.Errorf("reference pool %v doesn't have either asset as assetB", referencePools[pool.AssetA])
-						}
-						// Now, we can take the quantity of that token, multiply it by the lovelace amount, and then divide out by assetB to convert
-						// units into lovelace
-						lovelaceValue = big.NewInt(0).Div(
-							big.NewInt(0).Mul(
-								relevantQuantity,
-								big.NewInt(0).SetUint64(referencePool.AssetAQuantity),
-							),
-							big.NewInt(0).SetUint64(referencePool.AssetBQuantity),
-						)
-					} else {
-						fmt.Printf("WARNING: missing reference pool for %v\n", pool.PoolIdent)
+			if !poolLookup.IsLPToken(assetId) {
+				continue
+			}
+
+			pool, err := poolLookup.PoolByLPToken(ctx, assetId)
+			if err != nil {
+				return fmt.Errorf("failed to lookup pool for LP token %v: %w", assetId, err)
+			}
+
+			a.poolsByIdent[pool.PoolIdent] = pool
+			a.lockedLPByIdent[pool.PoolIdent] += amount.Uint64()
+
+			lockedLP := amount.BigInt()
+			lovelaceValue := big.NewInt(0)
+			quantityAssetA, quantityAssetB := lpQuantities(lockedLP, pool)
+			// Now, we want to estimate the value of these LP tokens
+			// If it's an ADA/X pool, we can just estimate based on the ADA
+			if pricing.IsAda(pool.AssetA) {
+				// We can use the quantityA as ada directly
+				lovelaceValue = quantityAssetA
+				a.routeByIdent[pool.PoolIdent] = string(shared.AdaAssetID)
+			} else if pricing.IsAda(pool.AssetB) {
+				// Likewise if ADA is the other half of the pair
+				lovelaceValue = quantityAssetB
+				a.routeByIdent[pool.PoolIdent] = string(shared.AdaAssetID)
+			} else if o.priceOracle != nil {
+				// If we've been given an oracle, it's the only source of prices we trust, so price whichever half of the pair it can
+				lovelaceValue, err = pricing.LovelaceValue(ctx, o.priceOracle, quantityAssetA, pool.AssetA)
+				if errors.Is(err, pricing.ErrNoPrice) {
+					lovelaceValue, err = pricing.LovelaceValue(ctx, o.priceOracle, quantityAssetB, pool.AssetB)
+					if err == nil {
+						a.routeByIdent[pool.PoolIdent] = fmt.Sprintf("%v -[oracle]-> %v", pool.AssetB, shared.AdaAssetID)
 					}
+				} else if err == nil {
+					a.routeByIdent[pool.PoolIdent] = fmt.Sprintf("%v -[oracle]-> %v", pool.AssetA, shared.AdaAssetID)
+				}
+				if errors.Is(err, pricing.ErrNoPrice) {
+					o.warn(types.Warning{
+						Code:      types.WarningMissingPrice,
+						PoolIdent: pool.PoolIdent,
+						Message:   fmt.Sprintf("the price oracle couldn't price %v or %v, so the LP is valued at 0", pool.AssetA, pool.AssetB),
+					})
+				} else if err != nil {
+					return fmt.Errorf("failed to price pool %v: %w", pool.PoolIdent, err)
+				}
+			} else if referencePools[pool.AssetA] != "" || referencePools[pool.AssetB] != "" {
+				refPoolIdent := referencePools[pool.AssetA]
+				if refPoolIdent == "" {
+					refPoolIdent = referencePools[pool.AssetB]
+				}
+				// Otherwise, we know how much equivalent assetA or assetB we have, so we can translate that into ADA through a reference pool
+				// Lookup the appropriate reference pool
+				referencePool, err := poolLookup.PoolByIdent(ctx, refPoolIdent)
+				if err != nil {
+					return fmt.Errorf("failed to lookup reference pool %v: %w", referencePools[pool.AssetA], err)
+				}
+				// Make sure it's an ADA/X pool
+				if !pricing.IsAda(referencePool.AssetA) {
+					return fmt.Errorf("reference pool %v doesn't have ADA as assetA", referencePools[pool.AssetA])
+				}
 
-					totalValue += lovelaceValue.Uint64()
-					valueByIdent[pool.PoolIdent] += lovelaceValue.Uint64()
+				var relevantQuantity *big.Int
+
+				// If the other half of the pair is pool assetA, then we convert our A quantity to lovelace equivalent
+				// otherwise we convert our B quantity to lovelace equivalent
+				if referencePool.AssetB == pool.AssetA {
+					relevantQuantity = quantityAssetA
+				} else if referencePool.AssetB == pool.AssetB {
+					relevantQuantity = quantityAssetB
+				} else {
+					// The reference pool is misconfigured, because it doesn't actually refer to an ADA/X pool for one of the items of the pair
+					return fmt.Errorf("reference pool %v doesn't have either asset as assetB", referencePools[pool.AssetA])
+				}
+				// Now, we can take the quantity of that token, multiply it by the lovelace amount, and then divide out by assetB to convert
+				// units into lovelace
+				lovelaceValue = big.NewInt(0).Div(
+					big.NewInt(0).Mul(
+						relevantQuantity,
+						big.NewInt(0).SetUint64(referencePool.AssetAQuantity),
+					),
+					big.NewInt(0).SetUint64(referencePool.AssetBQuantity),
+				)
+				a.routeByIdent[pool.PoolIdent] = fmt.Sprintf("%v -[%v]-> %v", referencePool.AssetB, refPoolIdent, shared.AdaAssetID)
+			} else {
+				// Otherwise, we'll have to find a path to ADA through some intermediate pools
+				graph, err := a.graph.get()
+				if err != nil {
+					return err
+				}
+				if graph != nil {
+					lovelaceValue = a.valueThroughGraph(graph, pool, lockedLP)
+				} else {
+					// Without every pool to route through, we have to wait until we know every pool with LP locked
+					if _, ok := a.unpricedByIdent[pool.PoolIdent]; !ok {
+						a.unpricedByIdent[pool.PoolIdent] = big.NewInt(0)
+					}
+					a.unpricedByIdent[pool.PoolIdent].Add(a.unpricedByIdent[pool.PoolIdent], lockedLP)
 				}
 			}
+
+			a.totalValue += lovelaceValue.Uint64()
+			a.valueByIdent[pool.PoolIdent] += lovelaceValue.Uint64()
 		}
 	}
+	return nil
+}
+
+// Add the totals from another accumulator, such as one for a later shard of the positions
+func (a *lpAccumulator) merge(other *lpAccumulator) {
+	for poolIdent, pool := range other.poolsByIdent {
+		a.poolsByIdent[poolIdent] = pool
+	}
+	for poolIdent, locked := range other.lockedLPByIdent {
+		a.lockedLPByIdent[poolIdent] += locked
+	}
+	for poolIdent, value := range other.valueByIdent {
+		a.valueByIdent[poolIdent] += value
+	}
+	// Each pool is always priced by the same route
+	for poolIdent, route := range other.routeByIdent {
+		a.routeByIdent[poolIdent] = route
+	}
+	for poolIdent, unpriced := range other.unpricedByIdent {
+		if _, ok := a.unpricedByIdent[poolIdent]; !ok {
+			a.unpricedByIdent[poolIdent] = big.NewInt(0)
+		}
+		a.unpricedByIdent[poolIdent].Add(a.unpricedByIdent[poolIdent], unpriced)
+	}
+	a.totalValue += other.totalValue
+}
+
+// Value some LP through the pricing graph, by whichever half of the pair has the deepest route to ADA
+func (a *lpAccumulator) valueThroughGraph(graph *pricing.Graph, pool types.Pool, lockedLP *big.Int) *big.Int {
+	quantityAssetA, quantityAssetB := lpQuantities(lockedLP, pool)
+	routeA, okA := graph.Route(pool.AssetA)
+	routeB, okB := graph.Route(pool.AssetB)
+	if okA && (!okB || routeA.Depth.Cmp(routeB.Depth) >= 0) {
+		a.routeByIdent[pool.PoolIdent] = routeA.String()
+		return routeA.LovelaceValue(quantityAssetA)
+	} else if okB {
+		a.routeByIdent[pool.PoolIdent] = routeB.String()
+		return routeB.LovelaceValue(quantityAssetB)
+	}
+	a.o.warn(types.Warning{
+		Code:      types.WarningMissingPrice,
+		PoolIdent: pool.PoolIdent,
+		Message:   fmt.Sprintf("missing reference pool, and no route to price %v or %v, so the LP is valued at 0", pool.AssetA, pool.AssetB),
+	})
+	return big.NewInt(0)
+}
+
+// Value any LP that's still waiting on the pools with LP locked, and return the snapshot
+func (a *lpAccumulator) finish() (LPSnapshot, error) {
+	if len(a.unpricedByIdent) > 0 {
+		graph, err := buildPricingGraph(a.ctx, a.poolsByIdent, a.referencePools, a.poolLookup)
+		if err != nil {
+			return LPSnapshot{}, fmt.Errorf("failed to build pricing graph: %w", err)
+		}
+		for poolIdent, unpriced := range a.unpricedByIdent {
+			lovelaceValue := a.valueThroughGraph(graph, a.poolsByIdent[poolIdent], unpriced)
+			a.totalValue += lovelaceValue.Uint64()
+			a.valueByIdent[poolIdent] += lovelaceValue.Uint64()
+		}
+		a.unpricedByIdent = map[string]*big.Int{}
+	}
+
 	totalLPByIdent := map[string]uint64{}
-	for pool := range lockedLPByIdent {
-		totalLPByIdent[pool] = poolsByIdent[pool].TotalLPTokens
+	for pool := range a.lockedLPByIdent {
+		totalLPByIdent[pool] = a.poolsByIdent[pool].TotalLPTokens
 	}
-	return lockedLPByIdent, totalLPByIdent, valueByIdent, totalValue, nil
+	return LPSnapshot{
+		LockedLPByPool:          a.lockedLPByIdent,
+		TotalLPByPool:           totalLPByIdent,
+		EstimatedLovelaceByPool: a.valueByIdent,
+		EstimatedLovelace:       a.totalValue,
+		PricingRouteByPool:      a.routeByIdent,
+	}, nil
+}
+
+// Calculate the locked LP, total LP, estimated lovelace value per pool and globally, as of the final snapshot, along with how each pool was priced
+func CalculateLPSnapshot(
+	ctx context.Context,
+	maxSlot uint64,
+	positions []types.Position,
+	referencePools map[shared.AssetID]string,
+	poolLookup types.PoolLookup,
+	opts ...Option,
+) (LPSnapshot, error) {
+	o := applyOptions(opts)
+	graph := newSnapshotGraph(ctx, poolLookup)
+	shards := make([]*lpAccumulator, o.shardCount(len(positions)))
+	err := runSharded(len(positions), len(shards), func(shard, start, end int) error {
+		shards[shard] = newLPAccumulator(ctx, maxSlot, referencePools, poolLookup, graph, o)
+		for _, position := range positions[start:end] {
+			if err := shards[shard].add(position); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return LPSnapshot{}, err
+	}
+
+	snapshot := newLPAccumulator(ctx, maxSlot, referencePools, poolLookup, graph, o)
+	for _, shard := range shards {
+		snapshot.merge(shard)
+	}
+	return snapshot.finish()
 }
 
 // Check, that `portion“ is at least `percent` of `total“
@@ -414,15 +741,71 @@ func DisqualifyPools(ctx context.Context, program types.YieldProgram, lockedLPBy
 	return qualifyingDelegationsPerPool, poolDisqualificationReasons, nil
 }
 
-// Sum up the qualifying delegations over the last several days, to give each pool some "sticking" power
-func SumDelegationWindow(program types.YieldProgram, qualifyingDelegationsPerPool map[string]uint64, previousCalculations []CalculationOutputs) (map[string]uint64, error) {
+// The days of the delegation window before `date` whose outputs feed into its calculation, oldest first; that's the
+// ConsecutiveDelegationWindow-1 days immediately before it, except for days before the program started
+func DelegationWindowDates(program types.YieldProgram, date types.Date) ([]types.Date, error) {
+	day, err := time.Parse(types.DateFormat, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %v: %w", date, err)
+	}
+	var dates []types.Date
+	for i := program.ConsecutiveDelegationWindow - 1; i >= 1; i-- {
+		previousDate := day.AddDate(0, 0, -i).Format(types.DateFormat)
+		if previousDate >= program.FirstDailyRewards {
+			dates = append(dates, previousDate)
+		}
+	}
+	return dates, nil
+}
+
+// Check that the history is exactly the days of the delegation window before `date`, oldest first; that is,
+// the ConsecutiveDelegationWindow-1 days immediately before it, with no gaps, duplicates, or days from another program.
+//
+// While a program is starting up, the window only reaches back to FirstDailyRewards, so there are fewer days.
+// When backfilling, the window is relative to the day being calculated, not to today, and the history may have been
+// calculated in any order, so long as each day's outputs record the day they were for
+func ValidateDelegationWindow(program types.YieldProgram, date types.Date, previousCalculations []CalculationOutputs) error {
+	expected, err := DelegationWindowDates(program, date)
+	if err != nil {
+		return err
+	}
+
+	for i, previous := range previousCalculations {
+		if previous.ProgramID != program.ID {
+			return fmt.Errorf("history for %v includes outputs from program %q, not %q", date, previous.ProgramID, program.ID)
+		}
+		if previous.Date == "" {
+			return fmt.Errorf("history for %v includes outputs that don't record their date", date)
+		}
+		if previous.Date >= date {
+			return fmt.Errorf("history for %v includes outputs from %v, which is not before it", date, previous.Date)
+		}
+		if i > 0 && previous.Date <= previousCalculations[i-1].Date {
+			if previous.Date == previousCalculations[i-1].Date {
+				return fmt.Errorf("history for %v includes %v more than once", date, previous.Date)
+			}
+			return fmt.Errorf("history for %v is out of order; %v comes after %v", date, previous.Date, previousCalculations[i-1].Date)
+		}
+	}
+	if len(previousCalculations) > len(expected) {
+		return fmt.Errorf("too many historical snapshots; expected %v days before %v, got %v", len(expected), date, len(previousCalculations))
+	}
+	// The dates are distinct, in order, and before the day, so if the counts match and each date matches, the window is complete
+	for i, expectedDate := range expected {
+		if i >= len(previousCalculations) || previousCalculations[i].Date != expectedDate {
+			return fmt.Errorf("history for %v is missing %v", date, expectedDate)
+		}
+	}
+	return nil
+}
+
+// Sum up the qualifying delegations over the last several days, to give each pool some "sticking" power;
+// the history must be exactly the previous days of the window, as checked by ValidateDelegationWindow
+func SumDelegationWindow(program types.YieldProgram, date types.Date, qualifyingDelegationsPerPool map[string]uint64, previousCalculations []CalculationOutputs) (map[string]uint64, error) {
 	// A 3 day delegation window is today, plus two previous days
-	// but, when a program is just starting, we don't have days to base it off of so we use a <
-	if (program.ConsecutiveDelegationWindow == 0 && len(previousCalculations) != 0) ||
-		program.ConsecutiveDelegationWindow-1 < len(previousCalculations) {
-		return nil, fmt.Errorf("too many historical snapshots")
+	if err := ValidateDelegationWindow(program, date, previousCalculations); err != nil {
+		return nil, err
 	}
-	// Note: we assume the snapshots are from previous consecutive days, since checking this for correctness would be a little awkward
 
 	windowedDelegation := map[string]uint64{}
 	for _, snapshot := range previousCalculations {
@@ -440,92 +823,26 @@ func SumDelegationWindow(program types.YieldProgram, qualifyingDelegationsPerPoo
 	return windowedDelegation, nil
 }
 
-// Select the top pools according to the program criteria
+// Select the pools that receive emissions, according to the program's pool selection strategy; a strategy that needs
+// the locked lovelace for each pool can't be used without it, so use PoolSelectorForProgram directly for those
 func SelectEligiblePoolsForEmission(
 	ctx context.Context,
 	program types.YieldProgram,
 	delegationsByPool map[string]uint64,
 	poolLookup types.PoolLookup,
 ) (map[string]uint64, error) {
-	// Convert the map into a list of candidates, so we can sort them
-	type Candidate struct {
-		PoolIdent string
-		Total     uint64
+	poolSelector, err := PoolSelectorForProgram(program)
+	if err != nil {
+		return nil, err
 	}
-	var candidates []Candidate
-
-	totalDelegation := uint64(0)
-	for poolIdent, amt := range delegationsByPool {
-		if poolIdent == "" {
-			continue
-		}
-		totalDelegation += amt
-		candidates = append(candidates, Candidate{PoolIdent: poolIdent, Total: amt})
+	if _, ok := poolSelector.(MinimumLockedLovelaceSelector); ok {
+		return nil, fmt.Errorf("the %v pool selection strategy needs the locked lovelace for each pool", program.PoolSelectionStrategy)
 	}
-
-	var errs []error
-	sort.Slice(candidates, func(i, j int) bool {
-		// In the case of an exact tie (very unlikely), prefer the one with less liquidity
-		// under the hypothesis that less liquidity needs to attract more liquidity providers
-		// (technically wasn't part of the spec, and so we make a reasonable choice)
-		if candidates[i].Total == candidates[j].Total {
-			poolI, err := poolLookup.PoolByIdent(ctx, candidates[i].PoolIdent)
-			if err != nil {
-				errs = append(errs, err)
-				return false
-			}
-			poolJ, err := poolLookup.PoolByIdent(ctx, candidates[j].PoolIdent)
-			if err != nil {
-				errs = append(errs, err)
-				return false
-			}
-			iLP := poolI.TotalLPTokens
-			jLP := poolJ.TotalLPTokens
-			if iLP == jLP {
-				return candidates[i].PoolIdent < candidates[j].PoolIdent
-			}
-			return iLP < jLP
-		}
-		return candidates[i].Total > candidates[j].Total
+	poolsReceivingEmissionsByIdent, _, err := poolSelector.SelectPools(ctx, program, PoolSelectionInputs{
+		DelegationByPool: delegationsByPool,
+		PoolLookup:       poolLookup,
 	})
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("failed to sort candidates; %v errors; first error: %w", len(errs), errs[0])
-	}
-
-	poolsReceivingEmissionsByIdent := map[string]uint64{}
-	totalQualifyingDelegation := uint64(0)
-
-	// Ensure the nepotism pools (like ADA/SUNDAE) are always selected for emissions
-	for _, pool := range program.NepotismPools {
-		for _, delegation := range candidates {
-			if delegation.PoolIdent == pool {
-				poolsReceivingEmissionsByIdent[pool] = delegation.Total
-				totalQualifyingDelegation += delegation.Total
-			}
-		}
-	}
-
-	// Then select either the top N pools, or the top covering percent,
-	// whichever is fewer
-	for _, delegation := range candidates {
-		if delegation.PoolIdent == "" {
-			continue
-		}
-		// Don't re-add any nepotistic pools
-		if _, ok := poolsReceivingEmissionsByIdent[delegation.PoolIdent]; ok {
-			continue
-		}
-		poolsReceivingEmissionsByIdent[delegation.PoolIdent] = delegation.Total
-		totalQualifyingDelegation += delegation.Total
-		if len(poolsReceivingEmissionsByIdent) == program.MaxPoolCount {
-			break
-		}
-		if atLeastIntegerPercent(totalQualifyingDelegation, totalDelegation, program.MaxPoolIntegerPercent) {
-			break
-		}
-	}
-
-	return poolsReceivingEmissionsByIdent, nil
+	return poolsReceivingEmissionsByIdent, err
 }
 
 // Split the daily emissions of the program among a set of pools that have been chosen for emissions
@@ -630,51 +947,202 @@ func TruncateEmissions(program types.YieldProgram, emissionsByPool map[string]ui
 	return truncatedEmissions
 }
 
+// Redistribute any emissions above the maximum emission cap among the remaining uncapped pools, in proportion to their weight,
+// repeating until no pool is above the cap; Returns the new emissions, and whatever couldn't be redistributed, by the pool it was taken from
+func RedistributeEmissions(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, emissionsByPool map[string]uint64) (map[string]uint64, map[string]uint64) {
+	redistributedEmissions := map[string]uint64{}
+	for pool, amount := range emissionsByPool {
+		redistributedEmissions[pool] = amount
+	}
+	overflowByPool := map[string]uint64{}
+	if program.EmissionCap == 0 {
+		return redistributedEmissions, overflowByPool
+	}
+
+	type Pairs struct {
+		PoolIdent string
+		Amount    uint64
+	}
+	for {
+		// Clip every pool that's above the cap, setting aside the overflow
+		overflow := uint64(0)
+		clippedByPool := map[string]uint64{}
+		for pool, amount := range redistributedEmissions {
+			if _, ok := program.FixedEmissions[pool]; ok {
+				continue
+			}
+			if amount > program.EmissionCap {
+				clippedByPool[pool] = amount - program.EmissionCap
+				overflow += amount - program.EmissionCap
+				redistributedEmissions[pool] = program.EmissionCap
+			}
+		}
+		if overflow == 0 {
+			return redistributedEmissions, overflowByPool
+		}
+
+		// Find the pools that still have room under the cap
+		poolWeights := []Pairs{}
+		totalWeight := uint64(0)
+		for poolIdent, weight := range poolsEligibleForEmissionsByIdent {
+			if _, ok := program.FixedEmissions[poolIdent]; ok {
+				continue
+			}
+			if weight == 0 || redistributedEmissions[poolIdent] >= program.EmissionCap {
+				continue
+			}
+			totalWeight += weight
+			poolWeights = append(poolWeights, Pairs{PoolIdent: poolIdent, Amount: weight})
+		}
+
+		// If every pool is capped, there's nowhere left to put the overflow, so it reverts to the treasury
+		if totalWeight == 0 {
+			for pool, amount := range clippedByPool {
+				overflowByPool[pool] += amount
+			}
+			return redistributedEmissions, overflowByPool
+		}
+
+		// Otherwise, split it among the uncapped pools in proportion to their weight, rounding down
+		allocated := uint64(0)
+		for _, pool := range poolWeights {
+			frac := big.NewInt(0).SetUint64(overflow)
+			frac = frac.Mul(frac, big.NewInt(0).SetUint64(pool.Amount))
+			frac = frac.Div(frac, big.NewInt(0).SetUint64(totalWeight))
+			allocation := frac.Uint64()
+			redistributedEmissions[pool.PoolIdent] += allocation
+			allocated += allocation
+		}
+
+		// and distributing [diminutive tokens] among them, in the same order as DistributeEmissionsToPools, until the overflow is accounted for;
+		// if this pushes any pool over the cap, the next pass will catch it
+		sort.Slice(poolWeights, func(i, j int) bool {
+			if poolWeights[i].Amount == poolWeights[j].Amount {
+				return poolWeights[i].PoolIdent < poolWeights[j].PoolIdent
+			}
+			return poolWeights[i].Amount > poolWeights[j].Amount
+		})
+		remainder := int(overflow - allocated)
+		for i := 0; i < remainder; i++ {
+			pool := poolWeights[i%len(poolWeights)]
+			redistributedEmissions[pool.PoolIdent] += 1
+			allocated += 1
+		}
+		if allocated != overflow {
+			// There's a bug in the round-robin distribution code, panic so we fix the bug
+			panic("round-robin distribution wasn't succesful")
+		}
+	}
+}
+
+// Check that the program's cap overflow policy is one we know how to apply
+func ValidateCapOverflowPolicy(program types.YieldProgram) error {
+	switch program.CapOverflowPolicy {
+	case types.CapOverflowRedistribute, types.CapOverflowTreasury, "":
+		return nil
+	default:
+		return fmt.Errorf("unrecognized cap overflow policy %v", program.CapOverflowPolicy)
+	}
+}
+
+// Apply the maximum emission cap according to the programs overflow policy; Returns the capped emissions,
+// and the amount above the cap that reverts to the treasury, by the pool it was taken from.
+// The policy must already have been checked with ValidateCapOverflowPolicy
+func CapEmissions(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, emissionsByPool map[string]uint64) (map[string]uint64, map[string]uint64) {
+	switch program.CapOverflowPolicy {
+	case types.CapOverflowRedistribute:
+		return RedistributeEmissions(program, poolsEligibleForEmissionsByIdent, emissionsByPool)
+	case types.CapOverflowTreasury, "":
+		truncatedEmissions := TruncateEmissions(program, emissionsByPool)
+		overflowByPool := map[string]uint64{}
+		for pool, amount := range emissionsByPool {
+			if truncatedEmissions[pool] < amount {
+				overflowByPool[pool] = amount - truncatedEmissions[pool]
+			}
+		}
+		return truncatedEmissions, overflowByPool
+	default:
+		panic(fmt.Sprintf("program is misconfigured, unrecognized cap overflow policy %v; check it with ValidateCapOverflowPolicy", program.CapOverflowPolicy))
+	}
+}
+
 // Compute the total LP token days that each owner has; We multiply the LP tokens by seconds they were locked, and then divide by 86400.
 // This effectively divides the LP tokens by the fraction of the day they are locked, to prevent someone locking in the last minute of the day to receive rewards
-func TotalLPDaysByOwnerAndAsset(positions []types.Position, poolLookup types.PoolLookup, minSlot uint64, maxSlot uint64) (map[string]map[shared.AssetID]uint64, map[shared.AssetID]uint64) {
+func TotalLPDaysByOwnerAndAsset(positions []types.Position, poolLookup types.PoolLookup, minSlot uint64, maxSlot uint64, opts ...Option) (map[string]map[shared.AssetID]uint64, map[shared.AssetID]uint64) {
+	o := applyOptions(opts)
+	ownerShards := make([]map[string]map[shared.AssetID]uint64, o.shardCount(len(positions)))
+	assetShards := make([]map[shared.AssetID]uint64, len(ownerShards))
+	// Nothing here can fail, so there's no error to check
+	_ = runSharded(len(positions), len(ownerShards), func(shard, start, end int) error {
+		lpDaysByOwner := map[string]map[shared.AssetID]uint64{}
+		lpDaysByAsset := map[shared.AssetID]uint64{}
+		for _, p := range positions[start:end] {
+			addPositionLPDays(p, poolLookup, minSlot, maxSlot, lpDaysByOwner, lpDaysByAsset)
+		}
+		ownerShards[shard] = lpDaysByOwner
+		assetShards[shard] = lpDaysByAsset
+		return nil
+	})
+
 	lpDaysByOwner := map[string]map[shared.AssetID]uint64{}
 	lpDaysByAsset := map[shared.AssetID]uint64{}
-	for _, p := range positions {
-		for policy, policyMap := range p.Value {
-			for assetName, amount := range policyMap {
-				assetId := shared.FromSeparate(policy, assetName)
-
-				if poolLookup.IsLPToken(assetId) {
-					// Compute the (truncated) start and end time,
-					startTime := p.Slot
-					if startTime < minSlot {
-						startTime = minSlot
-					}
-					endTime := p.SpentSlot
-					if p.SpentTransaction == "" || p.SpentSlot > maxSlot {
-						endTime = maxSlot
-					}
-					if endTime == startTime {
-						continue
-					}
-					// so we can compute what fraction of the day this position counts for
-					secondsLocked := endTime - startTime
-
-					weight := big.NewInt(0).SetUint64(secondsLocked)
-					weight = weight.Mul(weight, amount.BigInt())
-					weight = weight.Div(weight, big.NewInt(0).SetUint64(maxSlot-minSlot))
+	for i, shard := range ownerShards {
+		for owner, byAsset := range shard {
+			existingLPDays, ok := lpDaysByOwner[owner]
+			if !ok {
+				existingLPDays = map[shared.AssetID]uint64{}
+				lpDaysByOwner[owner] = existingLPDays
+			}
+			for assetId, weight := range byAsset {
+				existingLPDays[assetId] += weight
+			}
+		}
+		for assetId, weight := range assetShards[i] {
+			lpDaysByAsset[assetId] += weight
+		}
+	}
+	return lpDaysByOwner, lpDaysByAsset
+}
 
-					existingLPDays, ok := lpDaysByOwner[p.OwnerID]
-					if !ok {
-						existingLPDays = map[shared.AssetID]uint64{}
-					}
-					newWeight := existingLPDays[assetId] + weight.Uint64()
+// Add the LP token days of a single position to the totals for its owner and each LP asset
+func addPositionLPDays(p types.Position, poolLookup types.PoolLookup, minSlot uint64, maxSlot uint64, lpDaysByOwner map[string]map[shared.AssetID]uint64, lpDaysByAsset map[shared.AssetID]uint64) {
+	for policy, policyMap := range p.Value {
+		for assetName, amount := range policyMap {
+			assetId := shared.FromSeparate(policy, assetName)
+
+			if poolLookup.IsLPToken(assetId) {
+				// Compute the (truncated) start and end time,
+				startTime := p.Slot
+				if startTime < minSlot {
+					startTime = minSlot
+				}
+				endTime := p.SpentSlot
+				if p.SpentTransaction == "" || p.SpentSlot > maxSlot {
+					endTime = maxSlot
+				}
+				if endTime == startTime {
+					continue
+				}
+				// so we can compute what fraction of the day this position counts for
+				secondsLocked := endTime - startTime
 
-					existingLPDays[assetId] = newWeight
-					lpDaysByOwner[p.OwnerID] = existingLPDays
+				weight := big.NewInt(0).SetUint64(secondsLocked)
+				weight = weight.Mul(weight, amount.BigInt())
+				weight = weight.Div(weight, big.NewInt(0).SetUint64(maxSlot-minSlot))
 
-					lpDaysByAsset[assetId] += weight.Uint64()
+				existingLPDays, ok := lpDaysByOwner[p.OwnerID]
+				if !ok {
+					existingLPDays = map[shared.AssetID]uint64{}
 				}
+				newWeight := existingLPDays[assetId] + weight.Uint64()
+
+				existingLPDays[assetId] = newWeight
+				lpDaysByOwner[p.OwnerID] = existingLPDays
+
+				lpDaysByAsset[assetId] += weight.Uint64()
 			}
 		}
 	}
-	return lpDaysByOwner, lpDaysByAsset
 }
 
 // Switch the map key from pool Ident to LP token
@@ -711,7 +1179,8 @@ func RegroupByPool(ctx context.Context, byAsset map[shared.AssetID]uint64, poolL
 }
 
 // Split the daily emissions of each pool among the owners of LP tokens, according to their total LP weight
-func DistributeEmissionsToOwners(lpWeightByOwner map[string]map[shared.AssetID]uint64, emissionsByAsset map[shared.AssetID]uint64, lpTokensByAsset map[shared.AssetID]uint64) map[string]map[string]uint64 {
+func DistributeEmissionsToOwners(lpWeightByOwner map[string]map[shared.AssetID]uint64, emissionsByAsset map[shared.AssetID]uint64, lpTokensByAsset map[shared.AssetID]uint64, opts ...Option) map[string]map[string]uint64 {
+	o := applyOptions(opts)
 	// expand out the lpTokensByOwner, so we can sort them canonically for the round-robin
 	type OwnerStake struct {
 		OwnerID string
@@ -757,6 +1226,7 @@ func DistributeEmissionsToOwners(lpWeightByOwner map[string]map[shared.AssetID]u
 	}
 	// The emissions for each owner will be rounded down, and millionths of a SUNDAE distributed round-robin until
 	// the total user emissions match the pool emissions.
+	skippedOwners := map[string]bool{}
 	for assetId, allocatedAmount := range allocatedByAsset {
 		remainder := int(emissionsByAsset[assetId] - allocatedAmount)
 		if remainder < 0 {
@@ -777,6 +1247,14 @@ func DistributeEmissionsToOwners(lpWeightByOwner map[string]map[shared.AssetID]u
 				}
 				// If we didn't find anything, the user likely isn't qualified to receive emissions for *any* LP token, so skip over them
 				if minLP == "" {
+					if !skippedOwners[owner.OwnerID] {
+						skippedOwners[owner.OwnerID] = true
+						o.warn(types.Warning{
+							Code:    types.WarningOwnerSkippedForDust,
+							OwnerID: owner.OwnerID,
+							Message: "skipped when distributing rounding dust, since they earned no emissions to add it to",
+						})
+					}
 					continue
 				}
 				emissionsByOwner[owner.OwnerID][minLP] += 1
@@ -839,6 +1317,12 @@ func EmissionsByOwnerToEarnings(date types.Date, program types.YieldProgram, emi
 type CalculationOutputs struct {
 	Timestamp string
 
+	// The day and program the outputs were calculated for
+	Date      types.Date
+	ProgramID string
+	// Digests of the program, positions, pools and previous results these outputs were calculated from
+	Inputs types.InputDigests
+
 	TotalDelegations uint64
 	DelegationByPool map[string]uint64
 
@@ -849,12 +1333,15 @@ type CalculationOutputs struct {
 	DelegationOverWindowByPool map[string]uint64
 
 	PoolsEligibleForEmissions map[string]uint64
+	PoolSelectionReasons      map[string]string
+	EmissionWeightByPool      map[string]uint64
 
 	LockedLPByPool map[string]uint64
 	TotalLPByPool  map[string]uint64
 
 	EstimatedLockedLovelace       uint64
 	EstimatedLockedLovelaceByPool map[string]uint64
+	PricingRouteByPool            map[string]string
 
 	TotalEmissions             uint64
 	UntruncatedEmissionsByPool map[string]uint64
@@ -865,30 +1352,96 @@ type CalculationOutputs struct {
 	EstimatedEmissionsLovelaceValue  uint64
 	EstimatedEmissionsLovelaceByPool map[string]uint64
 
+	ReturnedToTreasury TreasuryReturns
+
 	Earnings []types.Earning
+	// The merkle root of the earnings, so each owner can be shown to be included; see types.EarningsTree
+	EarningsRoot string
+
+	Warnings []types.Warning
+}
+
+func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, endSlot uint64, program types.YieldProgram, previousResults []CalculationOutputs, positions []types.Position, poolLookup types.PoolLookup, opts ...Option) (CalculationOutputs, error) {
+	return calculateEarnings(ctx, date, startSlot, endSlot, program, previousResults, poolLookup, opts, func(poolLookup types.PoolLookup, opts []Option) (PositionTotals, string, error) {
+		totals, err := TotalPositions(ctx, program, positions, poolLookup, startSlot, endSlot, opts...)
+		if err != nil {
+			return PositionTotals{}, "", err
+		}
+		digest, err := types.DigestPositions(positions)
+		if err != nil {
+			return PositionTotals{}, "", fmt.Errorf("failed to digest positions: %w", err)
+		}
+		return totals, digest, nil
+	})
 }
 
-func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, endSlot uint64, program types.YieldProgram, previousResults []CalculationOutputs, positions []types.Position, poolLookup types.PoolLookup) (CalculationOutputs, error) {
+// Calculate the earnings in a single pass over the positions, without holding them all in memory; the outputs are the
+// same as CalculateEarnings over the same positions
+func CalculateEarningsFromSource(ctx context.Context, date types.Date, startSlot uint64, endSlot uint64, program types.YieldProgram, previousResults []CalculationOutputs, source types.PositionSource, poolLookup types.PoolLookup, opts ...Option) (CalculationOutputs, error) {
+	return calculateEarnings(ctx, date, startSlot, endSlot, program, previousResults, poolLookup, opts, func(poolLookup types.PoolLookup, opts []Option) (PositionTotals, string, error) {
+		positions := types.NewDigestingPositionSource(source)
+		totals, err := AccumulatePositions(ctx, program, positions, poolLookup, startSlot, endSlot, opts...)
+		if err != nil {
+			return PositionTotals{}, "", fmt.Errorf("failed to total positions: %w", err)
+		}
+		digest, err := positions.Digest()
+		if err != nil {
+			return PositionTotals{}, "", fmt.Errorf("failed to digest positions: %w", err)
+		}
+		return totals, digest, nil
+	})
+}
+
+// Everything after totalling up the positions is the same however they were read; totalPositions is only called
+// (once) if the date is within the program, with the pool lookup and options the calculation should use
+func calculateEarnings(
+	ctx context.Context,
+	date types.Date,
+	startSlot uint64,
+	endSlot uint64,
+	program types.YieldProgram,
+	previousResults []CalculationOutputs,
+	poolLookup types.PoolLookup,
+	opts []Option,
+	totalPositions func(poolLookup types.PoolLookup, opts []Option) (PositionTotals, string, error),
+) (CalculationOutputs, error) {
+	o := applyOptions(opts)
+
+	// Collect every warning on the outputs, while still passing them on to the callers logger
+	warnings := &types.WarningCollector{Next: o.logger}
+	opts = append(append([]Option{}, opts...), WithLogger(warnings))
+
 	// Check for start and end dates, inclusive
 	if date < program.FirstDailyRewards {
-		return CalculationOutputs{}, nil
+		return CalculationOutputs{Date: date, ProgramID: program.ID}, nil
 	}
 	if program.LastDailyRewards != "" && date > program.LastDailyRewards {
-		return CalculationOutputs{}, nil
+		return CalculationOutputs{Date: date, ProgramID: program.ID}, nil
 	}
 
-	// To calculate the daily emissions, ... first take inventory of SUNDAE held at the Locking Contract
-	// and factor in the users delegation
-	delegationByPool, totalDelegation, err := CalculateTotalDelegations(ctx, program, positions, poolLookup)
+	if err := ValidateCapOverflowPolicy(program); err != nil {
+		return CalculationOutputs{}, err
+	}
+
+	// Record what went into the calculation, including every pool it looks up
+	inputs, err := digestInputs(program, previousResults)
 	if err != nil {
-		return CalculationOutputs{}, fmt.Errorf("failed to calculate total delegations: %w", err)
+		return CalculationOutputs{}, err
 	}
+	pools := types.NewPoolRecorder(poolLookup)
+	poolLookup = pools
 
-	// Sum up the LP-seconds per pool, and estimate the value
-	lockedLPByPool, totalLPByPool, estimatedValueByPool, totalEstimatedValue, err := CalculateTotalLPAtSnapshot(ctx, endSlot, positions, program.ReferencePools, poolLookup)
+	// To calculate the daily emissions, ... first take inventory of SUNDAE held at the Locking Contract
+	// and factor in the users delegation; and sum up the LP-seconds per pool, and estimate the value
+	totals, positionsDigest, err := totalPositions(poolLookup, opts)
 	if err != nil {
-		return CalculationOutputs{}, fmt.Errorf("failed to calculate total LP: %w", err)
+		return CalculationOutputs{}, err
 	}
+	inputs.Positions = positionsDigest
+	delegationByPool, totalDelegation := totals.DelegationByPool, totals.TotalDelegations
+	lpSnapshot := totals.LPSnapshot
+	lockedLPByPool, totalLPByPool := lpSnapshot.LockedLPByPool, lpSnapshot.TotalLPByPool
+	estimatedValueByPool, totalEstimatedValue := lpSnapshot.EstimatedLovelaceByPool, lpSnapshot.EstimatedLovelace
 
 	// Disqualify any pools that need disqualification
 	qualifyingDelegationsPerPool, poolDisqualificationReasons, err := DisqualifyPools(ctx, program, lockedLPByPool, delegationByPool, poolLookup)
@@ -897,15 +1450,21 @@ func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, e
 	}
 
 	// Sum up the delegation window for any previously used snapshots
-	delegationOverWindowByPool, err := SumDelegationWindow(program, qualifyingDelegationsPerPool, previousResults)
+	delegationOverWindowByPool, err := SumDelegationWindow(program, date, qualifyingDelegationsPerPool, previousResults)
 	if err != nil {
 		return CalculationOutputs{}, fmt.Errorf("failed to sum delegation window: %w", err)
 	}
 
 	// If no pools are qualified (extremely degenerate case, return no earnings, and reserve those tokens for the treasury)
 	if _, ok := delegationOverWindowByPool[""]; len(delegationOverWindowByPool) == 0 || (ok && len(delegationOverWindowByPool) == 1) {
+		if inputs.Pools, err = pools.Digest(); err != nil {
+			return CalculationOutputs{}, fmt.Errorf("failed to digest pools: %w", err)
+		}
 		return CalculationOutputs{
 			Timestamp:                     time.Now().Format(time.RFC3339),
+			Date:                          date,
+			ProgramID:                     program.ID,
+			Inputs:                        inputs,
 			TotalDelegations:              totalDelegation,
 			DelegationByPool:              delegationByPool,
 			NumDelegationDays:             program.ConsecutiveDelegationWindow,
@@ -916,37 +1475,61 @@ func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, e
 			TotalLPByPool:                 totalLPByPool,
 			EstimatedLockedLovelace:       totalEstimatedValue,
 			EstimatedLockedLovelaceByPool: estimatedValueByPool,
+			PricingRouteByPool:            lpSnapshot.PricingRouteByPool,
+			ReturnedToTreasury:            CalculateTreasuryReturns(program, nil, nil, nil, 0),
+			Warnings:                      warnings.Warnings(),
 		}, nil
 	}
 
 	// The top pools ... will be eligible for yield farming rewards that day.
-	poolsEligibleForEmissions, err := SelectEligiblePoolsForEmission(ctx, program, delegationOverWindowByPool, poolLookup)
+	poolSelector, err := PoolSelectorForProgram(program)
+	if err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to select pools for emission: %w", err)
+	}
+	poolsEligibleForEmissions, poolSelectionReasons, err := poolSelector.SelectPools(ctx, program, PoolSelectionInputs{
+		DelegationByPool:              delegationOverWindowByPool,
+		EstimatedLockedLovelaceByPool: estimatedValueByPool,
+		PoolLookup:                    poolLookup,
+	})
 	if err != nil {
 		return CalculationOutputs{}, fmt.Errorf("failed to select pools for emission: %w", err)
 	}
 
 	// We then divide the daily emissions among these pools ...
-	rawEmissionsByPool := DistributeEmissionsToPools(program, poolsEligibleForEmissions)
-	emissionsByPool := TruncateEmissions(program, rawEmissionsByPool)
+	weightingCurve, err := PoolWeightingCurveForProgram(program)
+	if err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to weigh pools for emission: %w", err)
+	}
+	emissionWeightByPool, err := weightingCurve.WeighPools(program, poolsEligibleForEmissions, estimatedValueByPool)
+	if err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to weigh pools for emission: %w", err)
+	}
+	rawEmissionsByPool := DistributeEmissionsToPools(program, emissionWeightByPool)
+	emissionsByPool, capOverflowByPool := CapEmissions(program, emissionWeightByPool, rawEmissionsByPool)
 	emissionsByAsset, err := RegroupByAsset(ctx, emissionsByPool, poolLookup)
 	if err != nil {
 		return CalculationOutputs{}, fmt.Errorf("failed to regroup emissions by asset: %w", err)
 	}
 
 	// For each pool, SundaeSwap labs will then calculate the allocation of rewards in proportion to the LP tokens held at the Locking Contract.
-	lpDaysByOwner, lpTokensByAsset := TotalLPDaysByOwnerAndAsset(positions, poolLookup, startSlot, endSlot)
-
-	emissionsByOwner := DistributeEmissionsToOwners(lpDaysByOwner, emissionsByAsset, lpTokensByAsset)
-
-	ownersByID := map[string]types.MultisigScript{}
-	for _, position := range positions {
-		ownersByID[position.OwnerID] = position.Owner
-	}
+	emissionsByOwner := DistributeEmissionsToOwners(totals.LPDaysByOwner, emissionsByAsset, totals.LPDaysByAsset, opts...)
+	ownersByID := totals.OwnersByID
 
 	// Find the pool that we should use for price reference, so we can estimate the ADA value of what was emitted
 	var emittedLovelaceValue uint64
 	emittedLovelaceValueByPool := map[string]uint64{}
-	if program.ReferencePool != "" || program.ReferencePools != nil {
+	if o.priceOracle != nil {
+		price, err := o.priceOracle.LovelacePrice(ctx, program.EmittedAsset)
+		if err != nil {
+			return CalculationOutputs{}, fmt.Errorf("failure to price emitted asset %v: %w", program.EmittedAsset, err)
+		}
+		for ident, sundae := range emissionsByPool {
+			estimatedNumerator := big.NewInt(0).Mul(big.NewInt(0).SetUint64(sundae), price.Num())
+			estimatedLovelaceValue := big.NewInt(0).Div(estimatedNumerator, price.Denom())
+			emittedLovelaceValue += estimatedLovelaceValue.Uint64()
+			emittedLovelaceValueByPool[ident] += estimatedLovelaceValue.Uint64()
+		}
+	} else if program.ReferencePool != "" || program.ReferencePools != nil {
 		refPoolIdent := program.ReferencePool
 		if refPoolIdent == "" {
 			refPoolIdent = program.ReferencePools[program.EmittedAsset]
@@ -968,6 +1551,10 @@ func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, e
 	// Users will be able to claim these emitted tokens
 	// we return a set of "earnings" for the day
 	earnings, perOwnerTotal := EmissionsByOwnerToEarnings(date, program, emissionsByOwner, ownersByID)
+	earningsTree, err := types.NewEarningsTree(earnings)
+	if err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to commit to earnings: %w", err)
+	}
 
 	totalEmissions := uint64(0)
 	for _, byPool := range emissionsByOwner {
@@ -976,8 +1563,18 @@ func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, e
 		}
 	}
 
+	// Anything we didn't emit goes back to the treasury, so keep track of where it came from
+	returnedToTreasury := CalculateTreasuryReturns(program, rawEmissionsByPool, capOverflowByPool, emissionsByPool, totalEmissions)
+
+	if inputs.Pools, err = pools.Digest(); err != nil {
+		return CalculationOutputs{}, fmt.Errorf("failed to digest pools: %w", err)
+	}
+
 	return CalculationOutputs{
 		Timestamp: time.Now().Format(time.RFC3339),
+		Date:      date,
+		ProgramID: program.ID,
+		Inputs:    inputs,
 
 		TotalDelegations: totalDelegation,
 		DelegationByPool: delegationByPool,
@@ -989,12 +1586,15 @@ func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, e
 		DelegationOverWindowByPool: delegationOverWindowByPool,
 
 		PoolsEligibleForEmissions: poolsEligibleForEmissions,
+		PoolSelectionReasons:      poolSelectionReasons,
+		EmissionWeightByPool:      emissionWeightByPool,
 
 		LockedLPByPool: lockedLPByPool,
 		TotalLPByPool:  totalLPByPool,
 
 		EstimatedLockedLovelace:       totalEstimatedValue,
 		EstimatedLockedLovelaceByPool: estimatedValueByPool,
+		PricingRouteByPool:            lpSnapshot.PricingRouteByPool,
 
 		TotalEmissions:             totalEmissions,
 		UntruncatedEmissionsByPool: rawEmissionsByPool,
@@ -1005,6 +1605,11 @@ func CalculateEarnings(ctx context.Context, date types.Date, startSlot uint64, e
 		EstimatedEmissionsLovelaceValue:  emittedLovelaceValue,
 		EstimatedEmissionsLovelaceByPool: emittedLovelaceValueByPool,
 
-		Earnings: earnings,
+		ReturnedToTreasury: returnedToTreasury,
+
+		Earnings:     earnings,
+		EarningsRoot: earningsTree.Root(),
+
+		Warnings: warnings.Warnings(),
 	}, nil
 }
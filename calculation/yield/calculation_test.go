@@ -10,6 +10,7 @@ import (
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/pricing"
 	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
 	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
 	"github.com/tj/assert"
@@ -160,13 +161,15 @@ func Test_SumWindow(t *testing.T) {
 	}
 	previousDays := []CalculationOutputs{
 		{
+			Date:      "2024-01-01",
+			ProgramID: program.ID,
 			QualifyingDelegationByPool: map[string]uint64{
 				"B": 300,
 				"C": 400,
 			},
 		},
 	}
-	window, err := SumDelegationWindow(program, qualifyingDelegations, previousDays)
+	window, err := SumDelegationWindow(program, "2024-01-02", qualifyingDelegations, previousDays)
 	assert.Nil(t, err)
 	assert.Len(t, window, 3)
 	assert.EqualValues(t, window["A"], 100)
@@ -174,6 +177,73 @@ func Test_SumWindow(t *testing.T) {
 	assert.EqualValues(t, window["C"], 400)
 }
 
+func Test_DelegationWindowDates(t *testing.T) {
+	program := utilities.SampleYieldProgram(500000_000_000)
+	program.FirstDailyRewards = "2024-01-01"
+	program.ConsecutiveDelegationWindow = 3
+
+	dates, err := DelegationWindowDates(program, "2024-03-01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-02-28", "2024-02-29"}, dates)
+
+	// While the program starts up, the window only reaches back to the first day
+	dates, err = DelegationWindowDates(program, "2024-01-02")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-01-01"}, dates)
+	dates, err = DelegationWindowDates(program, "2024-01-01")
+	assert.Nil(t, err)
+	assert.Len(t, dates, 0)
+
+	_, err = DelegationWindowDates(program, "2024-13-01")
+	assert.NotNil(t, err)
+}
+
+func Test_ValidateDelegationWindow(t *testing.T) {
+	program := utilities.SampleYieldProgram(500000_000_000)
+	program.FirstDailyRewards = "2024-01-01"
+	program.ConsecutiveDelegationWindow = 3
+	day := func(date types.Date) CalculationOutputs {
+		return CalculationOutputs{Date: date, ProgramID: program.ID}
+	}
+	history := func(days ...CalculationOutputs) []CalculationOutputs {
+		return days
+	}
+
+	assert.Nil(t, ValidateDelegationWindow(program, "2024-01-10", history(day("2024-01-08"), day("2024-01-09"))))
+	assert.Nil(t, ValidateDelegationWindow(program, "2024-03-01", history(day("2024-02-28"), day("2024-02-29"))))
+
+	// While the program starts up, the window only reaches back to the first day
+	assert.Nil(t, ValidateDelegationWindow(program, "2024-01-01", nil))
+	assert.Nil(t, ValidateDelegationWindow(program, "2024-01-02", history(day("2024-01-01"))))
+	assert.NotNil(t, ValidateDelegationWindow(program, "2024-01-02", nil))
+	assert.NotNil(t, ValidateDelegationWindow(program, "2024-01-02", history(day("2023-12-31"), day("2024-01-01"))))
+
+	// Backfilling an earlier day works the same way, relative to that day
+	assert.Nil(t, ValidateDelegationWindow(program, "2024-01-05", history(day("2024-01-03"), day("2024-01-04"))))
+
+	for name, previous := range map[string][]CalculationOutputs{
+		"gap":           history(day("2024-01-07"), day("2024-01-09")),
+		"missing":       history(day("2024-01-09")),
+		"stale":         history(day("2024-01-07"), day("2024-01-08")),
+		"duplicate":     history(day("2024-01-09"), day("2024-01-09")),
+		"out of order":  history(day("2024-01-09"), day("2024-01-08")),
+		"too many":      history(day("2024-01-07"), day("2024-01-08"), day("2024-01-09")),
+		"not before":    history(day("2024-01-09"), day("2024-01-10")),
+		"undated":       history(day("2024-01-08"), CalculationOutputs{ProgramID: program.ID}),
+		"wrong program": history(day("2024-01-08"), CalculationOutputs{Date: "2024-01-09", ProgramID: "Other"}),
+	} {
+		err := ValidateDelegationWindow(program, "2024-01-10", previous)
+		assert.NotNil(t, err, name)
+		_, err = SumDelegationWindow(program, "2024-01-10", nil, previous)
+		assert.NotNil(t, err, name)
+	}
+
+	// Without a window, there's no history
+	program.ConsecutiveDelegationWindow = 0
+	assert.Nil(t, ValidateDelegationWindow(program, "2024-01-10", nil))
+	assert.NotNil(t, ValidateDelegationWindow(program, "2024-01-10", history(day("2024-01-09"))))
+}
+
 func Test_AtLeastOnePercent(t *testing.T) {
 	assert.False(t, atLeastIntegerPercent(0, 15000, 1))
 	assert.False(t, atLeastIntegerPercent(1, 15000, 1))
@@ -327,6 +397,98 @@ func Test_CalculateTotalLPWithAssetNames(t *testing.T) {
 	assert.EqualValues(t, 1300, totalValue)
 }
 
+func Test_CalculateTotalLPWithRouting(t *testing.T) {
+	positions := []types.Position{
+		{OwnerID: "A", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(100)}))},
+		{OwnerID: "B", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_03", Amount: num.Uint64(100)}))},
+		{OwnerID: "C", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_04", Amount: num.Uint64(100)}))},
+		{OwnerID: "D", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_05", Amount: num.Uint64(100)}))},
+	}
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: "", AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 100, AssetA: "", AssetB: "Y", AssetAQuantity: 100, AssetBQuantity: 100},
+		"03": {PoolIdent: "03", LPAsset: "LP_03", TotalLPTokens: 1000, AssetA: "X", AssetB: "Y", AssetAQuantity: 10000, AssetBQuantity: 5000},
+		"04": {PoolIdent: "04", LPAsset: "LP_04", TotalLPTokens: 100, AssetA: "Y", AssetB: "Z", AssetAQuantity: 50, AssetBQuantity: 100},
+		"05": {PoolIdent: "05", LPAsset: "LP_05", TotalLPTokens: 100, AssetA: "P", AssetB: "Q", AssetAQuantity: 50, AssetBQuantity: 100},
+	}
+	snapshot, err := CalculateLPSnapshot(context.Background(), 0, positions, nil, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"01": 200, "03": 1000, "04": 100, "05": 0}, snapshot.EstimatedLovelaceByPool)
+	assert.EqualValues(t, 1300, snapshot.EstimatedLovelace)
+	assert.EqualValues(t, map[string]string{
+		"01": "ada.lovelace",
+		"03": "X -[01]-> ada.lovelace",
+		"04": "Y -[03]-> X -[01]-> ada.lovelace",
+	}, snapshot.PricingRouteByPool)
+
+	// A lookup that can't list every pool routes through the pools with LP locked instead, which here are enough;
+	// the LP is summed by pool while it waits for them, so splitting it across positions doesn't change its value
+	split := append([]types.Position{}, positions...)
+	split[1].Value = compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_03", Amount: num.Uint64(40)}))
+	split = append(split, types.Position{OwnerID: "E", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_03", Amount: num.Uint64(60)}))})
+	unlisted, err := CalculateLPSnapshot(context.Background(), 0, split, nil, struct{ types.PoolLookup }{pools})
+	assert.Nil(t, err)
+	assert.EqualValues(t, snapshot, unlisted)
+
+	// Reference pools still take precedence
+	snapshot, err = CalculateLPSnapshot(context.Background(), 0, positions, map[shared.AssetID]string{"Y": "02"}, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "Y -[02]-> ada.lovelace", snapshot.PricingRouteByPool["04"])
+	assert.EqualValues(t, 100, snapshot.EstimatedLovelaceByPool["04"])
+}
+
+func Test_CalculateTotalLPWithAdaAsAssetB(t *testing.T) {
+	positions := []types.Position{
+		{OwnerID: "A", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(100)}))},
+		{OwnerID: "B", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_02", Amount: num.Uint64(100)}))},
+	}
+	// X is routable through pool 02, so both halves of pool 01 have a route to ADA
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: "X", AssetB: shared.AdaAssetID, AssetAQuantity: 2000, AssetBQuantity: 1000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+	}
+	snapshot, err := CalculateLPSnapshot(context.Background(), 0, positions, nil, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"01": 200, "02": 200}, snapshot.EstimatedLovelaceByPool)
+	assert.EqualValues(t, map[string]string{
+		"01": "ada.lovelace",
+		"02": "ada.lovelace",
+	}, snapshot.PricingRouteByPool)
+}
+
+func Test_CalculateTotalLPWithOracle(t *testing.T) {
+	positions := []types.Position{
+		{OwnerID: "A", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(100)}))},
+		{OwnerID: "B", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_02", Amount: num.Uint64(100)}))},
+		{OwnerID: "C", Value: compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "LP_03", Amount: num.Uint64(100)}))},
+	}
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: "", AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: "X", AssetB: "Y", AssetAQuantity: 10000, AssetBQuantity: 5000},
+		"03": {PoolIdent: "03", LPAsset: "LP_03", TotalLPTokens: 1000, AssetA: "Z", AssetB: "Y", AssetAQuantity: 10000, AssetBQuantity: 5000},
+	}
+	history := utilities.MockPoolHistory{
+		"01": {
+			{PoolIdent: "01", Slot: 0, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+			{PoolIdent: "01", Slot: 43200, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 2000},
+		},
+	}
+	oracle := pricing.TWAPOracle{
+		ReferencePools: map[shared.AssetID]string{"X": "01"},
+		History:        history,
+		StartSlot:      0,
+		EndSlot:        86400,
+	}
+	snapshot, err := CalculateLPSnapshot(context.Background(), 86400, positions, nil, pools, WithPriceOracle(oracle))
+	assert.Nil(t, err)
+	// ADA pools don't need pricing, X is priced at 0.75 over the day, and nothing can price Z or Y
+	assert.EqualValues(t, map[string]uint64{"01": 200, "02": 1500, "03": 0}, snapshot.EstimatedLovelaceByPool)
+	assert.EqualValues(t, map[string]string{
+		"01": "ada.lovelace",
+		"02": "X -[oracle]-> ada.lovelace",
+	}, snapshot.PricingRouteByPool)
+}
+
 func Test_PoolForEmissions(t *testing.T) {
 	program := utilities.SampleYieldProgram(500_000)
 	program.MaxPoolCount = 2
@@ -371,6 +533,29 @@ func Test_PoolForEmissions(t *testing.T) {
 	assert.EqualValues(t, map[string]uint64{"F": 1002, "E": 1001}, selectedPools)
 }
 
+func Test_PoolsForEmissions_WithStrategy(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	program.MaxPoolCount = 1
+	program.MaxPoolIntegerPercent = 100
+	pools := utilities.MockLookup{"A": types.Pool{PoolIdent: "A"}, "B": types.Pool{PoolIdent: "B"}}
+	delegations := map[string]uint64{"A": 100, "B": 200}
+
+	// The program's own strategy is used, rather than always the top pools
+	program.PoolSelectionStrategy = types.PoolSelectionAll
+	selectedPools, err := SelectEligiblePoolsForEmission(context.Background(), program, delegations, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 100, "B": 200}, selectedPools)
+
+	// Without the locked lovelace for each pool, a minimum can't be applied, rather than selecting nothing
+	program.PoolSelectionStrategy = types.PoolSelectionMinimumLockedLovelace
+	_, err = SelectEligiblePoolsForEmission(context.Background(), program, delegations, pools)
+	assert.NotNil(t, err)
+
+	program.PoolSelectionStrategy = "Unknown"
+	_, err = SelectEligiblePoolsForEmission(context.Background(), program, delegations, pools)
+	assert.NotNil(t, err)
+}
+
 func Test_PoolsForEmissions_WithNepotism(t *testing.T) {
 	program := utilities.SampleYieldProgram(500_000)
 	program.NepotismPools = []string{"B"}
@@ -416,6 +601,115 @@ func Test_EmissionsToPools(t *testing.T) {
 	assert.EqualValues(t, map[string]uint64{"A": 166_333_333_333, "B": 332_666_666_667, "C": 1_000_000_000}, emissions)
 }
 
+func weighAndDistribute(t *testing.T, program types.YieldProgram, poolsEligible map[string]uint64, lockedLovelace map[string]uint64) map[string]uint64 {
+	curve, err := PoolWeightingCurveForProgram(program)
+	assert.Nil(t, err)
+	weights, err := curve.WeighPools(program, poolsEligible, lockedLovelace)
+	assert.Nil(t, err)
+	return DistributeEmissionsToPools(program, weights)
+}
+
+func Test_EmissionsToPools_SquareRoot(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.EmissionWeighting = types.EmissionWeightingSquareRoot
+	emissions := weighAndDistribute(t, program, map[string]uint64{
+		"A": 100,
+		"B": 400,
+		"C": 900,
+	}, nil)
+	assert.EqualValues(t, map[string]uint64{"A": 83_333_333_333, "B": 166_666_666_666, "C": 250_000_000_001}, emissions)
+
+	program.FixedEmissions = map[string]uint64{
+		"D": 2_000_000_000,
+	}
+	emissions = weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 4000,
+		"D": 1_000_000,
+	}, nil)
+	assert.EqualValues(t, map[string]uint64{"A": 164_234_042_553, "B": 333_765_957_447, "D": 2_000_000_000}, emissions)
+}
+
+func Test_EmissionsToPools_LockedLovelace(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.EmissionWeighting = types.EmissionWeightingLockedLovelace
+	emissions := weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 2000,
+	}, map[string]uint64{
+		"A": 300,
+		"B": 100,
+	})
+	assert.EqualValues(t, map[string]uint64{"A": 375_000_000_000, "B": 125_000_000_000}, emissions)
+
+	// Pools with nothing locked receive nothing
+	emissions = weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 2000,
+		"C": 3000,
+	}, map[string]uint64{
+		"A": 100,
+		"B": 200,
+	})
+	assert.EqualValues(t, map[string]uint64{"A": 166_666_666_666, "B": 333_333_333_334, "C": 0}, emissions)
+
+	// And if nothing is locked anywhere, only the fixed emissions are allocated
+	program.FixedEmissions = map[string]uint64{
+		"D": 2_000_000_000,
+	}
+	emissions = weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 2000,
+	}, nil)
+	assert.EqualValues(t, map[string]uint64{"D": 2_000_000_000}, emissions)
+}
+
+func Test_EmissionsToPools_Blend(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.EmissionWeighting = types.EmissionWeightingBlend
+	program.BlendDelegationIntegerPercent = 50
+	emissions := weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 3000,
+	}, map[string]uint64{
+		"A": 300,
+		"B": 100,
+	})
+	// (1/4 + 3/4) / 2 and (3/4 + 1/4) / 2
+	assert.EqualValues(t, map[string]uint64{"A": 250_000_000_000, "B": 250_000_000_000}, emissions)
+
+	emissions = weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 2000,
+	}, map[string]uint64{
+		"A": 300,
+		"B": 100,
+	})
+	// (1/3 + 3/4) / 2 and (2/3 + 1/4) / 2
+	assert.EqualValues(t, map[string]uint64{"A": 270_833_333_334, "B": 229_166_666_666}, emissions)
+
+	// 100% delegation is the same as linear
+	program.BlendDelegationIntegerPercent = 100
+	emissions = weighAndDistribute(t, program, map[string]uint64{
+		"A": 1000,
+		"B": 2000,
+	}, map[string]uint64{
+		"A": 300,
+		"B": 100,
+	})
+	assert.EqualValues(t, map[string]uint64{"A": 166_666_666_666, "B": 333_333_333_334}, emissions)
+
+	program.BlendDelegationIntegerPercent = 101
+	curve, err := PoolWeightingCurveForProgram(program)
+	assert.Nil(t, err)
+	_, err = curve.WeighPools(program, map[string]uint64{"A": 1000}, nil)
+	assert.NotNil(t, err)
+
+	program.EmissionWeighting = "Bogus"
+	_, err = PoolWeightingCurveForProgram(program)
+	assert.NotNil(t, err)
+}
+
 func Test_TruncateEmissions(t *testing.T) {
 	program := utilities.SampleYieldProgram(500_000_000_000)
 	program.EmissionCap = 200_000_000_000
@@ -430,6 +724,52 @@ func Test_TruncateEmissions(t *testing.T) {
 	assert.EqualValues(t, map[string]uint64{"A": 166_333_333_333, "B": 200_000_000_000, "C": 1_000_000_000}, truncatedEmissions)
 }
 
+func Test_RedistributeEmissions(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	program.EmissionCap = 400
+	program.CapOverflowPolicy = types.CapOverflowRedistribute
+	eligible := map[string]uint64{"A": 100, "B": 200, "C": 700}
+	emissions, overflow := CapEmissions(program, eligible, DistributeEmissionsToPools(program, eligible))
+	assert.EqualValues(t, map[string]uint64{"A": 200, "B": 400, "C": 400}, emissions)
+	assert.Empty(t, overflow)
+
+	// Redistributing can push other pools over the cap, so it should repeat until nothing is over the cap
+	program.EmissionCap = 350
+	eligible = map[string]uint64{"A": 100, "B": 300, "C": 600}
+	emissions, overflow = CapEmissions(program, eligible, DistributeEmissionsToPools(program, eligible))
+	assert.EqualValues(t, map[string]uint64{"A": 300, "B": 350, "C": 350}, emissions)
+	assert.Empty(t, overflow)
+
+	// When every pool is capped, the rest should go back to the treasury
+	program.EmissionCap = 300
+	eligible = map[string]uint64{"A": 1, "B": 1, "C": 1}
+	emissions, overflow = CapEmissions(program, eligible, DistributeEmissionsToPools(program, eligible))
+	assert.EqualValues(t, map[string]uint64{"A": 300, "B": 300, "C": 300}, emissions)
+	assert.EqualValues(t, map[string]uint64{"A": 34, "B": 33, "C": 33}, overflow)
+
+	// Pools with fixed emissions neither give up nor receive any overflow
+	program.EmissionCap = 400
+	program.FixedEmissions = map[string]uint64{"D": 500}
+	eligible = map[string]uint64{"A": 100, "B": 100, "C": 800, "D": 1000}
+	emissions, overflow = CapEmissions(program, eligible, DistributeEmissionsToPools(program, eligible))
+	assert.EqualValues(t, map[string]uint64{"A": 50, "B": 50, "C": 400, "D": 500}, DistributeEmissionsToPools(program, eligible))
+	assert.EqualValues(t, map[string]uint64{"A": 50, "B": 50, "C": 400, "D": 500}, emissions)
+	assert.Empty(t, overflow)
+
+	// And the leftover dust should be distributed deterministically
+	program.FixedEmissions = nil
+	program.DailyEmission = 1001
+	program.EmissionCap = 500
+	eligible = map[string]uint64{"A": 1, "B": 1, "C": 1, "D": 3}
+	raw := DistributeEmissionsToPools(program, eligible)
+	assert.EqualValues(t, map[string]uint64{"A": 167, "B": 167, "C": 166, "D": 501}, raw)
+	for i := 0; i < 10; i++ {
+		emissions, overflow = CapEmissions(program, eligible, raw)
+		assert.EqualValues(t, map[string]uint64{"A": 168, "B": 167, "C": 166, "D": 500}, emissions)
+		assert.Empty(t, overflow)
+	}
+}
+
 func Test_OwnerByLPAndAsset(t *testing.T) {
 	pools := utilities.MockLookup{
 		"X": {PoolIdent: "X", LPAsset: "LP_X"},
@@ -583,6 +923,60 @@ func Test_EmissionsToOwners(t *testing.T) {
 	assert.EqualValues(t, map[string]map[string]uint64{"A": {"LP_X": 334, "LP_Y": 500}, "B": {"LP_X": 666}}, emissionsByOwner)
 }
 
+func Test_Warnings(t *testing.T) {
+	program := utilities.SampleYieldProgram(500000_000_000)
+
+	// LP for a deleted pool is skipped, with a warning
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 0, AssetA: "", AssetB: program.StakedAsset},
+	}
+	positions := []types.Position{
+		utilities.SamplePosition("Me", 100_000, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1}),
+	}
+	value := shared.Value(positions[0].Value)
+	value.AddAsset(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(50_000)})
+	positions[0].Value = compatibility.CompatibleValue(value)
+	warnings := &types.WarningCollector{}
+	_, totalDelegations, err := CalculateTotalDelegations(context.Background(), program, positions, pools, WithLogger(warnings))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 100_000, totalDelegations)
+	assert.Len(t, warnings.Warnings(), 1)
+	assert.EqualValues(t, types.WarningDeletedPoolLP, warnings.Warnings()[0].Code)
+	assert.EqualValues(t, "01", warnings.Warnings()[0].PoolIdent)
+	assert.EqualValues(t, "Me", warnings.Warnings()[0].OwnerID)
+
+	// LP that can't be priced is valued at 0, with a warning
+	pools = utilities.MockLookup{
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: "X", AssetB: "Y", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	positions = []types.Position{
+		{OwnerID: "Me", Value: makeValue("LP_02", 100)},
+	}
+	warnings = &types.WarningCollector{}
+	snapshot, err := CalculateLPSnapshot(context.Background(), 0, positions, nil, pools, WithLogger(warnings))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, snapshot.EstimatedLovelace)
+	assert.Len(t, warnings.Warnings(), 1)
+	assert.EqualValues(t, types.WarningMissingPrice, warnings.Warnings()[0].Code)
+	assert.EqualValues(t, "02", warnings.Warnings()[0].PoolIdent)
+
+	// Owners with nothing to add rounding dust to are skipped, with a single warning each
+	lpByOwners := LPByOwners(
+		Alloc{"0", "LP_Z", 100},
+		Alloc{"A", "LP_X", 100},
+		Alloc{"B", "LP_X", 100},
+		Alloc{"C", "LP_X", 100},
+	)
+	emissionsByAsset := map[shared.AssetID]uint64{"LP_X": 1000}
+	lpTokensByAsset := map[shared.AssetID]uint64{"LP_X": 300, "LP_Z": 100}
+	warnings = &types.WarningCollector{}
+	emissionsByOwner := DistributeEmissionsToOwners(lpByOwners, emissionsByAsset, lpTokensByAsset, WithLogger(warnings))
+	assert.EqualValues(t, map[string]map[string]uint64{"A": {"LP_X": 334}, "B": {"LP_X": 333}, "C": {"LP_X": 333}}, emissionsByOwner)
+	assert.Len(t, warnings.Warnings(), 1)
+	assert.EqualValues(t, types.WarningOwnerSkippedForDust, warnings.Warnings()[0].Code)
+	assert.EqualValues(t, "0", warnings.Warnings()[0].OwnerID)
+}
+
 func makeValue(token string, amt uint64) compatibility.CompatibleValue {
 	return compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: shared.AssetID(token), Amount: num.Uint64(amt)}))
 }
@@ -605,19 +999,19 @@ func Test_EmissionsToEarnings(t *testing.T) {
 	assert.EqualValues(t, []types.Earning{
 		{
 			OwnerID: "A", Program: program.ID, Owner: ownerA, EarnedDate: now,
-			Value: makeValue("Emitted", 1000),
+			Value: makeValue(string(utilities.EmittedAsset), 1000),
 			ValueByLPToken: map[string]compatibility.CompatibleValue{
-				"LP_X": makeValue("Emitted", 900),
-				"LP_Y": makeValue("Emitted", 100),
+				"LP_X": makeValue(string(utilities.EmittedAsset), 900),
+				"LP_Y": makeValue(string(utilities.EmittedAsset), 100),
 			},
 		},
 		{
 			OwnerID: "B", Program: program.ID, Owner: ownerB, EarnedDate: now,
-			Value: makeValue("Emitted", 1500),
+			Value: makeValue(string(utilities.EmittedAsset), 1500),
 			ValueByLPToken: map[string]compatibility.CompatibleValue{
-				"LP_X": makeValue("Emitted", 1000),
-				"LP_Y": makeValue("Emitted", 200),
-				"LP_Z": makeValue("Emitted", 300),
+				"LP_X": makeValue(string(utilities.EmittedAsset), 1000),
+				"LP_Y": makeValue(string(utilities.EmittedAsset), 200),
+				"LP_Z": makeValue(string(utilities.EmittedAsset), 300),
 			},
 		},
 	}, emissions)
@@ -636,8 +1030,11 @@ func Test_Calculate_Earnings(t *testing.T) {
 	program := utilities.SampleYieldProgram(500_000_000_000)
 	program.ConsecutiveDelegationWindow = 3
 	previousDays := []CalculationOutputs{}
+	start := time.Now()
+	program.FirstDailyRewards = types.Date(start.Format(types.DateFormat))
 	for i := 0; i < 10; i++ {
-		program, calcOutputs, err := Random_Calc_Earnings(program, numPositions, numOwners, numPools, previousDays)
+		date := types.Date(start.AddDate(0, 0, i).Format(types.DateFormat))
+		program, calcOutputs, err := Random_Calc_Earnings(program, date, numPositions, numOwners, numPools, previousDays)
 		assert.Nil(t, err)
 		totalEarnings := uint64(0)
 		previousDays = append(previousDays, calcOutputs)
@@ -647,6 +1044,15 @@ func Test_Calculate_Earnings(t *testing.T) {
 		for _, e := range calcOutputs.Earnings {
 			totalEarnings += shared.Value(e.Value).AssetAmount(program.EmittedAsset).Uint64()
 		}
+		// Every earning can be proven to be included in the days root
+		tree, err := types.NewEarningsTree(calcOutputs.Earnings)
+		assert.Nil(t, err)
+		assert.EqualValues(t, tree.Root(), calcOutputs.EarningsRoot)
+		for _, e := range calcOutputs.Earnings {
+			proof, err := tree.Proof(e.Program, e.OwnerID)
+			assert.Nil(t, err)
+			assert.Nil(t, types.VerifyEarningProof(calcOutputs.EarningsRoot, e, proof))
+		}
 		totalFixedEmissions := uint64(0)
 		for _, amt := range program.FixedEmissions {
 			totalFixedEmissions += amt
@@ -682,6 +1088,8 @@ func Test_Calculate_Earnings(t *testing.T) {
 			// so in that case, every coin should be accounted for
 			assert.Equal(t, totalEarnings, program.DailyEmission)
 		}
+		// Regardless, every token should either be earned by someone, or returned to the treasury
+		assert.Equal(t, program.DailyEmission, totalEarnings+calcOutputs.ReturnedToTreasury.Total)
 	}
 }
 
@@ -691,12 +1099,11 @@ func Benchmark_Calculate_Earnings(b *testing.B) {
 		numPositions := 100_000
 		numOwners := 90_000
 		numPools := 1500
-		Random_Calc_Earnings(program, numPositions, numOwners, numPools, []CalculationOutputs{})
+		Random_Calc_Earnings(program, types.Date(time.Now().Format(types.DateFormat)), numPositions, numOwners, numPools, []CalculationOutputs{})
 	}
 }
 
-func Random_Calc_Earnings(program types.YieldProgram, numPositions, numOwners, numPools int, previousDays []CalculationOutputs) (types.YieldProgram, CalculationOutputs, error) {
-	now := types.Date(time.Now().Format(types.DateFormat))
+func Random_Calc_Earnings(program types.YieldProgram, date types.Date, numPositions, numOwners, numPools int, previousDays []CalculationOutputs) (types.YieldProgram, CalculationOutputs, error) {
 	var positions []types.Position
 	pools := utilities.MockLookup{}
 
@@ -759,15 +1166,17 @@ func Random_Calc_Earnings(program types.YieldProgram, numPositions, numOwners, n
 	}
 	if rand.Intn(10) == 0 {
 		program.EmissionCap = program.DailyEmission / 5
+		if rand.Intn(2) == 0 {
+			program.CapOverflowPolicy = types.CapOverflowRedistribute
+		}
 	}
 
+	// The window is the most recent days, oldest first
 	window := []CalculationOutputs{}
-	for i := 0; i < program.ConsecutiveDelegationWindow; i++ {
-		if len(previousDays) > i {
-			window = append(window, previousDays[len(previousDays)-1-i])
-		}
+	for i := len(previousDays) - 1; i >= 0 && len(window) < program.ConsecutiveDelegationWindow-1; i-- {
+		window = append([]CalculationOutputs{previousDays[i]}, window...)
 	}
 
-	results, err := CalculateEarnings(context.Background(), now, 0, 86400, program, window, positions, pools)
+	results, err := CalculateEarnings(context.Background(), date, 0, 86400, program, window, positions, pools)
 	return program, results, err
 }
@@ -0,0 +1,51 @@
+package yield
+
+import (
+	"fmt"
+	"sync"
+)
+
+// How many shards to split n positions into
+func (o calculationOptions) shardCount(n int) int {
+	if o.concurrency <= 1 || n <= 1 {
+		return 1
+	}
+	if o.concurrency > n {
+		return n
+	}
+	return o.concurrency
+}
+
+// Split n positions into contiguous shards, and call fn with the bounds of each shard, concurrently if there's more than one;
+// returns the error from the earliest shard that failed, which is the same error processing them serially would have returned.
+// Callers merge the shards' totals in order afterwards; since they're only adding, the result is the same however the
+// positions were sharded
+func runSharded(n int, shards int, fn func(shard, start, end int) error) error {
+	if shards <= 1 {
+		return fn(0, 0, n)
+	}
+	errs := make([]error, shards)
+	panics := make([]any, shards)
+	var wg sync.WaitGroup
+	for shard := 0; shard < shards; shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			// Re-panic on the calling goroutine, so invariant violations still surface like they do serially
+			defer func() {
+				panics[shard] = recover()
+			}()
+			errs[shard] = fn(shard, shard*n/shards, (shard+1)*n/shards)
+		}(shard)
+	}
+	wg.Wait()
+	for shard := 0; shard < shards; shard++ {
+		if panics[shard] != nil {
+			panic(fmt.Sprintf("shard %v: %v", shard, panics[shard]))
+		}
+		if errs[shard] != nil {
+			return errs[shard]
+		}
+	}
+	return nil
+}
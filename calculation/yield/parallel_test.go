@@ -0,0 +1,171 @@
+package yield
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+// Generate a random set of positions, with a mix of ADA pools, staked asset pools, and pools that have to be priced through other pools
+func randomPositions(r *rand.Rand, program types.YieldProgram, numPositions, numOwners, numPools int) ([]types.Position, utilities.MockLookup) {
+	pools := utilities.MockLookup{}
+	for i := 0; i < numPools; i++ {
+		poolIdent := fmt.Sprintf("Pool_%v", i)
+		pool := types.Pool{
+			PoolIdent:      poolIdent,
+			LPAsset:        shared.AssetID(fmt.Sprintf("LP_%v", i)),
+			TotalLPTokens:  uint64(r.Int63n(100_000_000_000)) + 1,
+			AssetA:         shared.AdaAssetID,
+			AssetB:         shared.AssetID(fmt.Sprintf("Token_%v", i)),
+			AssetAQuantity: uint64(r.Int63n(100_000_000_000)) + 1,
+			AssetBQuantity: uint64(r.Int63n(100_000_000_000)) + 1,
+		}
+		switch r.Intn(5) {
+		case 0:
+			pool.AssetB = program.StakedAsset
+		case 1, 2:
+			pool.AssetA = shared.AssetID(fmt.Sprintf("Token_%v", r.Intn(numPools)))
+		}
+		pools[poolIdent] = pool
+	}
+
+	var positions []types.Position
+	for i := 0; i < numPositions; i++ {
+		owner := fmt.Sprintf("Owner_%v", r.Intn(numOwners))
+		start := uint64(r.Intn(86400))
+		end := uint64(0)
+		if r.Intn(2) == 0 {
+			end = start + uint64(r.Intn(2*86400))
+		}
+		position := utilities.SampleTimedPosition(owner, r.Int63n(50_000_000_000_000), start, end)
+		for j := r.Intn(10); j > 0; j-- {
+			programID := program.ID
+			if r.Intn(4) == 0 {
+				programID = "OTHER PROGRAM"
+			}
+			position.Delegation = append(position.Delegation, types.Delegation{Program: programID, PoolIdent: fmt.Sprintf("Pool_%v", r.Intn(numPools)), Weight: uint32(r.Intn(50_000))})
+		}
+		value := shared.Value(position.Value)
+		for j := r.Intn(5); j > 0; j-- {
+			value.AddAsset(shared.Coin{AssetId: shared.AssetID(fmt.Sprintf("LP_%v", r.Intn(numPools))), Amount: num.Int64(r.Int63n(30_000_000))})
+		}
+		position.Value = compatibility.CompatibleValue(value)
+		positions = append(positions, position)
+	}
+	return positions, pools
+}
+
+var seed = flag.Int64("seed", 1, "seed for the randomized parallel tests")
+
+func Test_ParallelMatchesSerial(t *testing.T) {
+	r := rand.New(rand.NewSource(*seed))
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.ConsecutiveDelegationWindow = 1
+	withEarnings := 0
+	for trial := 0; trial < 10; trial++ {
+		positions, pools := randomPositions(r, program, r.Intn(3000)+1, r.Intn(500)+1, r.Intn(200)+1)
+		workers := r.Intn(16) + 2
+		parallel := WithConcurrency(workers)
+		msg := fmt.Sprintf("seed %v, trial %v, %v workers", *seed, trial, workers)
+
+		serialByPool, serialTotal, serialErr := CalculateTotalDelegations(context.Background(), program, positions, pools)
+		parallelByPool, parallelTotal, parallelErr := CalculateTotalDelegations(context.Background(), program, positions, pools, parallel)
+		assert.Nil(t, serialErr, msg)
+		assert.Nil(t, parallelErr, msg)
+		assert.Equal(t, serialByPool, parallelByPool, msg)
+		assert.Equal(t, serialTotal, parallelTotal, msg)
+
+		serialOwners, serialAssets := TotalLPDaysByOwnerAndAsset(positions, pools, 0, 86400)
+		parallelOwners, parallelAssets := TotalLPDaysByOwnerAndAsset(positions, pools, 0, 86400, parallel)
+		assert.Equal(t, serialOwners, parallelOwners, msg)
+		assert.Equal(t, serialAssets, parallelAssets, msg)
+
+		serialSnapshot, serialErr := CalculateLPSnapshot(context.Background(), 86400, positions, program.ReferencePools, pools)
+		parallelSnapshot, parallelErr := CalculateLPSnapshot(context.Background(), 86400, positions, program.ReferencePools, pools, parallel)
+		assert.Nil(t, serialErr, msg)
+		assert.Nil(t, parallelErr, msg)
+		assert.Equal(t, serialSnapshot, parallelSnapshot, msg)
+
+		serial, serialErr := CalculateEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, pools)
+		parallelOutputs, parallelErr := CalculateEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, pools, parallel)
+		assert.Nil(t, serialErr, msg)
+		assert.Nil(t, parallelErr, msg)
+		if len(serial.Earnings) > 0 {
+			withEarnings++
+		}
+		serial.Timestamp, parallelOutputs.Timestamp = "", ""
+		assert.Equal(t, serial, parallelOutputs, msg)
+	}
+	// Make sure the comparison wasn't trivial
+	assert.NotEqual(t, 0, withEarnings)
+}
+
+func Test_ParallelErrors(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	positions := []types.Position{
+		{OwnerID: "A", Value: makeValue("LP_01", 100)},
+		{OwnerID: "B", Value: makeValue("LP_02", 100)},
+		{OwnerID: "C", Value: makeValue("LP_03", 100)},
+	}
+	// Only the first pool exists, so the same (earliest) failure is reported either way
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	_, _, serialErr := CalculateTotalDelegations(context.Background(), program, positions, pools)
+	_, _, parallelErr := CalculateTotalDelegations(context.Background(), program, positions, pools, WithConcurrency(3))
+	assert.NotNil(t, serialErr)
+	assert.EqualValues(t, serialErr.Error(), parallelErr.Error())
+	assert.Contains(t, parallelErr.Error(), "LP_02")
+}
+
+func benchmarkPositions(b *testing.B, numPositions int) (types.YieldProgram, []types.Position, utilities.MockLookup) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.ConsecutiveDelegationWindow = 1
+	positions, pools := randomPositions(rand.New(rand.NewSource(42)), program, numPositions, numPositions/4, 500)
+	b.ResetTimer()
+	return program, positions, pools
+}
+
+func benchmarkWorkers(b *testing.B, run func(b *testing.B, opts ...Option)) {
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%v", workers), func(b *testing.B) {
+			run(b, WithConcurrency(workers))
+		})
+	}
+}
+
+func Benchmark_TotalDelegations(b *testing.B) {
+	benchmarkWorkers(b, func(b *testing.B, opts ...Option) {
+		program, positions, pools := benchmarkPositions(b, 100_000)
+		for i := 0; i < b.N; i++ {
+			_, _, _ = CalculateTotalDelegations(context.Background(), program, positions, pools, opts...)
+		}
+	})
+}
+
+func Benchmark_TotalLPDays(b *testing.B) {
+	benchmarkWorkers(b, func(b *testing.B, opts ...Option) {
+		_, positions, pools := benchmarkPositions(b, 100_000)
+		for i := 0; i < b.N; i++ {
+			_, _ = TotalLPDaysByOwnerAndAsset(positions, pools, 0, 86400, opts...)
+		}
+	})
+}
+
+func Benchmark_LPSnapshot(b *testing.B) {
+	benchmarkWorkers(b, func(b *testing.B, opts ...Option) {
+		program, positions, pools := benchmarkPositions(b, 100_000)
+		for i := 0; i < b.N; i++ {
+			_, _ = CalculateLPSnapshot(context.Background(), 86400, positions, program.ReferencePools, pools, opts...)
+		}
+	})
+}
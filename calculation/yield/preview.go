@@ -0,0 +1,219 @@
+package yield
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// A hypothetical change to the days positions, such as "what if I delegate 10k SUNDAE to pool 0d?"
+type Scenario struct {
+	// The owner to report the effect on
+	OwnerID string
+	// Positions to add, such as a new lock with the delegation being considered
+	Added []types.Position
+	// Positions to remove, by the transaction hash that created them
+	Removed []string
+}
+
+// How a single pool fares with and without the scenario
+type PoolPreview struct {
+	PoolIdent string
+
+	// The pools rank by delegation over the window, starting at 1, or 0 if it had no qualifying delegation
+	Rank        int
+	PreviewRank int
+
+	Selected        bool
+	PreviewSelected bool
+
+	DelegationOverWindow        uint64
+	PreviewDelegationOverWindow uint64
+
+	Emissions        uint64
+	PreviewEmissions uint64
+}
+
+// How the owner fares with and without the scenario
+type OwnerPreview struct {
+	Emissions        uint64
+	PreviewEmissions uint64
+
+	// The estimated lovelace value of the LP the owner has locked as of the snapshot
+	LockedLovelace        uint64
+	PreviewLockedLovelace uint64
+
+	// The estimated annual return on the owners locked LP, as a fraction (0.05 is 5%), assuming todays emissions every day of the year;
+	// zero if the owner has nothing locked, or there is no way to price the emitted asset
+	APR        float64
+	PreviewAPR float64
+}
+
+type Preview struct {
+	Baseline CalculationOutputs
+	Scenario CalculationOutputs
+
+	// Every pool that was ranked or received emissions in either calculation, ordered by their rank under the scenario
+	Pools []PoolPreview
+	Owner OwnerPreview
+}
+
+// Apply the scenario to the positions, without modifying them
+func (s Scenario) Apply(positions []types.Position) []types.Position {
+	removed := map[string]bool{}
+	for _, txHash := range s.Removed {
+		removed[txHash] = true
+	}
+	var applied []types.Position
+	for _, position := range positions {
+		if !removed[position.TransactionHash] {
+			applied = append(applied, position)
+		}
+	}
+	return append(applied, s.Added...)
+}
+
+// Run the days calculation both with and without the scenario applied, and report the difference it makes
+// to the ranking and emissions of each pool, and to the emissions and APR of the scenarios owner
+func PreviewScenario(
+	ctx context.Context,
+	date types.Date,
+	startSlot uint64,
+	endSlot uint64,
+	program types.YieldProgram,
+	previousResults []CalculationOutputs,
+	positions []types.Position,
+	poolLookup types.PoolLookup,
+	scenario Scenario,
+	opts ...Option,
+) (Preview, error) {
+	scenarioPositions := scenario.Apply(positions)
+
+	baseline, err := CalculateEarnings(ctx, date, startSlot, endSlot, program, previousResults, positions, poolLookup, opts...)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to calculate baseline: %w", err)
+	}
+	preview, err := CalculateEarnings(ctx, date, startSlot, endSlot, program, previousResults, scenarioPositions, poolLookup, opts...)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to calculate scenario: %w", err)
+	}
+
+	pools, err := comparePools(ctx, baseline, preview, poolLookup)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	owner := OwnerPreview{
+		Emissions:        baseline.EmissionsByOwner[scenario.OwnerID],
+		PreviewEmissions: preview.EmissionsByOwner[scenario.OwnerID],
+	}
+	owner.LockedLovelace, err = ownerLockedLovelace(ctx, scenario.OwnerID, positions, endSlot, baseline, poolLookup)
+	if err != nil {
+		return Preview{}, err
+	}
+	owner.PreviewLockedLovelace, err = ownerLockedLovelace(ctx, scenario.OwnerID, scenarioPositions, endSlot, preview, poolLookup)
+	if err != nil {
+		return Preview{}, err
+	}
+	owner.APR = estimateAPR(baseline, owner.Emissions, owner.LockedLovelace)
+	owner.PreviewAPR = estimateAPR(preview, owner.PreviewEmissions, owner.PreviewLockedLovelace)
+
+	return Preview{
+		Baseline: baseline,
+		Scenario: preview,
+		Pools:    pools,
+		Owner:    owner,
+	}, nil
+}
+
+func comparePools(ctx context.Context, baseline CalculationOutputs, preview CalculationOutputs, poolLookup types.PoolLookup) ([]PoolPreview, error) {
+	byPool := map[string]*PoolPreview{}
+	get := func(poolIdent string) *PoolPreview {
+		if _, ok := byPool[poolIdent]; !ok {
+			byPool[poolIdent] = &PoolPreview{PoolIdent: poolIdent}
+		}
+		return byPool[poolIdent]
+	}
+
+	baselineRanks, _, err := rankCandidates(ctx, baseline.DelegationOverWindowByPool, poolLookup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank baseline pools: %w", err)
+	}
+	for rank, candidate := range baselineRanks {
+		pool := get(candidate.PoolIdent)
+		pool.Rank = rank + 1
+		pool.DelegationOverWindow = candidate.Total
+	}
+	previewRanks, _, err := rankCandidates(ctx, preview.DelegationOverWindowByPool, poolLookup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank scenario pools: %w", err)
+	}
+	for rank, candidate := range previewRanks {
+		pool := get(candidate.PoolIdent)
+		pool.PreviewRank = rank + 1
+		pool.PreviewDelegationOverWindow = candidate.Total
+	}
+
+	for poolIdent, amount := range baseline.EmissionsByPool {
+		get(poolIdent).Emissions = amount
+	}
+	for poolIdent := range baseline.PoolsEligibleForEmissions {
+		get(poolIdent).Selected = true
+	}
+	for poolIdent, amount := range preview.EmissionsByPool {
+		get(poolIdent).PreviewEmissions = amount
+	}
+	for poolIdent := range preview.PoolsEligibleForEmissions {
+		get(poolIdent).PreviewSelected = true
+	}
+
+	var pools []PoolPreview
+	for _, pool := range byPool {
+		pools = append(pools, *pool)
+	}
+	// Ranked pools first, in rank order, then any unranked pools by ident
+	sort.Slice(pools, func(i, j int) bool {
+		if (pools[i].PreviewRank == 0) != (pools[j].PreviewRank == 0) {
+			return pools[i].PreviewRank != 0
+		}
+		if pools[i].PreviewRank != pools[j].PreviewRank {
+			return pools[i].PreviewRank < pools[j].PreviewRank
+		}
+		return pools[i].PoolIdent < pools[j].PoolIdent
+	})
+	return pools, nil
+}
+
+// Value the owners LP tokens that are locked as of the snapshot, at the same per-pool price as the calculation used
+func ownerLockedLovelace(ctx context.Context, ownerID string, positions []types.Position, maxSlot uint64, outputs CalculationOutputs, poolLookup types.PoolLookup) (uint64, error) {
+	lockedLovelace := uint64(0)
+	for _, position := range positions {
+		if position.OwnerID != ownerID || !activeAtSnapshot(position, maxSlot) {
+			continue
+		}
+		valueByPool, err := EstimatePositionLovelaceByPool(ctx, position, outputs, poolLookup)
+		if err != nil {
+			return 0, err
+		}
+		for _, value := range valueByPool {
+			lockedLovelace += value
+		}
+	}
+	return lockedLovelace, nil
+}
+
+// Annualize the owners daily emissions, priced at the average price the calculation valued the days emissions at
+func estimateAPR(outputs CalculationOutputs, ownerEmissions uint64, lockedLovelace uint64) float64 {
+	if lockedLovelace == 0 || outputs.TotalEmissions == 0 {
+		return 0
+	}
+	emittedLovelace := big.NewRat(0, 1).SetFrac(
+		big.NewInt(0).Mul(big.NewInt(0).SetUint64(ownerEmissions), big.NewInt(0).SetUint64(outputs.EstimatedEmissionsLovelaceValue)),
+		big.NewInt(0).SetUint64(outputs.TotalEmissions),
+	)
+	apr, _ := emittedLovelace.Mul(emittedLovelace, big.NewRat(365, 1)).Quo(emittedLovelace, big.NewRat(0, 1).SetUint64(lockedLovelace)).Float64()
+	return apr
+}
@@ -0,0 +1,63 @@
+package yield
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_PreviewScenario(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	program.ConsecutiveDelegationWindow = 1
+	program.MaxPoolCount = 1
+	program.ReferencePool = "00"
+	pools := utilities.MockLookup{
+		"00": {PoolIdent: "00", LPAsset: "LP_00", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: program.EmittedAsset, AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "Y", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	withLP := func(position types.Position, lpToken shared.AssetID) types.Position {
+		value := shared.Value(position.Value)
+		value.AddAsset(shared.Coin{AssetId: lpToken, Amount: num.Uint64(100)})
+		position.Value = compatibility.CompatibleValue(value)
+		return position
+	}
+	positions := []types.Position{
+		withLP(utilities.SamplePosition("A", 100, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1}), "LP_01"),
+		withLP(utilities.SamplePosition("B", 200, types.Delegation{Program: program.ID, PoolIdent: "02", Weight: 1}), "LP_02"),
+	}
+	positions[0].TransactionHash = "A1"
+	positions[1].TransactionHash = "B1"
+
+	// What if A delegates another 200 to their pool?
+	added := utilities.SamplePosition("A", 200, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1})
+	added.TransactionHash = "A2"
+	scenario := Scenario{OwnerID: "A", Added: []types.Position{added}}
+	preview, err := PreviewScenario(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, pools, scenario)
+	assert.Nil(t, err)
+
+	assert.EqualValues(t, []PoolPreview{
+		{PoolIdent: "01", Rank: 2, PreviewRank: 1, Selected: false, PreviewSelected: true, DelegationOverWindow: 100, PreviewDelegationOverWindow: 300, Emissions: 0, PreviewEmissions: 1000},
+		{PoolIdent: "02", Rank: 1, PreviewRank: 2, Selected: true, PreviewSelected: false, DelegationOverWindow: 200, PreviewDelegationOverWindow: 200, Emissions: 1000, PreviewEmissions: 0},
+	}, preview.Pools)
+	assert.EqualValues(t, 0, preview.Owner.Emissions)
+	assert.EqualValues(t, 1000, preview.Owner.PreviewEmissions)
+	assert.EqualValues(t, 200, preview.Owner.LockedLovelace)
+	assert.EqualValues(t, 200, preview.Owner.PreviewLockedLovelace)
+	assert.EqualValues(t, 0, preview.Owner.APR)
+	// 1000 lovelace a day, on 200 lovelace of LP
+	assert.InDelta(t, 1825, preview.Owner.PreviewAPR, 0.0001)
+
+	// Removing B's position hands A the emissions without A doing anything
+	preview, err = PreviewScenario(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, pools, Scenario{OwnerID: "A", Removed: []string{"B1"}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1000, preview.Owner.PreviewEmissions)
+	assert.EqualValues(t, 0, preview.Pools[1].PreviewRank)
+	assert.EqualValues(t, 2, len(positions))
+}
@@ -0,0 +1,67 @@
+package yield
+
+import (
+	"fmt"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// The digest of the outputs, ignoring the timestamp, so that re-running a calculation over the same inputs gives the same digest;
+// since the outputs embed the digests of their inputs, this also commits to everything they were calculated from
+func (o CalculationOutputs) Digest() (string, error) {
+	o.Timestamp = ""
+	digest, err := types.Digest(o)
+	if err != nil {
+		return "", fmt.Errorf("failed to digest outputs: %w", err)
+	}
+	return digest, nil
+}
+
+// The digest of the delegation window; unlike the positions, the order matters, so this is the digest of each days digest, oldest first
+func DigestPreviousResults(previousResults []CalculationOutputs) (string, error) {
+	digests := []string{}
+	for _, outputs := range previousResults {
+		digest, err := outputs.Digest()
+		if err != nil {
+			return "", err
+		}
+		digests = append(digests, digest)
+	}
+	return types.Digest(digests)
+}
+
+// Digest the inputs that are known up front; the positions and pools are only known once the calculation has read them
+func digestInputs(program types.YieldProgram, previousResults []CalculationOutputs) (types.InputDigests, error) {
+	var inputs types.InputDigests
+	var err error
+	if inputs.Program, err = types.Digest(program); err != nil {
+		return types.InputDigests{}, fmt.Errorf("failed to digest program: %w", err)
+	}
+	if inputs.PreviousResults, err = DigestPreviousResults(previousResults); err != nil {
+		return types.InputDigests{}, fmt.Errorf("failed to digest previous results: %w", err)
+	}
+	return inputs, nil
+}
+
+// Check a rerun against the outputs that were published for the same day; a rerun over different inputs is reported with
+// the inputs that changed, and a rerun over the same inputs must reproduce the same outputs exactly
+func VerifyRerun(published CalculationOutputs, rerun CalculationOutputs) error {
+	if published.ProgramID != rerun.ProgramID || published.Date != rerun.Date {
+		return fmt.Errorf("rerun of %v on %v doesn't match outputs for %v on %v", rerun.ProgramID, rerun.Date, published.ProgramID, published.Date)
+	}
+	if err := published.Inputs.Verify(rerun.Inputs); err != nil {
+		return fmt.Errorf("rerun of %v on %v was %w", rerun.ProgramID, rerun.Date, err)
+	}
+	publishedDigest, err := published.Digest()
+	if err != nil {
+		return err
+	}
+	rerunDigest, err := rerun.Digest()
+	if err != nil {
+		return err
+	}
+	if publishedDigest != rerunDigest {
+		return fmt.Errorf("rerun of %v on %v gave different outputs from the same inputs: %v, not %v", rerun.ProgramID, rerun.Date, rerunDigest, publishedDigest)
+	}
+	return nil
+}
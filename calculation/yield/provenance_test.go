@@ -0,0 +1,80 @@
+package yield
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_InputDigests(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	program.FirstDailyRewards = "2024-01-01"
+	program.ConsecutiveDelegationWindow = 2
+	program.MaxPoolCount = 1
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "Y", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	positions := []types.Position{
+		utilities.SamplePosition("A", 100, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1}),
+		utilities.SamplePosition("B", 200, types.Delegation{Program: program.ID, PoolIdent: "02", Weight: 1}),
+	}
+	for i, lpToken := range []shared.AssetID{"LP_01", "LP_02"} {
+		value := shared.Value(positions[i].Value)
+		value.AddAsset(shared.Coin{AssetId: lpToken, Amount: num.Uint64(100)})
+		positions[i].Value = compatibility.CompatibleValue(value)
+	}
+	calculate := func(date types.Date, program types.YieldProgram, previous []CalculationOutputs, positions []types.Position, pools types.PoolLookup) CalculationOutputs {
+		outputs, err := CalculateEarnings(context.Background(), date, 0, 86400, program, previous, positions, pools)
+		assert.Nil(t, err)
+		return outputs
+	}
+	first := calculate("2024-01-01", program, nil, positions, pools)
+	published := calculate("2024-01-02", program, []CalculationOutputs{first}, positions, pools)
+
+	programDigest, err := types.Digest(program)
+	assert.Nil(t, err)
+	positionsDigest, err := types.DigestPositions(positions)
+	assert.Nil(t, err)
+	previousDigest, err := DigestPreviousResults([]CalculationOutputs{first})
+	assert.Nil(t, err)
+	assert.EqualValues(t, programDigest, published.Inputs.Program)
+	assert.EqualValues(t, positionsDigest, published.Inputs.Positions)
+	assert.EqualValues(t, previousDigest, published.Inputs.PreviousResults)
+	assert.NotEmpty(t, published.Inputs.Pools)
+
+	// Rerunning over the same inputs, fetched in a different order, reproduces the outputs
+	rerun := calculate("2024-01-02", program, []CalculationOutputs{first}, []types.Position{positions[1], positions[0]}, pools)
+	assert.Nil(t, VerifyRerun(published, rerun))
+
+	// A rerun with a different pool state is caught
+	changedPools := utilities.MockLookup{"01": pools["01"], "02": pools["02"]}
+	changedPool := changedPools["02"]
+	changedPool.AssetAQuantity = 2000
+	changedPools["02"] = changedPool
+	rerun = calculate("2024-01-02", program, []CalculationOutputs{first}, positions, changedPools)
+	assert.EqualError(t, VerifyRerun(published, rerun), "rerun of "+program.ID+" on 2024-01-02 was calculated from different pools")
+
+	// As is one with a different history
+	changedFirst := first
+	changedFirst.DelegationByPool = map[string]uint64{"01": 1000}
+	rerun = calculate("2024-01-02", program, []CalculationOutputs{changedFirst}, positions, pools)
+	assert.EqualError(t, VerifyRerun(published, rerun), "rerun of "+program.ID+" on 2024-01-02 was calculated from different previous results")
+
+	// Or a different program
+	changedProgram := program
+	changedProgram.MaxPoolCount = 2
+	rerun = calculate("2024-01-02", changedProgram, []CalculationOutputs{first}, positions, pools)
+	assert.EqualError(t, VerifyRerun(published, rerun), "rerun of "+program.ID+" on 2024-01-02 was calculated from different program")
+
+	// And outputs that don't follow from their inputs are caught too
+	tampered := published
+	tampered.EmissionsByPool = map[string]uint64{"01": 1000}
+	assert.NotNil(t, VerifyRerun(published, tampered))
+}
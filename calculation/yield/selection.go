@@ -0,0 +1,261 @@
+package yield
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// Everything a pool selector might need to decide which pools receive emissions
+type PoolSelectionInputs struct {
+	// The qualifying delegation to each pool, summed over the delegation window
+	DelegationByPool map[string]uint64
+	// The estimated lovelace value of the LP locked for each pool, as of the snapshot
+	EstimatedLockedLovelaceByPool map[string]uint64
+
+	PoolLookup types.PoolLookup
+}
+
+// A strategy for choosing which pools receive emissions
+type PoolSelector interface {
+	// Returns the weight that each selected pool should receive emissions in proportion to,
+	// and for every candidate pool, the reason it was or wasn't selected
+	SelectPools(ctx context.Context, program types.YieldProgram, inputs PoolSelectionInputs) (map[string]uint64, map[string]string, error)
+}
+
+// Find the pool selector the program is configured to use
+func PoolSelectorForProgram(program types.YieldProgram) (PoolSelector, error) {
+	switch program.PoolSelectionStrategy {
+	case types.PoolSelectionTopPools, "":
+		return TopPoolsSelector{}, nil
+	case types.PoolSelectionMinimumDelegation:
+		return MinimumDelegationSelector{}, nil
+	case types.PoolSelectionMinimumLockedLovelace:
+		return MinimumLockedLovelaceSelector{}, nil
+	case types.PoolSelectionRankedDecay:
+		return RankedDecaySelector{}, nil
+	case types.PoolSelectionAll:
+		return AllPoolsSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unrecognized pool selection strategy %v", program.PoolSelectionStrategy)
+	}
+}
+
+type candidate struct {
+	PoolIdent string
+	Total     uint64
+}
+
+// Order the pools by delegation, largest first
+func rankCandidates(ctx context.Context, delegationsByPool map[string]uint64, poolLookup types.PoolLookup) ([]candidate, uint64, error) {
+	var candidates []candidate
+
+	totalDelegation := uint64(0)
+	for poolIdent, amt := range delegationsByPool {
+		if poolIdent == "" {
+			continue
+		}
+		totalDelegation += amt
+		candidates = append(candidates, candidate{PoolIdent: poolIdent, Total: amt})
+	}
+
+	var errs []error
+	sort.Slice(candidates, func(i, j int) bool {
+		// In the case of an exact tie (very unlikely), prefer the one with less liquidity
+		// under the hypothesis that less liquidity needs to attract more liquidity providers
+		// (technically wasn't part of the spec, and so we make a reasonable choice)
+		if candidates[i].Total == candidates[j].Total {
+			poolI, err := poolLookup.PoolByIdent(ctx, candidates[i].PoolIdent)
+			if err != nil {
+				errs = append(errs, err)
+				return false
+			}
+			poolJ, err := poolLookup.PoolByIdent(ctx, candidates[j].PoolIdent)
+			if err != nil {
+				errs = append(errs, err)
+				return false
+			}
+			iLP := poolI.TotalLPTokens
+			jLP := poolJ.TotalLPTokens
+			if iLP == jLP {
+				return candidates[i].PoolIdent < candidates[j].PoolIdent
+			}
+			return iLP < jLP
+		}
+		return candidates[i].Total > candidates[j].Total
+	})
+	if len(errs) > 0 {
+		return nil, 0, fmt.Errorf("failed to sort candidates; %v errors; first error: %w", len(errs), errs[0])
+	}
+	return candidates, totalDelegation, nil
+}
+
+func isNepotismPool(program types.YieldProgram, poolIdent string) bool {
+	for _, pool := range program.NepotismPools {
+		if pool == poolIdent {
+			return true
+		}
+	}
+	return false
+}
+
+// The default strategy: the nepotism pools, plus either the top N pools or the top covering percent, whichever is fewer
+type TopPoolsSelector struct{}
+
+func (TopPoolsSelector) SelectPools(ctx context.Context, program types.YieldProgram, inputs PoolSelectionInputs) (map[string]uint64, map[string]string, error) {
+	candidates, totalDelegation, err := rankCandidates(ctx, inputs.DelegationByPool, inputs.PoolLookup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	poolsReceivingEmissionsByIdent := map[string]uint64{}
+	reasons := map[string]string{}
+	totalQualifyingDelegation := uint64(0)
+
+	// Ensure the nepotism pools (like ADA/SUNDAE) are always selected for emissions
+	for _, pool := range program.NepotismPools {
+		for rank, delegation := range candidates {
+			if delegation.PoolIdent == pool {
+				poolsReceivingEmissionsByIdent[pool] = delegation.Total
+				totalQualifyingDelegation += delegation.Total
+				reasons[pool] = fmt.Sprintf("Ranked %v of %v by delegation; always selected as a nepotism pool", rank+1, len(candidates))
+			}
+		}
+	}
+
+	// Then select either the top N pools, or the top covering percent,
+	// whichever is fewer
+	cutoff := ""
+	for rank, delegation := range candidates {
+		// Don't re-add any nepotistic pools
+		if _, ok := poolsReceivingEmissionsByIdent[delegation.PoolIdent]; ok {
+			continue
+		}
+		if cutoff != "" {
+			reasons[delegation.PoolIdent] = fmt.Sprintf("Ranked %v of %v by delegation; not selected, %v", rank+1, len(candidates), cutoff)
+			continue
+		}
+		poolsReceivingEmissionsByIdent[delegation.PoolIdent] = delegation.Total
+		totalQualifyingDelegation += delegation.Total
+		reasons[delegation.PoolIdent] = fmt.Sprintf("Ranked %v of %v by delegation; selected among the top pools", rank+1, len(candidates))
+		if len(poolsReceivingEmissionsByIdent) == program.MaxPoolCount {
+			cutoff = fmt.Sprintf("already selected the maximum of %v pools", program.MaxPoolCount)
+		} else if atLeastIntegerPercent(totalQualifyingDelegation, totalDelegation, program.MaxPoolIntegerPercent) {
+			cutoff = fmt.Sprintf("the pools above already cover %v%% of delegation", program.MaxPoolIntegerPercent)
+		}
+	}
+
+	return poolsReceivingEmissionsByIdent, reasons, nil
+}
+
+// Select the nepotism pools, plus every pool with at least MinPoolDelegation delegated to it over the window
+type MinimumDelegationSelector struct{}
+
+func (MinimumDelegationSelector) SelectPools(ctx context.Context, program types.YieldProgram, inputs PoolSelectionInputs) (map[string]uint64, map[string]string, error) {
+	candidates, _, err := rankCandidates(ctx, inputs.DelegationByPool, inputs.PoolLookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := map[string]uint64{}
+	reasons := map[string]string{}
+	for rank, delegation := range candidates {
+		prefix := fmt.Sprintf("Ranked %v of %v by delegation; %v delegated", rank+1, len(candidates), delegation.Total)
+		if isNepotismPool(program, delegation.PoolIdent) {
+			selected[delegation.PoolIdent] = delegation.Total
+			reasons[delegation.PoolIdent] = prefix + "; always selected as a nepotism pool"
+		} else if delegation.Total >= program.MinPoolDelegation {
+			selected[delegation.PoolIdent] = delegation.Total
+			reasons[delegation.PoolIdent] = fmt.Sprintf("%v; selected, at least the minimum of %v", prefix, program.MinPoolDelegation)
+		} else {
+			reasons[delegation.PoolIdent] = fmt.Sprintf("%v; not selected, less than the minimum of %v", prefix, program.MinPoolDelegation)
+		}
+	}
+	return selected, reasons, nil
+}
+
+// Select the nepotism pools, plus every pool with at least MinPoolLockedLovelace worth of LP locked
+type MinimumLockedLovelaceSelector struct{}
+
+func (MinimumLockedLovelaceSelector) SelectPools(ctx context.Context, program types.YieldProgram, inputs PoolSelectionInputs) (map[string]uint64, map[string]string, error) {
+	candidates, _, err := rankCandidates(ctx, inputs.DelegationByPool, inputs.PoolLookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := map[string]uint64{}
+	reasons := map[string]string{}
+	for rank, delegation := range candidates {
+		locked := inputs.EstimatedLockedLovelaceByPool[delegation.PoolIdent]
+		prefix := fmt.Sprintf("Ranked %v of %v by delegation; an estimated %v lovelace locked", rank+1, len(candidates), locked)
+		if isNepotismPool(program, delegation.PoolIdent) {
+			selected[delegation.PoolIdent] = delegation.Total
+			reasons[delegation.PoolIdent] = prefix + "; always selected as a nepotism pool"
+		} else if locked >= program.MinPoolLockedLovelace {
+			selected[delegation.PoolIdent] = delegation.Total
+			reasons[delegation.PoolIdent] = fmt.Sprintf("%v; selected, at least the minimum of %v", prefix, program.MinPoolLockedLovelace)
+		} else {
+			reasons[delegation.PoolIdent] = fmt.Sprintf("%v; not selected, less than the minimum of %v", prefix, program.MinPoolLockedLovelace)
+		}
+	}
+	return selected, reasons, nil
+}
+
+// Select the nepotism pools, plus the top MaxPoolCount pools (or every pool, if 0),
+// reducing the weight of each pool by RankDecayIntegerPercent for each rank below the first
+type RankedDecaySelector struct{}
+
+func (RankedDecaySelector) SelectPools(ctx context.Context, program types.YieldProgram, inputs PoolSelectionInputs) (map[string]uint64, map[string]string, error) {
+	if program.RankDecayIntegerPercent < 0 || program.RankDecayIntegerPercent > 100 {
+		return nil, nil, fmt.Errorf("rank decay of %v%% is out of range", program.RankDecayIntegerPercent)
+	}
+	candidates, _, err := rankCandidates(ctx, inputs.DelegationByPool, inputs.PoolLookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := map[string]uint64{}
+	reasons := map[string]string{}
+	count := 0
+	// Track the decay as a fraction, so we only round once per pool
+	numerator := big.NewInt(1)
+	denominator := big.NewInt(1)
+	for rank, delegation := range candidates {
+		prefix := fmt.Sprintf("Ranked %v of %v by delegation", rank+1, len(candidates))
+		nepotism := isNepotismPool(program, delegation.PoolIdent)
+		if nepotism || program.MaxPoolCount == 0 || count < program.MaxPoolCount {
+			weight := big.NewInt(0).SetUint64(delegation.Total)
+			weight = weight.Mul(weight, numerator)
+			weight = weight.Div(weight, denominator)
+			selected[delegation.PoolIdent] = weight.Uint64()
+			if nepotism {
+				reasons[delegation.PoolIdent] = fmt.Sprintf("%v; always selected as a nepotism pool, weight decayed from %v to %v", prefix, delegation.Total, weight.Uint64())
+			} else {
+				count += 1
+				reasons[delegation.PoolIdent] = fmt.Sprintf("%v; selected, weight decayed from %v to %v", prefix, delegation.Total, weight.Uint64())
+			}
+		} else {
+			reasons[delegation.PoolIdent] = fmt.Sprintf("%v; not selected, already selected the maximum of %v pools", prefix, program.MaxPoolCount)
+		}
+		numerator = numerator.Mul(numerator, big.NewInt(int64(100-program.RankDecayIntegerPercent)))
+		denominator = denominator.Mul(denominator, big.NewInt(100))
+	}
+	return selected, reasons, nil
+}
+
+// Select every pool that qualified for emissions
+type AllPoolsSelector struct{}
+
+func (AllPoolsSelector) SelectPools(ctx context.Context, program types.YieldProgram, inputs PoolSelectionInputs) (map[string]uint64, map[string]string, error) {
+	candidates, _, err := rankCandidates(ctx, inputs.DelegationByPool, inputs.PoolLookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := map[string]uint64{}
+	reasons := map[string]string{}
+	for rank, delegation := range candidates {
+		selected[delegation.PoolIdent] = delegation.Total
+		reasons[delegation.PoolIdent] = fmt.Sprintf("Ranked %v of %v by delegation; every qualifying pool is selected", rank+1, len(candidates))
+	}
+	return selected, reasons, nil
+}
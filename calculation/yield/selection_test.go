@@ -0,0 +1,115 @@
+package yield
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_PoolSelectorForProgram(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	selector, err := PoolSelectorForProgram(program)
+	assert.Nil(t, err)
+	assert.IsType(t, TopPoolsSelector{}, selector)
+
+	program.PoolSelectionStrategy = types.PoolSelectionRankedDecay
+	selector, err = PoolSelectorForProgram(program)
+	assert.Nil(t, err)
+	assert.IsType(t, RankedDecaySelector{}, selector)
+
+	program.PoolSelectionStrategy = "Bogus"
+	_, err = PoolSelectorForProgram(program)
+	assert.NotNil(t, err)
+}
+
+func Test_TopPoolsSelectionReasons(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	program.NepotismPools = []string{"A"}
+	program.MaxPoolCount = 2
+	program.MaxPoolIntegerPercent = 100
+	pools := utilities.MockLookup{"A": types.Pool{}, "B": types.Pool{}, "C": types.Pool{}}
+	selected, reasons, err := TopPoolsSelector{}.SelectPools(context.Background(), program, PoolSelectionInputs{
+		DelegationByPool: map[string]uint64{"": 1000, "A": 100, "B": 200, "C": 300},
+		PoolLookup:       pools,
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 100, "C": 300}, selected)
+	assert.EqualValues(t, map[string]string{
+		"A": "Ranked 3 of 3 by delegation; always selected as a nepotism pool",
+		"B": "Ranked 2 of 3 by delegation; not selected, already selected the maximum of 2 pools",
+		"C": "Ranked 1 of 3 by delegation; selected among the top pools",
+	}, reasons)
+}
+
+func Test_MinimumDelegationSelector(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	program.MinPoolDelegation = 200
+	program.NepotismPools = []string{"A"}
+	pools := utilities.MockLookup{"A": types.Pool{}, "B": types.Pool{}, "C": types.Pool{}, "D": types.Pool{}}
+	selected, reasons, err := MinimumDelegationSelector{}.SelectPools(context.Background(), program, PoolSelectionInputs{
+		DelegationByPool: map[string]uint64{"A": 50, "B": 199, "C": 200, "D": 300},
+		PoolLookup:       pools,
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 50, "C": 200, "D": 300}, selected)
+	assert.Len(t, reasons, 4)
+	assert.EqualValues(t, "Ranked 3 of 4 by delegation; 199 delegated; not selected, less than the minimum of 200", reasons["B"])
+}
+
+func Test_MinimumLockedLovelaceSelector(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	program.MinPoolLockedLovelace = 1_000
+	pools := utilities.MockLookup{"A": types.Pool{}, "B": types.Pool{}, "C": types.Pool{}}
+	selected, reasons, err := MinimumLockedLovelaceSelector{}.SelectPools(context.Background(), program, PoolSelectionInputs{
+		DelegationByPool:              map[string]uint64{"A": 100, "B": 200, "C": 300},
+		EstimatedLockedLovelaceByPool: map[string]uint64{"A": 5_000, "B": 999},
+		PoolLookup:                    pools,
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 100}, selected)
+	assert.EqualValues(t, "Ranked 1 of 3 by delegation; an estimated 0 lovelace locked; not selected, less than the minimum of 1000", reasons["C"])
+}
+
+func Test_RankedDecaySelector(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	program.RankDecayIntegerPercent = 50
+	program.MaxPoolCount = 2
+	pools := utilities.MockLookup{"A": types.Pool{}, "B": types.Pool{}, "C": types.Pool{}, "D": types.Pool{}}
+	inputs := PoolSelectionInputs{
+		DelegationByPool: map[string]uint64{"A": 1000, "B": 800, "C": 500, "D": 100},
+		PoolLookup:       pools,
+	}
+	selected, reasons, err := RankedDecaySelector{}.SelectPools(context.Background(), program, inputs)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 1000, "B": 400}, selected)
+	assert.EqualValues(t, "Ranked 2 of 4 by delegation; selected, weight decayed from 800 to 400", reasons["B"])
+
+	program.NepotismPools = []string{"C"}
+	selected, _, err = RankedDecaySelector{}.SelectPools(context.Background(), program, inputs)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 1000, "B": 400, "C": 125}, selected)
+
+	program.MaxPoolCount = 0
+	selected, _, err = RankedDecaySelector{}.SelectPools(context.Background(), program, inputs)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 1000, "B": 400, "C": 125, "D": 12}, selected)
+
+	program.RankDecayIntegerPercent = 101
+	_, _, err = RankedDecaySelector{}.SelectPools(context.Background(), program, inputs)
+	assert.NotNil(t, err)
+}
+
+func Test_AllPoolsSelector(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	pools := utilities.MockLookup{"A": types.Pool{}, "B": types.Pool{}}
+	selected, reasons, err := AllPoolsSelector{}.SelectPools(context.Background(), program, PoolSelectionInputs{
+		DelegationByPool: map[string]uint64{"": 1000, "A": 100, "B": 200},
+		PoolLookup:       pools,
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"A": 100, "B": 200}, selected)
+	assert.Len(t, reasons, 2)
+}
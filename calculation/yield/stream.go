@@ -0,0 +1,102 @@
+package yield
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// Everything about the positions that can be totalled up one position at a time
+type PositionTotals struct {
+	NumPositions int
+
+	DelegationByPool map[string]uint64
+	TotalDelegations uint64
+
+	LPDaysByOwner map[string]map[shared.AssetID]uint64
+	LPDaysByAsset map[shared.AssetID]uint64
+
+	// The LP locked as of maxSlot, priced with the programs reference pools
+	LPSnapshot LPSnapshot
+
+	OwnersByID map[string]types.MultisigScript
+}
+
+// Total up the delegation to each pool, the LP token days of each owner, and the LP locked at the snapshot, in a single
+// pass over the positions, without holding them all in memory; the results are the same as TotalPositions
+func AccumulatePositions(
+	ctx context.Context,
+	program types.YieldProgram,
+	source types.PositionSource,
+	poolLookup types.PoolLookup,
+	minSlot uint64,
+	maxSlot uint64,
+	opts ...Option,
+) (PositionTotals, error) {
+	o := applyOptions(opts)
+	totals := PositionTotals{
+		DelegationByPool: map[string]uint64{},
+		LPDaysByOwner:    map[string]map[shared.AssetID]uint64{},
+		LPDaysByAsset:    map[shared.AssetID]uint64{},
+		OwnersByID:       map[string]types.MultisigScript{},
+	}
+	lpSnapshot := newLPAccumulator(ctx, maxSlot, program.ReferencePools, poolLookup, newSnapshotGraph(ctx, poolLookup), o)
+	err := types.ForEachPosition(ctx, source, func(position types.Position) error {
+		totals.NumPositions += 1
+		totals.OwnersByID[position.OwnerID] = position.Owner
+		addPositionLPDays(position, poolLookup, minSlot, maxSlot, totals.LPDaysByOwner, totals.LPDaysByAsset)
+		if err := lpSnapshot.add(position); err != nil {
+			return err
+		}
+		if program.StakedAsset == "" {
+			return nil
+		}
+		return delegatePosition(ctx, program, position, poolLookup, o, totals.DelegationByPool)
+	})
+	if err != nil {
+		return PositionTotals{}, err
+	}
+
+	// Programs without a staked asset split delegation evenly between their eligible pools
+	if program.StakedAsset == "" {
+		for _, pool := range program.EligiblePools {
+			totals.DelegationByPool[pool] = 1
+		}
+	}
+	for _, amt := range totals.DelegationByPool {
+		totals.TotalDelegations += amt
+	}
+	if totals.LPSnapshot, err = lpSnapshot.finish(); err != nil {
+		return PositionTotals{}, err
+	}
+	return totals, nil
+}
+
+// Total up positions that are already in memory, across as many workers as the options allow
+func TotalPositions(
+	ctx context.Context,
+	program types.YieldProgram,
+	positions []types.Position,
+	poolLookup types.PoolLookup,
+	minSlot uint64,
+	maxSlot uint64,
+	opts ...Option,
+) (PositionTotals, error) {
+	totals := PositionTotals{NumPositions: len(positions), OwnersByID: map[string]types.MultisigScript{}}
+	var err error
+	totals.DelegationByPool, totals.TotalDelegations, err = CalculateTotalDelegations(ctx, program, positions, poolLookup, opts...)
+	if err != nil {
+		return PositionTotals{}, fmt.Errorf("failed to calculate total delegations: %w", err)
+	}
+	totals.LPSnapshot, err = CalculateLPSnapshot(ctx, maxSlot, positions, program.ReferencePools, poolLookup, opts...)
+	if err != nil {
+		return PositionTotals{}, fmt.Errorf("failed to calculate total LP: %w", err)
+	}
+	totals.LPDaysByOwner, totals.LPDaysByAsset = TotalLPDaysByOwnerAndAsset(positions, poolLookup, minSlot, maxSlot, opts...)
+	for _, position := range positions {
+		totals.OwnersByID[position.OwnerID] = position.Owner
+	}
+	return totals, nil
+}
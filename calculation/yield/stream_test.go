@@ -0,0 +1,100 @@
+package yield
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_AccumulatePositions(t *testing.T) {
+	r := rand.New(rand.NewSource(*seed))
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	for trial := 0; trial < 5; trial++ {
+		positions, pools := randomPositions(r, program, r.Intn(2000)+1, r.Intn(300)+1, r.Intn(100)+1)
+		msg := fmt.Sprintf("seed %v, trial %v", *seed, trial)
+
+		delegationByPool, totalDelegations, err := CalculateTotalDelegations(context.Background(), program, positions, pools)
+		assert.Nil(t, err, msg)
+		lpDaysByOwner, lpDaysByAsset := TotalLPDaysByOwnerAndAsset(positions, pools, 0, 86400)
+		lpSnapshot, err := CalculateLPSnapshot(context.Background(), 86400, positions, program.ReferencePools, pools)
+		assert.Nil(t, err, msg)
+
+		totals, err := AccumulatePositions(context.Background(), program, types.NewSlicePositionSource(positions), pools, 0, 86400)
+		assert.Nil(t, err, msg)
+		assert.Equal(t, len(positions), totals.NumPositions, msg)
+		assert.Equal(t, delegationByPool, totals.DelegationByPool, msg)
+		assert.Equal(t, totalDelegations, totals.TotalDelegations, msg)
+		assert.Equal(t, lpDaysByOwner, totals.LPDaysByOwner, msg)
+		assert.Equal(t, lpDaysByAsset, totals.LPDaysByAsset, msg)
+		assert.Equal(t, lpSnapshot, totals.LPSnapshot, msg)
+
+		// Reading the same positions back from a file gives the same totals
+		var file bytes.Buffer
+		encoder := json.NewEncoder(&file)
+		for _, position := range positions {
+			assert.Nil(t, encoder.Encode(position))
+		}
+		streamed, err := AccumulatePositions(context.Background(), program, types.NewJSONPositionSource(&file), pools, 0, 86400)
+		assert.Nil(t, err, msg)
+		assert.Equal(t, totals, streamed, msg)
+
+		// As does totalling them up in memory
+		inMemory, err := TotalPositions(context.Background(), program, positions, pools, 0, 86400, WithConcurrency(4))
+		assert.Nil(t, err, msg)
+		assert.Equal(t, totals, inMemory, msg)
+	}
+}
+
+func Test_CalculateEarningsFromSource(t *testing.T) {
+	r := rand.New(rand.NewSource(*seed))
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.ConsecutiveDelegationWindow = 1
+	for trial := 0; trial < 5; trial++ {
+		positions, pools := randomPositions(r, program, r.Intn(2000)+1, r.Intn(300)+1, r.Intn(100)+1)
+		msg := fmt.Sprintf("seed %v, trial %v", *seed, trial)
+
+		expected, err := CalculateEarnings(context.Background(), "2024-01-01", 0, 86400, program, nil, positions, pools)
+		assert.Nil(t, err, msg)
+
+		var file bytes.Buffer
+		encoder := json.NewEncoder(&file)
+		for _, position := range positions {
+			assert.Nil(t, encoder.Encode(position))
+		}
+		streamed, err := CalculateEarningsFromSource(context.Background(), "2024-01-01", 0, 86400, program, nil, types.NewJSONPositionSource(&file), pools)
+		assert.Nil(t, err, msg)
+		expected.Timestamp, streamed.Timestamp = "", ""
+		assert.Equal(t, expected, streamed, msg)
+	}
+
+	// Days outside the program don't read the positions at all
+	outputs, err := CalculateEarningsFromSource(context.Background(), "2000-01-01", 0, 86400, program, nil, types.NewJSONPositionSource(bytes.NewBufferString("not json")), utilities.MockLookup{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, CalculationOutputs{Date: "2000-01-01", ProgramID: program.ID}, outputs)
+}
+
+func Test_AccumulatePositions_NoStakedAsset(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.StakedAsset = ""
+	program.EligiblePools = []string{"01", "02"}
+	positions := []types.Position{
+		{OwnerID: "A", Value: makeValue("LP_01", 100)},
+	}
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	totals, err := AccumulatePositions(context.Background(), program, types.NewSlicePositionSource(positions), pools, 0, 86400)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"01": 1, "02": 1}, totals.DelegationByPool)
+	assert.EqualValues(t, 2, totals.TotalDelegations)
+	assert.EqualValues(t, 100, totals.LPDaysByAsset["LP_01"])
+	assert.EqualValues(t, 200, totals.LPSnapshot.EstimatedLovelace)
+}
@@ -0,0 +1,102 @@
+package yield
+
+import (
+	"fmt"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// An itemized breakdown of the daily emissions that were not emitted to any owner, and so revert to the treasury
+type TreasuryReturns struct {
+	// The amount above the emission cap that was truncated from each pool
+	CapOverflowByPool map[string]uint64
+	// The emissions that had no qualifying pool to be distributed to
+	NoEligiblePools uint64
+	// The emissions allocated to a pool, but which couldn't be distributed to any owner of that pools LP tokens
+	OrphanedDust uint64
+
+	Total uint64
+}
+
+// Reconcile the emissions at each stage of the calculation against the daily emissions, to account for every token returned to the treasury
+func CalculateTreasuryReturns(
+	program types.YieldProgram,
+	untruncatedEmissionsByPool map[string]uint64,
+	capOverflowByPool map[string]uint64,
+	emissionsByPool map[string]uint64,
+	totalEmissions uint64,
+) TreasuryReturns {
+	returns := TreasuryReturns{CapOverflowByPool: map[string]uint64{}}
+
+	allocated := uint64(0)
+	for _, amount := range untruncatedEmissionsByPool {
+		allocated += amount
+	}
+	if allocated < program.DailyEmission {
+		returns.NoEligiblePools = program.DailyEmission - allocated
+	}
+
+	capOverflow := uint64(0)
+	for poolIdent, amount := range capOverflowByPool {
+		if amount == 0 {
+			continue
+		}
+		returns.CapOverflowByPool[poolIdent] = amount
+		capOverflow += amount
+	}
+
+	capped := uint64(0)
+	for _, amount := range emissionsByPool {
+		capped += amount
+	}
+	if capped+capOverflow != allocated {
+		panic(fmt.Sprintf("capped emissions (%v) and overflow (%v) don't add up to the allocated emissions (%v), somehow", capped, capOverflow, allocated))
+	}
+	if totalEmissions > capped {
+		panic(fmt.Sprintf("emitted %v to owners, which is more than the %v allocated to pools, somehow", totalEmissions, capped))
+	}
+	returns.OrphanedDust = capped - totalEmissions
+
+	returns.Total = returns.NoEligiblePools + capOverflow + returns.OrphanedDust
+	return returns
+}
+
+type TreasuryLedgerEntry struct {
+	Date    types.Date
+	Returns TreasuryReturns
+}
+
+// A running record, across days, of the emissions that a program returned to the treasury
+type TreasuryLedger struct {
+	Program string
+	Entries []TreasuryLedgerEntry
+
+	TotalCapOverflow     uint64
+	TotalNoEligiblePools uint64
+	TotalOrphanedDust    uint64
+	Total                uint64
+}
+
+// Add a days treasury returns to the ledger; days must be recorded in order, and only once
+func (l *TreasuryLedger) Record(program types.YieldProgram, date types.Date, returns TreasuryReturns) error {
+	if l.Program == "" {
+		l.Program = program.ID
+	} else if l.Program != program.ID {
+		return fmt.Errorf("ledger is for program %v, cannot record returns for program %v", l.Program, program.ID)
+	}
+	if len(l.Entries) > 0 {
+		last := l.Entries[len(l.Entries)-1].Date
+		if date <= last {
+			return fmt.Errorf("cannot record treasury returns for %v, ledger already has an entry for %v", date, last)
+		}
+	}
+
+	l.Entries = append(l.Entries, TreasuryLedgerEntry{Date: date, Returns: returns})
+	for _, amount := range returns.CapOverflowByPool {
+		l.TotalCapOverflow += amount
+	}
+	l.TotalNoEligiblePools += returns.NoEligiblePools
+	l.TotalOrphanedDust += returns.OrphanedDust
+	l.Total += returns.Total
+	return nil
+}
@@ -0,0 +1,82 @@
+package yield
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_TreasuryReturns(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000_000_000)
+	program.EmissionCap = 200_000_000_000
+	program.FixedEmissions = map[string]uint64{
+		"C": 1_000_000_000,
+	}
+	rawEmissions := DistributeEmissionsToPools(program, map[string]uint64{
+		"A": 1000,
+		"B": 2000,
+	})
+	truncatedEmissions, overflow := CapEmissions(program, nil, rawEmissions)
+	returns := CalculateTreasuryReturns(program, rawEmissions, overflow, truncatedEmissions, 367_333_333_333-100)
+	assert.EqualValues(t, map[string]uint64{"B": 132_666_666_667}, returns.CapOverflowByPool)
+	assert.EqualValues(t, 0, returns.NoEligiblePools)
+	assert.EqualValues(t, 100, returns.OrphanedDust)
+	assert.EqualValues(t, 500_000_000_000-367_333_333_333+100, returns.Total)
+
+	// Only fixed emissions were allocated, so the rest had no pool to go to
+	rawEmissions = DistributeEmissionsToPools(program, map[string]uint64{})
+	truncatedEmissions, overflow = CapEmissions(program, nil, rawEmissions)
+	returns = CalculateTreasuryReturns(program, rawEmissions, overflow, truncatedEmissions, 1_000_000_000)
+	assert.Empty(t, returns.CapOverflowByPool)
+	assert.EqualValues(t, 499_000_000_000, returns.NoEligiblePools)
+	assert.EqualValues(t, 0, returns.OrphanedDust)
+	assert.EqualValues(t, 499_000_000_000, returns.Total)
+
+	// Nothing was allocated at all
+	returns = CalculateTreasuryReturns(program, nil, nil, nil, 0)
+	assert.EqualValues(t, 500_000_000_000, returns.NoEligiblePools)
+	assert.EqualValues(t, 500_000_000_000, returns.Total)
+}
+
+func Test_TreasuryLedger(t *testing.T) {
+	program := utilities.SampleYieldProgram(500_000)
+	ledger := TreasuryLedger{}
+	assert.Nil(t, ledger.Record(program, "2023-01-01", TreasuryReturns{CapOverflowByPool: map[string]uint64{"A": 10, "B": 20}, Total: 30}))
+	assert.Nil(t, ledger.Record(program, "2023-01-02", TreasuryReturns{NoEligiblePools: 500_000, Total: 500_000}))
+	assert.Nil(t, ledger.Record(program, "2023-01-04", TreasuryReturns{OrphanedDust: 3, Total: 3}))
+	assert.EqualValues(t, program.ID, ledger.Program)
+	assert.Len(t, ledger.Entries, 3)
+	assert.EqualValues(t, 30, ledger.TotalCapOverflow)
+	assert.EqualValues(t, 500_000, ledger.TotalNoEligiblePools)
+	assert.EqualValues(t, 3, ledger.TotalOrphanedDust)
+	assert.EqualValues(t, 500_033, ledger.Total)
+
+	// Days must be recorded in order, and only once
+	assert.NotNil(t, ledger.Record(program, "2023-01-04", TreasuryReturns{}))
+	assert.NotNil(t, ledger.Record(program, "2023-01-03", TreasuryReturns{}))
+
+	// And only for one program
+	other := utilities.SampleYieldProgram(500_000)
+	other.ID = "Other"
+	assert.NotNil(t, ledger.Record(other, "2023-01-05", TreasuryReturns{}))
+	assert.Len(t, ledger.Entries, 3)
+	assert.EqualValues(t, 500_033, ledger.Total)
+}
+
+func Test_CapOverflowPolicy_Unrecognized(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	for _, policy := range []types.CapOverflowPolicy{"", types.CapOverflowTreasury, types.CapOverflowRedistribute} {
+		program.CapOverflowPolicy = policy
+		assert.Nil(t, ValidateCapOverflowPolicy(program), policy)
+	}
+
+	// A typo in the program is an error for the calculation, rather than a panic part way through it
+	program.CapOverflowPolicy = "Redistibute"
+	assert.NotNil(t, ValidateCapOverflowPolicy(program))
+	_, err := CalculateEarnings(context.Background(), program.FirstDailyRewards, 0, 86400, program, nil, nil, utilities.MockLookup{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Redistibute")
+}
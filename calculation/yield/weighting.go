@@ -0,0 +1,101 @@
+package yield
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// A curve that determines the weight each selected pool receives emissions in proportion to
+type PoolWeightingCurve interface {
+	// Given the weight each pool was selected with (usually its delegation), and the estimated lovelace value locked in each pool,
+	// returns the weight to split the emissions by
+	WeighPools(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, estimatedLockedLovelaceByPool map[string]uint64) (map[string]uint64, error)
+}
+
+// Find the weighting curve the program is configured to use
+func PoolWeightingCurveForProgram(program types.YieldProgram) (PoolWeightingCurve, error) {
+	switch program.EmissionWeighting {
+	case types.EmissionWeightingLinear, "":
+		return LinearWeighting{}, nil
+	case types.EmissionWeightingSquareRoot:
+		return SquareRootWeighting{}, nil
+	case types.EmissionWeightingLockedLovelace:
+		return LockedLovelaceWeighting{}, nil
+	case types.EmissionWeightingBlend:
+		return BlendWeighting{}, nil
+	default:
+		return nil, fmt.Errorf("unrecognized emission weighting curve %v", program.EmissionWeighting)
+	}
+}
+
+// Weigh each pool by its delegation, unchanged
+type LinearWeighting struct{}
+
+func (LinearWeighting) WeighPools(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, estimatedLockedLovelaceByPool map[string]uint64) (map[string]uint64, error) {
+	weights := map[string]uint64{}
+	for poolIdent, weight := range poolsEligibleForEmissionsByIdent {
+		weights[poolIdent] = weight
+	}
+	return weights, nil
+}
+
+// Weigh each pool by the square root of its delegation, rounding down
+type SquareRootWeighting struct{}
+
+func (SquareRootWeighting) WeighPools(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, estimatedLockedLovelaceByPool map[string]uint64) (map[string]uint64, error) {
+	weights := map[string]uint64{}
+	for poolIdent, weight := range poolsEligibleForEmissionsByIdent {
+		weights[poolIdent] = big.NewInt(0).Sqrt(big.NewInt(0).SetUint64(weight)).Uint64()
+	}
+	return weights, nil
+}
+
+// Weigh each pool by the estimated lovelace value locked in it; a pool with no locked value receives no dynamic emissions
+type LockedLovelaceWeighting struct{}
+
+func (LockedLovelaceWeighting) WeighPools(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, estimatedLockedLovelaceByPool map[string]uint64) (map[string]uint64, error) {
+	weights := map[string]uint64{}
+	for poolIdent := range poolsEligibleForEmissionsByIdent {
+		weights[poolIdent] = estimatedLockedLovelaceByPool[poolIdent]
+	}
+	return weights, nil
+}
+
+// Since delegation and locked value are in different units, we blend each pool's *share* of them;
+// this is the fixed point precision we represent those shares with
+const blendPrecision = 1_000_000_000_000
+
+// Weigh each pool by BlendDelegationIntegerPercent of its share of delegation, plus the rest from its share of the locked value
+type BlendWeighting struct{}
+
+func (BlendWeighting) WeighPools(program types.YieldProgram, poolsEligibleForEmissionsByIdent map[string]uint64, estimatedLockedLovelaceByPool map[string]uint64) (map[string]uint64, error) {
+	if program.BlendDelegationIntegerPercent < 0 || program.BlendDelegationIntegerPercent > 100 {
+		return nil, fmt.Errorf("blend of %v%% delegation is out of range", program.BlendDelegationIntegerPercent)
+	}
+	totalDelegation := big.NewInt(0)
+	totalLocked := big.NewInt(0)
+	for poolIdent, weight := range poolsEligibleForEmissionsByIdent {
+		totalDelegation = totalDelegation.Add(totalDelegation, big.NewInt(0).SetUint64(weight))
+		totalLocked = totalLocked.Add(totalLocked, big.NewInt(0).SetUint64(estimatedLockedLovelaceByPool[poolIdent]))
+	}
+
+	// Only round once per term, so the shares are as precise as possible
+	share := func(amount uint64, percent int, total *big.Int) *big.Int {
+		if total.Sign() == 0 {
+			return big.NewInt(0)
+		}
+		frac := big.NewInt(0).SetUint64(amount)
+		frac = frac.Mul(frac, big.NewInt(int64(percent)))
+		frac = frac.Mul(frac, big.NewInt(blendPrecision))
+		return frac.Div(frac, total)
+	}
+	weights := map[string]uint64{}
+	for poolIdent, weight := range poolsEligibleForEmissionsByIdent {
+		delegationShare := share(weight, program.BlendDelegationIntegerPercent, totalDelegation)
+		lockedShare := share(estimatedLockedLovelaceByPool[poolIdent], 100-program.BlendDelegationIntegerPercent, totalLocked)
+		weights[poolIdent] = delegationShare.Add(delegationShare, lockedShare).Uint64()
+	}
+	return weights, nil
+}
@@ -0,0 +1,118 @@
+package yields
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+const DaysPerYear = 365
+
+// The estimated yield of a pool, from the lovelace value of what was emitted to it over the value of the LP locked for it
+type PoolYield struct {
+	PoolIdent string
+
+	// How many days contributed to the estimate; days when the pool had no locked value are left out
+	Days int
+	// The estimated lovelace value emitted to the pool, summed over those days
+	EmittedLovelace uint64
+	// The estimated lovelace value locked for the pool, summed over those days
+	LockedLovelace uint64
+
+	// The average return on each lovelace locked for a day, as a fraction (0.001 is 0.1%)
+	DailyRate float64
+	// The daily rate, times the days in a year
+	APR float64
+	// The daily rate, compounded daily for a year
+	APY float64
+}
+
+// Estimate the yield of each pool, smoothed over (at most) the last `days` days of history, which is ordered oldest first;
+// the rate is the total emitted over the total locked, so each day counts in proportion to its locked value.
+// A pool that never had anything locked has no meaningful yield, and is left out
+func EstimatePoolYields(history []yield.CalculationOutputs, days int) map[string]PoolYield {
+	if days > 0 && len(history) > days {
+		history = history[len(history)-days:]
+	}
+	emitted := map[string]*big.Int{}
+	locked := map[string]*big.Int{}
+	numDays := map[string]int{}
+	for _, outputs := range history {
+		for poolIdent, lockedLovelace := range outputs.EstimatedLockedLovelaceByPool {
+			if lockedLovelace == 0 {
+				continue
+			}
+			if _, ok := locked[poolIdent]; !ok {
+				emitted[poolIdent] = big.NewInt(0)
+				locked[poolIdent] = big.NewInt(0)
+			}
+			locked[poolIdent].Add(locked[poolIdent], big.NewInt(0).SetUint64(lockedLovelace))
+			emitted[poolIdent].Add(emitted[poolIdent], big.NewInt(0).SetUint64(outputs.EstimatedEmissionsLovelaceByPool[poolIdent]))
+			numDays[poolIdent] += 1
+		}
+	}
+
+	yields := map[string]PoolYield{}
+	for poolIdent := range locked {
+		dailyRate, _ := big.NewRat(0, 1).SetFrac(emitted[poolIdent], locked[poolIdent]).Float64()
+		yields[poolIdent] = PoolYield{
+			PoolIdent:       poolIdent,
+			Days:            numDays[poolIdent],
+			EmittedLovelace: emitted[poolIdent].Uint64(),
+			LockedLovelace:  locked[poolIdent].Uint64(),
+			DailyRate:       dailyRate,
+			APR:             dailyRate * DaysPerYear,
+			APY:             math.Pow(1+dailyRate, DaysPerYear) - 1,
+		}
+	}
+	return yields
+}
+
+// The estimated yield of a single position, blended from the yields of the pools it holds LP for
+type PositionYield struct {
+	// The estimated lovelace value of the LP in the position, at the prices of the latest calculation
+	LockedLovelace uint64
+	// The estimated value of the LP for each pool
+	LockedLovelaceByPool map[string]uint64
+
+	// The pool yields, weighted by the value the position holds in each pool
+	DailyRate float64
+	APR       float64
+	APY       float64
+}
+
+// Blend the pool yields into a yield for the position, weighting each pool by the value of the positions LP for that pool.
+// Only the LP in the position earns emissions, so any other assets (like the staked asset) aren't counted;
+// a position without any LP that can be valued has a yield of 0
+func EstimatePositionYield(ctx context.Context, position types.Position, latest yield.CalculationOutputs, poolYields map[string]PoolYield, poolLookup types.PoolLookup) (PositionYield, error) {
+	valueByPool, err := yield.EstimatePositionLovelaceByPool(ctx, position, latest, poolLookup)
+	if err != nil {
+		return PositionYield{}, err
+	}
+
+	// Sum in a consistent order, so the floating point result is reproducible
+	var poolIdents []string
+	for poolIdent := range valueByPool {
+		poolIdents = append(poolIdents, poolIdent)
+	}
+	sort.Strings(poolIdents)
+
+	result := PositionYield{LockedLovelaceByPool: valueByPool}
+	weightedRate := 0.0
+	for _, poolIdent := range poolIdents {
+		value := valueByPool[poolIdent]
+		result.LockedLovelace += value
+		weightedRate += float64(value) * poolYields[poolIdent].DailyRate
+	}
+	if result.LockedLovelace == 0 {
+		return result, nil
+	}
+	result.DailyRate = weightedRate / float64(result.LockedLovelace)
+	result.APR = result.DailyRate * DaysPerYear
+	result.APY = math.Pow(1+result.DailyRate, DaysPerYear) - 1
+	return result, nil
+}
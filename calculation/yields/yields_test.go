@@ -0,0 +1,89 @@
+package yields
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/tj/assert"
+)
+
+func Test_EstimatePoolYields(t *testing.T) {
+	history := []yield.CalculationOutputs{
+		{
+			EstimatedLockedLovelaceByPool:    map[string]uint64{"01": 1_000_000, "02": 500_000},
+			EstimatedEmissionsLovelaceByPool: map[string]uint64{"01": 9_000},
+		},
+		{
+			EstimatedLockedLovelaceByPool:    map[string]uint64{"01": 1_000_000, "02": 0, "03": 0},
+			EstimatedEmissionsLovelaceByPool: map[string]uint64{"01": 1_000, "02": 100, "03": 100},
+		},
+		{
+			EstimatedLockedLovelaceByPool:    map[string]uint64{"01": 3_000_000, "02": 1_000_000},
+			EstimatedEmissionsLovelaceByPool: map[string]uint64{"01": 3_000, "02": 2_000},
+		},
+	}
+
+	// Over the last two days, the days with more locked count for more
+	yields := EstimatePoolYields(history, 2)
+	assert.EqualValues(t, 2, yields["01"].Days)
+	assert.EqualValues(t, 4_000, yields["01"].EmittedLovelace)
+	assert.EqualValues(t, 4_000_000, yields["01"].LockedLovelace)
+	assert.InDelta(t, 0.001, yields["01"].DailyRate, 1e-12)
+	assert.InDelta(t, 0.365, yields["01"].APR, 1e-12)
+	assert.InDelta(t, math.Pow(1.001, 365)-1, yields["01"].APY, 1e-12)
+
+	// Days with nothing locked are left out, rather than dividing by zero
+	assert.EqualValues(t, 1, yields["02"].Days)
+	assert.InDelta(t, 0.002, yields["02"].DailyRate, 1e-12)
+	_, ok := yields["03"]
+	assert.False(t, ok)
+
+	// With no limit, every day counts
+	yields = EstimatePoolYields(history, 0)
+	assert.EqualValues(t, 3, yields["01"].Days)
+	assert.InDelta(t, 13_000.0/5_000_000, yields["01"].DailyRate, 1e-12)
+	assert.EqualValues(t, 2, yields["02"].Days)
+
+	assert.Len(t, EstimatePoolYields(nil, 5), 0)
+}
+
+func Test_EstimatePositionYield(t *testing.T) {
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "X", AssetAQuantity: 1000, AssetBQuantity: 1000},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: "Y", AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	latest := yield.CalculationOutputs{
+		LockedLPByPool:                map[string]uint64{"01": 100, "02": 400},
+		EstimatedLockedLovelaceByPool: map[string]uint64{"01": 200, "02": 800},
+	}
+	poolYields := map[string]PoolYield{
+		"01": {PoolIdent: "01", DailyRate: 0.001},
+		"02": {PoolIdent: "02", DailyRate: 0.004},
+	}
+
+	position := utilities.SamplePosition("A", 1_000_000)
+	value := shared.Value(position.Value)
+	value.AddAsset(shared.Coin{AssetId: "LP_01", Amount: num.Uint64(100)})
+	value.AddAsset(shared.Coin{AssetId: "LP_02", Amount: num.Uint64(50)})
+	position.Value = compatibility.CompatibleValue(value)
+
+	positionYield, err := EstimatePositionYield(context.Background(), position, latest, poolYields, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"01": 200, "02": 100}, positionYield.LockedLovelaceByPool)
+	assert.EqualValues(t, 300, positionYield.LockedLovelace)
+	// Two thirds at 0.1%, one third at 0.4%
+	assert.InDelta(t, 0.002, positionYield.DailyRate, 1e-12)
+	assert.InDelta(t, 0.73, positionYield.APR, 1e-12)
+
+	// The staked asset alone doesn't earn anything
+	positionYield, err = EstimatePositionYield(context.Background(), utilities.SamplePosition("A", 1_000_000), latest, poolYields, pools)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, positionYield.LockedLovelace)
+	assert.EqualValues(t, 0, positionYield.APR)
+}
@@ -0,0 +1,313 @@
+package consolidation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/owner"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/txbuilder"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// Marks the positions that are spent by the consolidation, when estimating its effect
+const consolidationTransaction = "CONSOLIDATION"
+
+// Stake that isn't delegated to any pool would be delegated by the consolidation; a position either delegates all of its
+// stake for a program or none of it, so undelegated stake can't be kept apart once it's merged
+const WarningUndelegatedStake types.WarningCode = "UndelegatedStake"
+
+// How the delegation to a pool changes, for one program; PoolIdent is empty for stake that isn't delegated at all
+type DelegationEffect struct {
+	Program   string
+	PoolIdent string
+	Before    uint64
+	After     uint64
+}
+
+// How the owner's LP token days change, for one LP token
+type LPDaysEffect struct {
+	Asset  shared.AssetID
+	Before uint64
+	After  uint64
+}
+
+// A proposal to merge an owner's positions into one
+type Plan struct {
+	OwnerID string
+	Owner   types.MultisigScript
+	// The transactions that locked the positions to merge
+	Positions []string
+	// Everything the positions hold, which is locked again in the merged position
+	Value       shared.Value
+	Delegations []types.Delegation
+
+	// The owner's delegation at the end of the day, with and without the consolidation, for each of the programs
+	Delegation []DelegationEffect
+	// The owner's LP token days for the day the consolidation lands in, with and without it
+	LPDays []LPDaysEffect
+	// Anything about the consolidation the owner might not expect
+	Warnings []types.Warning
+}
+
+// Plan merging an owner's positions, as of slot, into one position with the given delegations; with no delegations,
+// they're merged so each program's stake is delegated to the same pools, in the same proportions, as before (stake
+// that wasn't delegated at all is delegated along with the rest, which the plan warns about).
+// Positions that are already spent, or locked after slot, are left alone. The effect is estimated for the day from
+// startSlot to endSlot, which the consolidation is expected to land in.
+func PlanConsolidation(
+	ctx context.Context,
+	startSlot uint64,
+	endSlot uint64,
+	slot uint64,
+	programs []types.YieldProgram,
+	positions []types.Position,
+	poolLookup types.PoolLookup,
+	delegations []types.Delegation,
+) (Plan, error) {
+	if startSlot >= endSlot {
+		return Plan{}, fmt.Errorf("the day from slot %v to %v is empty", startSlot, endSlot)
+	}
+	var live []types.Position
+	var plan Plan
+	for _, position := range positions {
+		ownerID, err := owner.ID(position.Owner)
+		if err != nil {
+			return Plan{}, err
+		}
+		if plan.OwnerID == "" {
+			plan.OwnerID, plan.Owner = ownerID, position.Owner
+		} else if ownerID != plan.OwnerID {
+			return Plan{}, fmt.Errorf("position %v is owned by %v, not %v", position.TransactionHash, ownerID, plan.OwnerID)
+		}
+		if !consolidates(position, slot) {
+			continue
+		}
+		live = append(live, position)
+		plan.Positions = append(plan.Positions, position.TransactionHash)
+		plan.Value = shared.Add(plan.Value, shared.Value(position.Value))
+	}
+	if len(live) == 0 {
+		return Plan{}, fmt.Errorf("no unspent positions to consolidate as of slot %v", slot)
+	}
+
+	plan.Delegations = delegations
+	if plan.Delegations == nil {
+		merged, err := MergeDelegations(ctx, programs, live, poolLookup)
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Delegations = merged
+	}
+
+	consolidated := types.Position{
+		OwnerID:    plan.OwnerID,
+		Owner:      plan.Owner,
+		Slot:       slot,
+		Value:      compatibility.CompatibleValue(plan.Value),
+		Delegation: plan.Delegations,
+	}
+	var err error
+	plan.Delegation, err = delegationEffects(ctx, programs, live, consolidated, poolLookup)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan.LPDays = lpDaysEffects(positions, consolidated, poolLookup, startSlot, endSlot, slot)
+	for _, effect := range plan.Delegation {
+		if effect.PoolIdent == "" && effect.After < effect.Before {
+			plan.Warnings = append(plan.Warnings, types.Warning{
+				Code:    WarningUndelegatedStake,
+				OwnerID: plan.OwnerID,
+				Message: fmt.Sprintf("%v staked for %v isn't delegated, but would be once merged", effect.Before-effect.After, effect.Program),
+			})
+		}
+	}
+	return plan, nil
+}
+
+// Whether the position can be spent by a consolidation at slot
+func consolidates(position types.Position, slot uint64) bool {
+	return position.SpentTransaction == "" && position.Slot <= slot
+}
+
+// Merge the delegations of several positions into one list. For programs with a staked asset, each pool is weighted by
+// the stake the positions delegate to it, so the merged position delegates the same way; any other program's weights
+// are simply added up
+func MergeDelegations(ctx context.Context, programs []types.YieldProgram, positions []types.Position, poolLookup types.PoolLookup) ([]types.Delegation, error) {
+	var merged []types.Delegation
+	byStake := map[string]bool{}
+	for _, program := range programs {
+		if program.StakedAsset == "" {
+			continue
+		}
+		byStake[program.ID] = true
+		stakeByPool, _, err := yield.CalculateTotalDelegations(ctx, program, positions, poolLookup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate delegation to %v: %w", program.ID, err)
+		}
+		// Undelegated stake is left out of the weights, so once merged it's delegated in the same proportions as the
+		// rest; PlanConsolidation warns about it
+		delete(stakeByPool, "")
+		weights := scaleWeights(stakeByPool)
+		if len(weights) == 0 {
+			// Delegated, but with nothing staked; keep the delegation as it was
+			byStake[program.ID] = false
+			continue
+		}
+		merged = append(merged, sortedDelegations(program.ID, weights)...)
+	}
+
+	weightsByProgram := map[string]map[string]uint64{}
+	for _, position := range positions {
+		for _, delegation := range position.Delegation {
+			if byStake[delegation.Program] {
+				continue
+			}
+			if _, ok := weightsByProgram[delegation.Program]; !ok {
+				weightsByProgram[delegation.Program] = map[string]uint64{}
+			}
+			weightsByProgram[delegation.Program][delegation.PoolIdent] += uint64(delegation.Weight)
+		}
+	}
+	var others []string
+	for program := range weightsByProgram {
+		others = append(others, program)
+	}
+	sort.Strings(others)
+	for _, program := range others {
+		merged = append(merged, sortedDelegations(program, scaleWeights(weightsByProgram[program]))...)
+	}
+	return merged, nil
+}
+
+func sortedDelegations(program string, weights map[string]uint32) []types.Delegation {
+	var delegations []types.Delegation
+	for poolIdent, weight := range weights {
+		delegations = append(delegations, types.Delegation{Program: program, PoolIdent: poolIdent, Weight: weight})
+	}
+	sort.Slice(delegations, func(i, j int) bool {
+		return delegations[i].PoolIdent < delegations[j].PoolIdent
+	})
+	return delegations
+}
+
+// Reduce amounts to weights that fit in a delegation, keeping their proportions as closely as possible; every
+// non-zero amount keeps a weight of at least 1
+func scaleWeights(amounts map[string]uint64) map[string]uint32 {
+	divisor := big.NewInt(0)
+	largest := uint64(0)
+	for _, amount := range amounts {
+		if amount == 0 {
+			continue
+		}
+		divisor.GCD(nil, nil, divisor, big.NewInt(0).SetUint64(amount))
+		if amount > largest {
+			largest = amount
+		}
+	}
+	weights := map[string]uint32{}
+	if largest == 0 {
+		return weights
+	}
+	scale := divisor.Uint64()
+	if largest/scale > math.MaxUint32 {
+		scale = (largest-1)/math.MaxUint32 + 1
+	}
+	for poolIdent, amount := range amounts {
+		if amount == 0 {
+			continue
+		}
+		// Round, rather than truncate, so small weights aren't pushed down further than large ones
+		weight := (amount + scale/2) / scale
+		if weight == 0 {
+			weight = 1
+		} else if weight > math.MaxUint32 {
+			weight = math.MaxUint32
+		}
+		weights[poolIdent] = uint32(weight)
+	}
+	return weights
+}
+
+func delegationEffects(ctx context.Context, programs []types.YieldProgram, live []types.Position, consolidated types.Position, poolLookup types.PoolLookup) ([]DelegationEffect, error) {
+	var effects []DelegationEffect
+	for _, program := range programs {
+		if program.StakedAsset == "" {
+			// Every eligible pool gets the same delegation, whatever the positions say
+			continue
+		}
+		before, _, err := yield.CalculateTotalDelegations(ctx, program, live, poolLookup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate delegation to %v: %w", program.ID, err)
+		}
+		after, _, err := yield.CalculateTotalDelegations(ctx, program, []types.Position{consolidated}, poolLookup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate delegation to %v: %w", program.ID, err)
+		}
+		var programEffects []DelegationEffect
+		for poolIdent, amount := range before {
+			programEffects = append(programEffects, DelegationEffect{Program: program.ID, PoolIdent: poolIdent, Before: amount, After: after[poolIdent]})
+		}
+		for poolIdent, amount := range after {
+			if _, ok := before[poolIdent]; !ok {
+				programEffects = append(programEffects, DelegationEffect{Program: program.ID, PoolIdent: poolIdent, After: amount})
+			}
+		}
+		sort.Slice(programEffects, func(i, j int) bool {
+			return programEffects[i].PoolIdent < programEffects[j].PoolIdent
+		})
+		effects = append(effects, programEffects...)
+	}
+	return effects, nil
+}
+
+// The positions are spent, and the consolidated position locked, in the same transaction, so the LP stays locked
+// throughout; any difference comes from rounding each position's share of the day separately
+func lpDaysEffects(positions []types.Position, consolidated types.Position, poolLookup types.PoolLookup, startSlot, endSlot, slot uint64) []LPDaysEffect {
+	_, before := yield.TotalLPDaysByOwnerAndAsset(positions, poolLookup, startSlot, endSlot)
+
+	var after []types.Position
+	for _, position := range positions {
+		if consolidates(position, slot) {
+			position.SpentTransaction = consolidationTransaction
+			position.SpentSlot = slot
+		}
+		after = append(after, position)
+	}
+	consolidated.TransactionHash = consolidationTransaction
+	_, afterByAsset := yield.TotalLPDaysByOwnerAndAsset(append(after, consolidated), poolLookup, startSlot, endSlot)
+
+	var effects []LPDaysEffect
+	for asset, lpDays := range before {
+		effects = append(effects, LPDaysEffect{Asset: asset, Before: lpDays, After: afterByAsset[asset]})
+	}
+	for asset, lpDays := range afterByAsset {
+		if _, ok := before[asset]; !ok {
+			effects = append(effects, LPDaysEffect{Asset: asset, After: lpDays})
+		}
+	}
+	sort.Slice(effects, func(i, j int) bool {
+		return effects[i].Asset < effects[j].Asset
+	})
+	return effects
+}
+
+// The re-delegation that carries out the plan, with the wallet paying the fees and receiving the lovelace that's
+// no longer needed to hold the merged positions
+func (p Plan) Request(ctx context.Context, builder *txbuilder.Builder, wallet string) (txbuilder.RedelegateRequest, error) {
+	refs, err := builder.PositionRefs(ctx, p.Positions)
+	if err != nil {
+		return txbuilder.RedelegateRequest{}, err
+	}
+	return txbuilder.RedelegateRequest{
+		Positions:            refs,
+		Delegations:          p.Delegations,
+		Wallet:               wallet,
+		ReturnExcessLovelace: true,
+	}, nil
+}
@@ -0,0 +1,171 @@
+package consolidation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/owner"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/txbuilder"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func withLP(position types.Position, lpToken shared.AssetID, amount uint64) types.Position {
+	value := shared.Value(position.Value)
+	value.AddAsset(shared.Coin{AssetId: lpToken, Amount: num.Uint64(amount)})
+	position.Value = compatibility.CompatibleValue(value)
+	return position
+}
+
+func Test_PlanConsolidation(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	pools := utilities.MockLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 1000, AssetA: shared.AdaAssetID, AssetB: program.StakedAsset, AssetAQuantity: 1000, AssetBQuantity: 1000},
+	}
+	positions := []types.Position{
+		withLP(utilities.SamplePosition("A", 300, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1}), "LP_01", 100),
+		withLP(utilities.SamplePosition("A", 100,
+			types.Delegation{Program: program.ID, PoolIdent: "02", Weight: 3},
+			types.Delegation{Program: "Other", PoolIdent: "05", Weight: 2},
+		), "LP_01", 101),
+		utilities.SampleTimedPosition("A", 1000, 0, 100, types.Delegation{Program: program.ID, PoolIdent: "03", Weight: 1}),
+		utilities.SamplePosition("A", 50,
+			types.Delegation{Program: "Other", PoolIdent: "05", Weight: 1},
+			types.Delegation{Program: "Other", PoolIdent: "06", Weight: 1},
+		),
+	}
+	for i := range positions {
+		positions[i].TransactionHash = fmt.Sprintf("A%v", i+1)
+	}
+	positions[3].Slot = 50_000
+
+	plan, err := PlanConsolidation(context.Background(), 0, 86400, 43200, []types.YieldProgram{program}, positions, pools, nil)
+	assert.Nil(t, err)
+	ownerID, err := owner.ID(positions[0].Owner)
+	assert.Nil(t, err)
+	assert.EqualValues(t, ownerID, plan.OwnerID)
+	assert.EqualValues(t, positions[0].Owner, plan.Owner)
+
+	// The spent position, and the one locked after the consolidation, are left alone
+	assert.EqualValues(t, []string{"A1", "A2"}, plan.Positions)
+	assert.EqualValues(t, 400, plan.Value.AssetAmount(program.StakedAsset).Int64())
+	assert.EqualValues(t, 201, plan.Value.AssetAmount("LP_01").Int64())
+
+	// Each pool is weighted by the stake delegated to it, including the stake in the LP
+	assert.EqualValues(t, []types.Delegation{
+		{Program: program.ID, PoolIdent: "01", Weight: 400},
+		{Program: program.ID, PoolIdent: "02", Weight: 201},
+		// Weights for other programs are added up, and reduced as far as they go
+		{Program: "Other", PoolIdent: "05", Weight: 1},
+	}, plan.Delegations)
+	// Which splits the merged stake exactly as before
+	assert.EqualValues(t, []DelegationEffect{
+		{Program: program.ID, PoolIdent: "01", Before: 400, After: 400},
+		{Program: program.ID, PoolIdent: "02", Before: 201, After: 201},
+	}, plan.Delegation)
+
+	// The LP is locked throughout, but each position's share of the day is rounded down separately
+	assert.EqualValues(t, []LPDaysEffect{{Asset: "LP_01", Before: 201, After: 200}}, plan.LPDays)
+	assert.Len(t, plan.Warnings, 0)
+}
+
+func Test_PlanConsolidation_Reweighted(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	positions := []types.Position{
+		utilities.SamplePosition("A", 300, types.Delegation{Program: program.ID, PoolIdent: "01", Weight: 1}),
+		utilities.SamplePosition("A", 100),
+	}
+	positions[0].TransactionHash = "A1"
+	positions[1].TransactionHash = "A2"
+	delegations := []types.Delegation{{Program: program.ID, PoolIdent: "02", Weight: 1}}
+	plan, err := PlanConsolidation(context.Background(), 0, 86400, 0, []types.YieldProgram{program}, positions, utilities.MockLookup{}, delegations)
+	assert.Nil(t, err)
+	assert.EqualValues(t, delegations, plan.Delegations)
+	// The undelegated stake is delegated too, once it's merged
+	assert.EqualValues(t, []DelegationEffect{
+		{Program: program.ID, PoolIdent: "", Before: 100, After: 0},
+		{Program: program.ID, PoolIdent: "01", Before: 300, After: 0},
+		{Program: program.ID, PoolIdent: "02", Before: 0, After: 400},
+	}, plan.Delegation)
+	assert.Equal(t, 0, len(plan.LPDays))
+	assert.Len(t, plan.Warnings, 1)
+	assert.EqualValues(t, WarningUndelegatedStake, plan.Warnings[0].Code)
+	assert.EqualValues(t, plan.OwnerID, plan.Warnings[0].OwnerID)
+
+	// Merging the delegations as they were can't keep it apart either, so it's delegated like the rest
+	plan, err = PlanConsolidation(context.Background(), 0, 86400, 0, []types.YieldProgram{program}, positions, utilities.MockLookup{}, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Delegation{{Program: program.ID, PoolIdent: "01", Weight: 1}}, plan.Delegations)
+	assert.EqualValues(t, []DelegationEffect{
+		{Program: program.ID, PoolIdent: "", Before: 100, After: 0},
+		{Program: program.ID, PoolIdent: "01", Before: 300, After: 400},
+	}, plan.Delegation)
+	assert.Len(t, plan.Warnings, 1)
+	assert.EqualValues(t, WarningUndelegatedStake, plan.Warnings[0].Code)
+	assert.Contains(t, plan.Warnings[0].Message, "100")
+}
+
+func Test_PlanConsolidation_Invalid(t *testing.T) {
+	program := utilities.SampleYieldProgram(1000)
+	programs := []types.YieldProgram{program}
+
+	_, err := PlanConsolidation(context.Background(), 0, 86400, 0, programs, []types.Position{
+		utilities.SamplePosition("A", 100),
+		utilities.SamplePosition("B", 100),
+	}, utilities.MockLookup{}, nil)
+	assert.NotNil(t, err)
+
+	_, err = PlanConsolidation(context.Background(), 0, 86400, 0, programs, []types.Position{
+		utilities.SampleTimedPosition("A", 100, 0, 10),
+	}, utilities.MockLookup{}, nil)
+	assert.NotNil(t, err)
+
+	_, err = PlanConsolidation(context.Background(), 86400, 86400, 86400, programs, []types.Position{
+		utilities.SamplePosition("A", 100),
+	}, utilities.MockLookup{}, nil)
+	assert.NotNil(t, err)
+}
+
+func Test_ScaleWeights(t *testing.T) {
+	assert.EqualValues(t, map[string]uint32{"a": 2, "b": 3}, scaleWeights(map[string]uint64{"a": 2_000_000, "b": 3_000_000, "c": 0}))
+	assert.EqualValues(t, map[string]uint32{}, scaleWeights(map[string]uint64{"a": 0}))
+
+	// Too large to fit, so the proportions are kept as closely as they can be
+	weights := scaleWeights(map[string]uint64{"a": 3 * math.MaxUint32, "b": math.MaxUint32 + 1, "c": 1})
+	assert.EqualValues(t, math.MaxUint32, weights["a"])
+	assert.EqualValues(t, math.MaxUint32/3, weights["b"])
+	assert.EqualValues(t, 1, weights["c"])
+}
+
+func Test_Request(t *testing.T) {
+	builder, err := txbuilder.NewBuilder(types.Testnet, types.PreprodSlotConfig, txbuilder.ProtocolParameters{}, nil)
+	assert.Nil(t, err)
+	freezer, err := builder.Freezer.Address(types.Testnet)
+	assert.Nil(t, err)
+	txHash := fmt.Sprintf("%064x", 1)
+	builder.UTxOs = txbuilder.UTxOProviderFunc(func(ctx context.Context, address string) ([]shared.Utxo, error) {
+		assert.EqualValues(t, freezer, address)
+		return []shared.Utxo{{Transaction: shared.UtxoTxID{ID: txHash}, Index: 2, Address: freezer}}, nil
+	})
+
+	delegations := []types.Delegation{{Program: "TestYield", PoolIdent: "01", Weight: 1}}
+	plan := Plan{Positions: []string{txHash}, Delegations: delegations}
+	request, err := plan.Request(context.Background(), builder, "wallet")
+	assert.Nil(t, err)
+	assert.EqualValues(t, txbuilder.RedelegateRequest{
+		Positions:            []txbuilder.Ref{{TxHash: txHash, Index: 2}},
+		Delegations:          delegations,
+		Wallet:               "wallet",
+		ReturnExcessLovelace: true,
+	}, request)
+
+	plan.Positions = append(plan.Positions, fmt.Sprintf("%064x", 2))
+	_, err = plan.Request(context.Background(), builder, "wallet")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,8 @@
+package freezer
+
+import _ "embed"
+
+// The compiled blueprint of the freezer contract, as built by aiken; see the blueprint package for reading it
+//
+//go:embed plutus.json
+var Blueprint []byte
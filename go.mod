@@ -5,20 +5,27 @@ go 1.20
 require (
 	github.com/SundaeSwap-finance/ogmigo/v6 v6.0.0-20240830011332-c632ed796f1d
 	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/prometheus/client_golang v1.18.0
 	github.com/tj/assert v0.0.3
+	go.etcd.io/bbolt v1.3.8
 	golang.org/x/crypto v0.0.0-20220314234659-1baeb1ce4c0b
 )
 
 require (
 	github.com/aws/aws-sdk-go v1.55.5 // indirect
-	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.45.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
 	github.com/stretchr/testify v1.8.1 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
-	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/sys v0.1.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,116 @@
+package owner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// The canonical OwnerID of an owner: the hex encoded hash of their script. A positions OwnerID is supplied by whoever
+// built the position, so nothing else stops it from disagreeing with the positions Owner
+func ID(owner types.MultisigScript) (string, error) {
+	hash, err := owner.Hash()
+	if err != nil {
+		return "", fmt.Errorf("failed to hash owner: %w", err)
+	}
+	return hash, nil
+}
+
+// The payment credential of an owner that's a single signature; any other script has no equivalent credential,
+// since the owner script is evaluated by the contract, rather than being a native script
+func Credential(owner types.MultisigScript) (types.Credential, bool) {
+	if owner.Signature == nil || owner.AllOf != nil || owner.AnyOf != nil || owner.AtLeast != nil || owner.Before != nil || owner.After != nil {
+		return types.Credential{}, false
+	}
+	return types.Credential{Kind: types.KeyCredential, Hash: owner.Signature.KeyHash}, true
+}
+
+// Every name an owner is known by
+type Identity struct {
+	// The canonical OwnerID; see ID
+	OwnerID string
+
+	// Only for single signature owners: the bech32 payment credential, and the enterprise address with that credential
+	Credential string
+	Address    string
+}
+
+// Resolve the identity of an owner, with any address on the given network
+func Resolve(owner types.MultisigScript, network types.Network) (Identity, error) {
+	ownerID, err := ID(owner)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity := Identity{OwnerID: ownerID}
+	credential, ok := Credential(owner)
+	if !ok {
+		return identity, nil
+	}
+	if identity.Credential, err = credential.Bech32(); err != nil {
+		return Identity{}, fmt.Errorf("invalid signature for owner %v: %w", ownerID, err)
+	}
+	if identity.Address, err = types.EnterpriseAddress(network, credential); err != nil {
+		return Identity{}, fmt.Errorf("invalid signature for owner %v: %w", ownerID, err)
+	}
+	return identity, nil
+}
+
+// Whether the ID is any of the owners names; the canonical OwnerID matches regardless of case
+func (i Identity) Matches(id string) bool {
+	if strings.EqualFold(id, i.OwnerID) {
+		return true
+	}
+	return id != "" && (id == i.Credential || id == i.Address)
+}
+
+// A position whose OwnerID isn't the canonical ID of its owner
+type Mismatch struct {
+	TransactionHash string
+	OwnerID         string
+	Expected        string
+	// Whether the OwnerID is another name for the same owner, such as their address, rather than someone else entirely
+	Alias bool
+}
+
+func (m Mismatch) Error() string {
+	if m.Alias {
+		return fmt.Sprintf("position %v is owned by %v, which should be keyed as %v", m.TransactionHash, m.OwnerID, m.Expected)
+	}
+	return fmt.Sprintf("position %v has OwnerID %v, but its owner is %v", m.TransactionHash, m.OwnerID, m.Expected)
+}
+
+// Find every position whose OwnerID isn't the canonical ID of its owner, in the order given
+func Mismatches(positions []types.Position, network types.Network) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	for _, position := range positions {
+		identity, err := Resolve(position.Owner, network)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve owner of position %v: %w", position.TransactionHash, err)
+		}
+		if position.OwnerID == identity.OwnerID {
+			continue
+		}
+		mismatches = append(mismatches, Mismatch{
+			TransactionHash: position.TransactionHash,
+			OwnerID:         position.OwnerID,
+			Expected:        identity.OwnerID,
+			Alias:           identity.Matches(position.OwnerID),
+		})
+	}
+	return mismatches, nil
+}
+
+// Copy the positions, keyed by the canonical ID of their owner, so that earnings are keyed consistently
+func Canonicalize(positions []types.Position) ([]types.Position, error) {
+	canonical := make([]types.Position, 0, len(positions))
+	for _, position := range positions {
+		ownerID, err := ID(position.Owner)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve owner of position %v: %w", position.TransactionHash, err)
+		}
+		position.OwnerID = ownerID
+		canonical = append(canonical, position)
+	}
+	return canonical, nil
+}
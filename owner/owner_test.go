@@ -0,0 +1,76 @@
+package owner
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func signature(keyHash string) types.MultisigScript {
+	bytes, _ := hex.DecodeString(keyHash)
+	return types.MultisigScript{Signature: &types.Signature{KeyHash: bytes}}
+}
+
+func Test_Resolve(t *testing.T) {
+	owner := signature("9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e")
+	hash, err := owner.Hash()
+	assert.Nil(t, err)
+
+	identity, err := Resolve(owner, types.Mainnet)
+	assert.Nil(t, err)
+	assert.EqualValues(t, hash, identity.OwnerID)
+	assert.EqualValues(t, "addr_vkh1jjfnzhxe966a33psfenm0ct2udkkr569qf55v4uprgkgu8zsvmg", identity.Credential)
+	assert.EqualValues(t, "addr1vx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzers66hrl8", identity.Address)
+	assert.True(t, identity.Matches(hash))
+	assert.True(t, identity.Matches(identity.Credential))
+	assert.True(t, identity.Matches(identity.Address))
+	assert.False(t, identity.Matches(""))
+	assert.False(t, identity.Matches("addr_test1vz2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzerspjrlsz"))
+
+	identity, err = Resolve(owner, types.Testnet)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "addr_test1vz2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzerspjrlsz", identity.Address)
+
+	// Anything more complicated than a single signature is only known by its hash
+	multisig := types.MultisigScript{AnyOf: &types.AnyOf{Scripts: []types.MultisigScript{owner, signature("337b62cfff6403a06a3acbc34f8c46003c69fe79a3628cefa9c47251")}}}
+	identity, err = Resolve(multisig, types.Mainnet)
+	assert.Nil(t, err)
+	multisigHash, err := multisig.Hash()
+	assert.Nil(t, err)
+	assert.EqualValues(t, Identity{OwnerID: multisigHash}, identity)
+
+	// A malformed signature can't be turned into an address
+	_, err = Resolve(signature("00"), types.Mainnet)
+	assert.NotNil(t, err)
+}
+
+func Test_Mismatches(t *testing.T) {
+	alice := signature("9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e")
+	bob := signature("337b62cfff6403a06a3acbc34f8c46003c69fe79a3628cefa9c47251")
+	aliceID, _ := ID(alice)
+	bobID, _ := ID(bob)
+	positions := []types.Position{
+		{TransactionHash: "1", OwnerID: aliceID, Owner: alice},
+		{TransactionHash: "2", OwnerID: "addr1vx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzers66hrl8", Owner: alice},
+		{TransactionHash: "3", OwnerID: aliceID, Owner: bob},
+	}
+	mismatches, err := Mismatches(positions, types.Mainnet)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []Mismatch{
+		{TransactionHash: "2", OwnerID: "addr1vx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzers66hrl8", Expected: aliceID, Alias: true},
+		{TransactionHash: "3", OwnerID: aliceID, Expected: bobID, Alias: false},
+	}, mismatches)
+	assert.EqualError(t, mismatches[1], "position 3 has OwnerID "+aliceID+", but its owner is "+bobID)
+
+	canonical, err := Canonicalize(positions)
+	assert.Nil(t, err)
+	assert.EqualValues(t, aliceID, canonical[1].OwnerID)
+	assert.EqualValues(t, bobID, canonical[2].OwnerID)
+	// The originals are left alone
+	assert.EqualValues(t, aliceID, positions[2].OwnerID)
+	mismatches, err = Mismatches(canonical, types.Mainnet)
+	assert.Nil(t, err)
+	assert.Empty(t, mismatches)
+}
@@ -0,0 +1,303 @@
+package owner
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+var ErrUnsatisfiable = errors.New("owner script can't be satisfied")
+
+// What a transaction spending from an owner can rely on
+type Constraints struct {
+	// The hex encoded key hashes that are able to sign; nil if any key in the script can sign
+	Keys []string
+	// How the scripts times map to slots
+	Slots types.SlotConfig
+	// The window the transaction has to be valid within, such as from the current slot to a time-to-live after it;
+	// From is inclusive, Until exclusive, and nil for no bound
+	From  *uint64
+	Until *uint64
+}
+
+// What a transaction has to do to satisfy an owner: who signs it, and the slots it's valid within
+type Satisfaction struct {
+	// The hex encoded key hashes that must sign, sorted
+	Signers []string
+	// From is inclusive, Until exclusive; a bound is only set if the script or the constraints need it
+	ValidFrom  *uint64
+	ValidUntil *uint64
+}
+
+// The slots a transaction is valid within; nil bounds are unbounded
+type interval struct {
+	from  *uint64
+	until *uint64
+}
+
+func (i interval) empty() bool {
+	return i.from != nil && i.until != nil && *i.from >= *i.until
+}
+
+func (i interval) contains(other interval) bool {
+	if i.from != nil && (other.from == nil || *other.from < *i.from) {
+		return false
+	}
+	if i.until != nil && (other.until == nil || *other.until > *i.until) {
+		return false
+	}
+	return true
+}
+
+func (i interval) intersect(other interval) interval {
+	result := i
+	if other.from != nil && (result.from == nil || *other.from > *result.from) {
+		result.from = other.from
+	}
+	if other.until != nil && (result.until == nil || *other.until < *result.until) {
+		result.until = other.until
+	}
+	return result
+}
+
+func (i interval) width() uint64 {
+	from, until := uint64(0), uint64(math.MaxUint64)
+	if i.from != nil {
+		from = *i.from
+	}
+	if i.until != nil {
+		until = *i.until
+	}
+	return until - from
+}
+
+func (i interval) String() string {
+	bound := func(slot *uint64, unbounded string) string {
+		if slot == nil {
+			return unbounded
+		}
+		return fmt.Sprint(*slot)
+	}
+	return fmt.Sprintf("[%v, %v)", bound(i.from, "-∞"), bound(i.until, "∞"))
+}
+
+// One way to satisfy a script: a set of signers, and the slots the transaction can be valid within
+type option struct {
+	signers map[string]bool
+	valid   interval
+}
+
+func (o option) sortedSigners() []string {
+	signers := make([]string, 0, len(o.signers))
+	for signer := range o.signers {
+		signers = append(signers, signer)
+	}
+	sort.Strings(signers)
+	return signers
+}
+
+// Whether o is at least as good as other: no more signers, and valid for at least as long
+func (o option) dominates(other option) bool {
+	for signer := range o.signers {
+		if !other.signers[signer] {
+			return false
+		}
+	}
+	return o.valid.contains(other.valid)
+}
+
+// Both options at once, if they can hold together
+func (o option) and(other option) (option, bool) {
+	signers := map[string]bool{}
+	for signer := range o.signers {
+		signers[signer] = true
+	}
+	for signer := range other.signers {
+		signers[signer] = true
+	}
+	combined := option{signers: signers, valid: o.valid.intersect(other.valid)}
+	return combined, !combined.valid.empty()
+}
+
+// Add an option to a set, dropping whichever options are no better than another
+func addOption(options []option, candidate option) []option {
+	for _, existing := range options {
+		if existing.dominates(candidate) {
+			return options
+		}
+	}
+	kept := options[:0]
+	for _, existing := range options {
+		if !candidate.dominates(existing) {
+			kept = append(kept, existing)
+		}
+	}
+	return append(kept, candidate)
+}
+
+type satisfier struct {
+	keys        map[string]bool
+	constraints Constraints
+}
+
+// Every (undominated) way to satisfy the script, or why there are none
+func (s satisfier) options(script types.MultisigScript, path string) ([]option, error) {
+	window := interval{from: s.constraints.From, until: s.constraints.Until}
+	switch {
+	case script.Signature != nil:
+		key := hex.EncodeToString(script.Signature.KeyHash)
+		if s.keys != nil && !s.keys[key] {
+			return nil, fmt.Errorf("%v: needs a signature from %v, which isn't available", path, key)
+		}
+		return []option{{signers: map[string]bool{key: true}, valid: window}}, nil
+	case script.AllOf != nil:
+		return s.atLeast(len(script.AllOf.Scripts), script.AllOf.Scripts, path+".allOf")
+	case script.AnyOf != nil:
+		return s.atLeast(1, script.AnyOf.Scripts, path+".anyOf")
+	case script.AtLeast != nil:
+		return s.atLeast(script.AtLeast.Required, script.AtLeast.Scripts, path+".atLeast")
+	case script.After != nil:
+		// The transaction can't be valid before the time, so its first slot must be at or after it
+		from := s.constraints.Slots.ZeroSlot
+		if !script.After.Time.Before(s.constraints.Slots.ZeroTime) {
+			slot, err := s.constraints.Slots.SlotAt(script.After.Time)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", path, err)
+			}
+			from = slot
+		}
+		valid := window.intersect(interval{from: &from})
+		if valid.empty() {
+			return nil, fmt.Errorf("%v: only valid from slot %v (%v), after the window %v", path, from, script.After.Time.UTC().Format(time.RFC3339), window)
+		}
+		return []option{{signers: map[string]bool{}, valid: valid}}, nil
+	case script.Before != nil:
+		// The transaction can't be valid after the time, so its (exclusive) last slot must be at or before it
+		if script.Before.Time.Before(s.constraints.Slots.ZeroTime) {
+			return nil, fmt.Errorf("%v: only valid before %v, before the first slot", path, script.Before.Time.UTC().Format(time.RFC3339))
+		}
+		until, err := s.constraints.Slots.SlotAt(script.Before.Time)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		if s.constraints.Slots.TimeOf(until).After(script.Before.Time) {
+			until -= 1
+		}
+		valid := window.intersect(interval{until: &until})
+		if valid.empty() {
+			return nil, fmt.Errorf("%v: only valid until slot %v (%v), before the window %v", path, until, script.Before.Time.UTC().Format(time.RFC3339), window)
+		}
+		return []option{{signers: map[string]bool{}, valid: valid}}, nil
+	default:
+		return nil, fmt.Errorf("%v: invalid native script", path)
+	}
+}
+
+// The ways to satisfy at least the required number of scripts
+func (s satisfier) atLeast(required int, scripts []types.MultisigScript, path string) ([]option, error) {
+	window := interval{from: s.constraints.From, until: s.constraints.Until}
+	if required <= 0 {
+		return []option{{signers: map[string]bool{}, valid: window}}, nil
+	}
+	if required > len(scripts) {
+		return nil, fmt.Errorf("%v: needs %v scripts, but there are only %v", path, required, len(scripts))
+	}
+
+	// satisfied[n] are the ways to satisfy n of the scripts seen so far, counting up to the number required
+	satisfied := make([][]option, required+1)
+	satisfied[0] = []option{{signers: map[string]bool{}, valid: window}}
+	var reasons []string
+	for i, script := range scripts {
+		options, err := s.options(script, fmt.Sprintf("%v[%v]", path, i))
+		if err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		next := make([][]option, required+1)
+		for n := range satisfied {
+			for _, existing := range satisfied[n] {
+				next[n] = addOption(next[n], existing)
+				for _, o := range options {
+					if combined, ok := existing.and(o); ok {
+						count := n + 1
+						if count > required {
+							count = required
+						}
+						next[count] = addOption(next[count], combined)
+					}
+				}
+			}
+		}
+		satisfied = next
+	}
+	if len(satisfied[required]) > 0 {
+		return satisfied[required], nil
+	}
+	if possible := len(scripts) - len(reasons); possible < required {
+		return nil, fmt.Errorf("%v: needs %v of %v scripts, but only %v can be satisfied: %v", path, required, len(scripts), possible, strings.Join(reasons, "; "))
+	}
+	return nil, fmt.Errorf("%v: needs %v of %v scripts, but no %v of them can be valid at the same time", path, required, len(scripts), required)
+}
+
+// Find the fewest signers, and the widest validity range, that satisfy the owner script; or, if nothing can,
+// an error wrapping ErrUnsatisfiable that explains why
+func Satisfy(owner types.MultisigScript, constraints Constraints) (Satisfaction, error) {
+	return SatisfyAll([]types.MultisigScript{owner}, constraints)
+}
+
+// Satisfy every owner at once, such as when spending several positions in one transaction
+func SatisfyAll(owners []types.MultisigScript, constraints Constraints) (Satisfaction, error) {
+	s := satisfier{constraints: constraints}
+	if constraints.Keys != nil {
+		s.keys = map[string]bool{}
+		for _, key := range constraints.Keys {
+			s.keys[strings.ToLower(key)] = true
+		}
+	}
+	window := interval{from: constraints.From, until: constraints.Until}
+	if window.empty() {
+		return Satisfaction{}, fmt.Errorf("the window %v is empty: %w", window, ErrUnsatisfiable)
+	}
+
+	options := []option{{signers: map[string]bool{}, valid: window}}
+	for i, owner := range owners {
+		path := "owner"
+		if len(owners) > 1 {
+			path = fmt.Sprintf("owners[%v]", i)
+		}
+		ownerOptions, err := s.options(owner, path)
+		if err != nil {
+			return Satisfaction{}, fmt.Errorf("%w: %v", ErrUnsatisfiable, err)
+		}
+		var next []option
+		for _, existing := range options {
+			for _, o := range ownerOptions {
+				if combined, ok := existing.and(o); ok {
+					next = addOption(next, combined)
+				}
+			}
+		}
+		if len(next) == 0 {
+			return Satisfaction{}, fmt.Errorf("%w: %v can't be valid at the same time as the owners before it", ErrUnsatisfiable, path)
+		}
+		options = next
+	}
+
+	sort.Slice(options, func(i, j int) bool {
+		if len(options[i].signers) != len(options[j].signers) {
+			return len(options[i].signers) < len(options[j].signers)
+		}
+		if options[i].valid.width() != options[j].valid.width() {
+			return options[i].valid.width() > options[j].valid.width()
+		}
+		return strings.Join(options[i].sortedSigners(), ",") < strings.Join(options[j].sortedSigners(), ",")
+	})
+	best := options[0]
+	return Satisfaction{Signers: best.sortedSigners(), ValidFrom: best.valid.from, ValidUntil: best.valid.until}, nil
+}
@@ -0,0 +1,224 @@
+package owner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+const (
+	keyA = "121fd22e0b57ac206fefc763f8bfa0771919f5218b40691eea4514d0"
+	keyB = "9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e"
+	keyC = "c279a3fb3b4e62bbc78e288783b58045d4ae82a18867d8352d02775a"
+)
+
+func allOf(scripts ...types.MultisigScript) types.MultisigScript {
+	return types.MultisigScript{AllOf: &types.AllOf{Scripts: scripts}}
+}
+
+func anyOf(scripts ...types.MultisigScript) types.MultisigScript {
+	return types.MultisigScript{AnyOf: &types.AnyOf{Scripts: scripts}}
+}
+
+func atLeast(required int, scripts ...types.MultisigScript) types.MultisigScript {
+	return types.MultisigScript{AtLeast: &types.AtLeast{Required: required, Scripts: scripts}}
+}
+
+// Preview slots are seconds since its zero time, which keeps the arithmetic simple
+func previewTime(slot int64) time.Time {
+	return types.PreviewSlotConfig.ZeroTime.Add(time.Duration(slot) * time.Second)
+}
+
+func after(slot int64) types.MultisigScript {
+	return types.MultisigScript{After: &types.After{Time: previewTime(slot)}}
+}
+
+func before(slot int64) types.MultisigScript {
+	return types.MultisigScript{Before: &types.Before{Time: previewTime(slot)}}
+}
+
+func slot(s uint64) *uint64 {
+	return &s
+}
+
+func Test_Satisfy(t *testing.T) {
+	preview := Constraints{Slots: types.PreviewSlotConfig}
+	withKeys := func(keys ...string) Constraints {
+		c := preview
+		c.Keys = keys
+		return c
+	}
+	withWindow := func(from, until *uint64) Constraints {
+		c := preview
+		c.From, c.Until = from, until
+		return c
+	}
+
+	for name, test := range map[string]struct {
+		owner       types.MultisigScript
+		constraints Constraints
+		expected    Satisfaction
+	}{
+		"signature": {
+			owner:       signature(keyC),
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{keyC}},
+		},
+		"the window is passed through": {
+			owner:       signature(keyC),
+			constraints: withWindow(slot(10), slot(20)),
+			expected:    Satisfaction{Signers: []string{keyC}, ValidFrom: slot(10), ValidUntil: slot(20)},
+		},
+		"fewest signers": {
+			owner:       anyOf(allOf(signature(keyA), signature(keyB)), signature(keyC)),
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{keyC}},
+		},
+		"only the available keys": {
+			owner:       atLeast(2, signature(keyA), signature(keyB), signature(keyC)),
+			constraints: withKeys(keyC, strings.ToUpper(keyB)),
+			expected:    Satisfaction{Signers: []string{keyB, keyC}},
+		},
+		"any two keys, chosen consistently": {
+			owner:       atLeast(2, signature(keyC), signature(keyB), signature(keyA)),
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{keyA, keyB}},
+		},
+		"the same key twice only signs once": {
+			owner:       allOf(signature(keyA), anyOf(signature(keyA), signature(keyB))),
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{keyA}},
+		},
+		"after": {
+			owner:       allOf(signature(keyA), after(100)),
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{keyA}, ValidFrom: slot(100)},
+		},
+		"after, within the window": {
+			owner:       allOf(signature(keyA), after(100)),
+			constraints: withWindow(slot(150), slot(200)),
+			expected:    Satisfaction{Signers: []string{keyA}, ValidFrom: slot(150), ValidUntil: slot(200)},
+		},
+		"before": {
+			owner:       allOf(signature(keyA), before(100)),
+			constraints: withWindow(slot(50), nil),
+			expected:    Satisfaction{Signers: []string{keyA}, ValidFrom: slot(50), ValidUntil: slot(100)},
+		},
+		"before, part way through a slot": {
+			owner:       types.MultisigScript{Before: &types.Before{Time: previewTime(100).Add(500 * time.Millisecond)}},
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{}, ValidUntil: slot(100)},
+		},
+		"a time lock that no signature is needed for": {
+			owner:       anyOf(signature(keyA), after(100)),
+			constraints: withWindow(slot(150), nil),
+			expected:    Satisfaction{Signers: []string{}, ValidFrom: slot(150)},
+		},
+		"a key that's only good until a deadline": {
+			owner:       anyOf(allOf(signature(keyA), before(100)), allOf(signature(keyB), after(100))),
+			constraints: withWindow(slot(150), slot(200)),
+			expected:    Satisfaction{Signers: []string{keyB}, ValidFrom: slot(150), ValidUntil: slot(200)},
+		},
+		"the widest range, for the same signers": {
+			owner:       anyOf(allOf(signature(keyA), before(100)), allOf(signature(keyB), before(500))),
+			constraints: withWindow(slot(50), nil),
+			expected:    Satisfaction{Signers: []string{keyB}, ValidFrom: slot(50), ValidUntil: slot(500)},
+		},
+		"nothing required": {
+			owner:       atLeast(0, signature(keyA)),
+			constraints: preview,
+			expected:    Satisfaction{Signers: []string{}},
+		},
+	} {
+		satisfaction, err := Satisfy(test.owner, test.constraints)
+		assert.Nil(t, err, name)
+		assert.EqualValues(t, test.expected, satisfaction, name)
+	}
+}
+
+func Test_Satisfy_Unsatisfiable(t *testing.T) {
+	preview := Constraints{Slots: types.PreviewSlotConfig}
+	for name, test := range map[string]struct {
+		owner       types.MultisigScript
+		constraints Constraints
+		reason      string
+	}{
+		"missing key": {
+			owner:       signature(keyA),
+			constraints: Constraints{Keys: []string{keyB}, Slots: types.PreviewSlotConfig},
+			reason:      "owner: needs a signature from " + keyA + ", which isn't available",
+		},
+		"not enough keys": {
+			owner:       atLeast(2, signature(keyA), signature(keyB), signature(keyC)),
+			constraints: Constraints{Keys: []string{keyB}, Slots: types.PreviewSlotConfig},
+			reason:      "owner.atLeast: needs 2 of 3 scripts, but only 1 can be satisfied: owner.atLeast[0]: needs a signature from " + keyA,
+		},
+		"too few scripts": {
+			owner:       atLeast(2, signature(keyA)),
+			constraints: preview,
+			reason:      "owner.atLeast: needs 2 scripts, but there are only 1",
+		},
+		"after the window": {
+			owner:       allOf(signature(keyA), after(300)),
+			constraints: Constraints{Slots: types.PreviewSlotConfig, Until: slot(200)},
+			reason:      "owner.allOf: needs 2 of 2 scripts, but only 1 can be satisfied: owner.allOf[1]: only valid from slot 300",
+		},
+		"before the window": {
+			owner:       allOf(signature(keyA), before(100)),
+			constraints: Constraints{Slots: types.PreviewSlotConfig, From: slot(150)},
+			reason:      "owner.allOf[1]: only valid until slot 100",
+		},
+		"conflicting times": {
+			owner:       allOf(signature(keyA), after(200), before(100)),
+			constraints: preview,
+			reason:      "owner.allOf: needs 3 of 3 scripts, but no 3 of them can be valid at the same time",
+		},
+		"none of the alternatives": {
+			owner:       anyOf(signature(keyA), signature(keyB)),
+			constraints: Constraints{Keys: []string{keyC}, Slots: types.PreviewSlotConfig},
+			reason:      "needs 1 of 2 scripts, but only 0 can be satisfied",
+		},
+		"empty window": {
+			owner:       signature(keyA),
+			constraints: Constraints{Slots: types.PreviewSlotConfig, From: slot(10), Until: slot(10)},
+			reason:      "the window [10, 10) is empty",
+		},
+		"no slot config": {
+			owner:       allOf(signature(keyA), after(100)),
+			constraints: Constraints{},
+			reason:      "owner.allOf[1]: invalid slot config",
+		},
+		"invalid script": {
+			owner:       allOf(types.MultisigScript{}),
+			constraints: preview,
+			reason:      "owner.allOf[0]: invalid native script",
+		},
+	} {
+		_, err := Satisfy(test.owner, test.constraints)
+		assert.True(t, errors.Is(err, ErrUnsatisfiable), name)
+		assert.Contains(t, err.Error(), test.reason, name)
+	}
+}
+
+func Test_SatisfyAll(t *testing.T) {
+	constraints := Constraints{Slots: types.PreviewSlotConfig}
+	satisfaction, err := SatisfyAll([]types.MultisigScript{
+		signature(keyC),
+		allOf(signature(keyA), after(100)),
+		anyOf(signature(keyA), signature(keyB)),
+	}, constraints)
+	assert.Nil(t, err)
+	assert.EqualValues(t, Satisfaction{Signers: []string{keyA, keyC}, ValidFrom: slot(100)}, satisfaction)
+
+	// Each owner can be satisfied on its own, but not in the same transaction
+	_, err = SatisfyAll([]types.MultisigScript{
+		allOf(signature(keyA), after(100)),
+		allOf(signature(keyB), before(50)),
+	}, constraints)
+	assert.True(t, errors.Is(err, ErrUnsatisfiable))
+	assert.Contains(t, err.Error(), "owners[1] can't be valid at the same time as the owners before it")
+}
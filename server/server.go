@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/store"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Where the server reads calculation results from; implementations should wrap store.ErrNotFound
+// when a program or day is unknown, so that it is served as a 404
+type ResultStore interface {
+	Programs(ctx context.Context) ([]types.YieldProgram, error)
+	Program(ctx context.Context, programID string) (types.YieldProgram, error)
+	// Every date the program has outputs for, in order
+	Dates(ctx context.Context, programID string) ([]types.Date, error)
+	Outputs(ctx context.Context, programID string, date types.Date) (yield.CalculationOutputs, error)
+	EarningsByOwnerID(ctx context.Context, ownerID string) ([]types.Earning, error)
+	// Every earning owned by the multisig script with the given hash
+	EarningsByScriptHash(ctx context.Context, hash string) ([]types.Earning, error)
+}
+
+// A read-only HTTP/JSON API over the results in a ResultStore:
+//
+//	GET /programs
+//	GET /programs/{program}
+//	GET /programs/{program}/outputs                          the dates with outputs, paginated
+//	GET /programs/{program}/outputs/{date}                   the full outputs for one day
+//	GET /programs/{program}/outputs/{date}/proofs/{ownerID}  proof that the owners earning is included in the days earnings root
+//	GET /programs/{program}/pools/{pool}/emissions           the pool's emissions each day, paginated
+//	GET /owners/{ownerID}/earnings[?program=...]             paginated
+//	GET /scripts/{scriptHash}/earnings[?program=...]         paginated
+//
+// Paginated endpoints accept limit and cursor parameters, and return the cursor for the next page, if there is one.
+// Every response carries an ETag, and a request with a matching If-None-Match gets a 304
+type Server struct {
+	Store ResultStore
+	// Where internal errors are logged, since they're not served to the client; nil uses the log package's standard logger
+	ErrorLog *log.Logger
+}
+
+func New(resultStore ResultStore) *Server {
+	return &Server{Store: resultStore}
+}
+
+// A page of a paginated list
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// How much a pool was emitted on a single day
+type PoolEmissions struct {
+	Date      types.Date `json:"date"`
+	Emissions uint64     `json:"emissions"`
+}
+
+// An earning, with proof that it's included under the days earnings root
+type EarningProof struct {
+	Root    string            `json:"root"`
+	Earning types.Earning     `json:"earning"`
+	Proof   types.MerkleProof `json:"proof"`
+}
+
+// An error with the HTTP status it should be served with
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e httpError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...any) error {
+	return httpError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.writeError(w, httpError{status: http.StatusMethodNotAllowed, message: "method not allowed"})
+		return
+	}
+	body, err := s.route(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, r, body)
+}
+
+func (s *Server) route(r *http.Request) (any, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, badRequest("invalid path segment %q", segment)
+		}
+		segments = append(segments, unescaped)
+	}
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	switch {
+	case len(segments) == 1 && segments[0] == "programs":
+		programs, err := s.Store.Programs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return append([]types.YieldProgram{}, programs...), nil
+	case len(segments) == 2 && segments[0] == "programs":
+		return s.Store.Program(ctx, segments[1])
+	case len(segments) == 3 && segments[0] == "programs" && segments[2] == "outputs":
+		if _, err := s.Store.Program(ctx, segments[1]); err != nil {
+			return nil, err
+		}
+		dates, err := s.Store.Dates(ctx, segments[1])
+		if err != nil {
+			return nil, err
+		}
+		return paginate(query, dates)
+	case len(segments) == 4 && segments[0] == "programs" && segments[2] == "outputs":
+		if _, err := time.Parse(types.DateFormat, segments[3]); err != nil {
+			return nil, badRequest("invalid date %q", segments[3])
+		}
+		return s.Store.Outputs(ctx, segments[1], segments[3])
+	case len(segments) == 6 && segments[0] == "programs" && segments[2] == "outputs" && segments[4] == "proofs":
+		if _, err := time.Parse(types.DateFormat, segments[3]); err != nil {
+			return nil, badRequest("invalid date %q", segments[3])
+		}
+		return s.earningProof(ctx, segments[1], segments[3], segments[5])
+	case len(segments) == 5 && segments[0] == "programs" && segments[2] == "pools" && segments[4] == "emissions":
+		return s.poolEmissions(ctx, query, segments[1], segments[3])
+	case len(segments) == 3 && segments[0] == "owners" && segments[2] == "earnings":
+		earnings, err := s.Store.EarningsByOwnerID(ctx, segments[1])
+		if err != nil {
+			return nil, err
+		}
+		return paginate(query, filterByProgram(earnings, query.Get("program")))
+	case len(segments) == 3 && segments[0] == "scripts" && segments[2] == "earnings":
+		earnings, err := s.Store.EarningsByScriptHash(ctx, segments[1])
+		if err != nil {
+			return nil, err
+		}
+		return paginate(query, filterByProgram(earnings, query.Get("program")))
+	}
+	return nil, httpError{status: http.StatusNotFound, message: fmt.Sprintf("no such endpoint %v", r.URL.Path)}
+}
+
+// Only read the outputs for the days on the requested page
+func (s *Server) poolEmissions(ctx context.Context, query url.Values, programID string, poolIdent string) (Page[PoolEmissions], error) {
+	if _, err := s.Store.Program(ctx, programID); err != nil {
+		return Page[PoolEmissions]{}, err
+	}
+	dates, err := s.Store.Dates(ctx, programID)
+	if err != nil {
+		return Page[PoolEmissions]{}, err
+	}
+	page, err := paginate(query, dates)
+	if err != nil {
+		return Page[PoolEmissions]{}, err
+	}
+	emissions := Page[PoolEmissions]{Items: []PoolEmissions{}, NextCursor: page.NextCursor}
+	for _, date := range page.Items {
+		outputs, err := s.Store.Outputs(ctx, programID, date)
+		if err != nil {
+			return Page[PoolEmissions]{}, err
+		}
+		emissions.Items = append(emissions.Items, PoolEmissions{Date: date, Emissions: outputs.EmissionsByPool[poolIdent]})
+	}
+	return emissions, nil
+}
+
+func (s *Server) earningProof(ctx context.Context, programID string, date types.Date, ownerID string) (EarningProof, error) {
+	outputs, err := s.Store.Outputs(ctx, programID, date)
+	if err != nil {
+		return EarningProof{}, err
+	}
+	// Outputs from before earnings were committed to don't have a root to prove against
+	if outputs.EarningsRoot == "" {
+		return EarningProof{}, httpError{status: http.StatusNotFound, message: fmt.Sprintf("outputs for %v on %v have no earnings root to prove against", programID, date)}
+	}
+	tree, err := types.NewEarningsTree(outputs.Earnings)
+	if err != nil {
+		return EarningProof{}, err
+	}
+	if tree.Root() != outputs.EarningsRoot {
+		return EarningProof{}, httpError{status: http.StatusConflict, message: fmt.Sprintf("earnings for %v on %v don't match their root %q", programID, date, outputs.EarningsRoot)}
+	}
+	for _, earning := range outputs.Earnings {
+		if earning.OwnerID != ownerID {
+			continue
+		}
+		proof, err := tree.Proof(earning.Program, ownerID)
+		if err != nil {
+			return EarningProof{}, err
+		}
+		return EarningProof{Root: outputs.EarningsRoot, Earning: earning, Proof: proof}, nil
+	}
+	return EarningProof{}, httpError{status: http.StatusNotFound, message: fmt.Sprintf("no earning for %v on %v", ownerID, date)}
+}
+
+func filterByProgram(earnings []types.Earning, programID string) []types.Earning {
+	if programID == "" {
+		return earnings
+	}
+	var filtered []types.Earning
+	for _, earning := range earnings {
+		if earning.Program == programID {
+			filtered = append(filtered, earning)
+		}
+	}
+	return filtered
+}
+
+// Cursors are opaque to clients; they encode the offset of the next item
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, badRequest("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(bytes))
+	if err != nil || offset < 0 {
+		return 0, badRequest("invalid cursor")
+	}
+	return offset, nil
+}
+
+func paginate[T any](query url.Values, items []T) (Page[T], error) {
+	limit := DefaultPageSize
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return Page[T]{}, badRequest("invalid limit %q", raw)
+		}
+		limit = parsed
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	offset, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		return Page[T]{}, err
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	// Always serve a list, even an empty one, rather than null
+	page := Page[T]{Items: append([]T{}, items[offset:end]...)}
+	if end < len(items) {
+		page.NextCursor = encodeCursor(end)
+	}
+	return page, nil
+}
+
+// The ETag is a hash of the body, so it changes exactly when the response does
+func etag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+func etagMatches(ifNoneMatch string, tag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, value any) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("failed to encode response: %w", err))
+		return
+	}
+	tag := etag(body)
+	w.Header().Set("ETag", tag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var httpErr httpError
+	if errors.As(err, &httpErr) {
+		status = httpErr.status
+	} else if errors.Is(err, store.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		// Internal errors can carry paths and other details of the store, so they're logged rather than served
+		s.logf("internal error: %v", err)
+		message = http.StatusText(status)
+	}
+	body, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
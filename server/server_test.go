@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/store"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func sampleServer(t *testing.T) *Server {
+	ctx := context.Background()
+	s := store.NewFileStore(t.TempDir())
+	program := utilities.SampleYieldProgram(500_000_000)
+	assert.Nil(t, s.SaveProgram(ctx, program))
+	for day := 1; day <= 5; day++ {
+		date := fmt.Sprintf("2024-01-%02d", day)
+		earnings := []types.Earning{
+			{OwnerID: "A", Owner: types.MultisigScript{Signature: &types.Signature{KeyHash: []byte("A")}}, Program: program.ID, EarnedDate: date},
+			{OwnerID: "B", Owner: types.MultisigScript{Signature: &types.Signature{KeyHash: []byte("B")}}, Program: program.ID, EarnedDate: date},
+		}
+		tree, err := types.NewEarningsTree(earnings)
+		assert.Nil(t, err)
+		assert.Nil(t, s.SaveOutputs(ctx, program.ID, date, yield.CalculationOutputs{
+			EmissionsByPool: map[string]uint64{"01": uint64(day * 100)},
+			Earnings:        earnings,
+			EarningsRoot:    tree.Root(),
+		}))
+	}
+	return New(s)
+}
+
+func get(t *testing.T, server http.Handler, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	var value T
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &value))
+	return value
+}
+
+func Test_Programs(t *testing.T) {
+	server := sampleServer(t)
+	rec := get(t, server, "/programs")
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	programs := decode[[]types.YieldProgram](t, rec)
+	assert.Len(t, programs, 1)
+	assert.EqualValues(t, "TestYield", programs[0].ID)
+
+	rec = get(t, server, "/programs/TestYield")
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.EqualValues(t, "TestYield", decode[types.YieldProgram](t, rec).ID)
+
+	rec = get(t, server, "/programs/Missing")
+	assert.EqualValues(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, decode[map[string]string](t, rec)["error"], "not found")
+
+	rec = get(t, server, "/nowhere")
+	assert.EqualValues(t, http.StatusNotFound, rec.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/programs", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.EqualValues(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func Test_Outputs(t *testing.T) {
+	server := sampleServer(t)
+	rec := get(t, server, "/programs/TestYield/outputs/2024-01-03")
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	outputs := decode[yield.CalculationOutputs](t, rec)
+	assert.EqualValues(t, 300, outputs.EmissionsByPool["01"])
+	assert.Len(t, outputs.Earnings, 2)
+
+	assert.EqualValues(t, http.StatusNotFound, get(t, server, "/programs/TestYield/outputs/2024-02-01").Code)
+	assert.EqualValues(t, http.StatusBadRequest, get(t, server, "/programs/TestYield/outputs/yesterday").Code)
+}
+
+func Test_Pagination(t *testing.T) {
+	server := sampleServer(t)
+	rec := get(t, server, "/programs/TestYield/outputs?limit=2")
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	page := decode[Page[types.Date]](t, rec)
+	assert.EqualValues(t, []types.Date{"2024-01-01", "2024-01-02"}, page.Items)
+	assert.NotEqual(t, "", page.NextCursor)
+
+	var dates []types.Date
+	cursor := ""
+	for {
+		page := decode[Page[types.Date]](t, get(t, server, "/programs/TestYield/outputs?limit=2&cursor="+cursor))
+		dates = append(dates, page.Items...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Len(t, dates, 5)
+
+	emissions := decode[Page[PoolEmissions]](t, get(t, server, "/programs/TestYield/pools/01/emissions?limit=3"))
+	assert.EqualValues(t, []PoolEmissions{{"2024-01-01", 100}, {"2024-01-02", 200}, {"2024-01-03", 300}}, emissions.Items)
+	emissions = decode[Page[PoolEmissions]](t, get(t, server, "/programs/TestYield/pools/01/emissions?cursor="+emissions.NextCursor))
+	assert.EqualValues(t, []PoolEmissions{{"2024-01-04", 400}, {"2024-01-05", 500}}, emissions.Items)
+	assert.EqualValues(t, "", emissions.NextCursor)
+
+	assert.EqualValues(t, http.StatusBadRequest, get(t, server, "/programs/TestYield/outputs?limit=zero").Code)
+	assert.EqualValues(t, http.StatusBadRequest, get(t, server, "/programs/TestYield/outputs?cursor=!!").Code)
+}
+
+func Test_Earnings(t *testing.T) {
+	server := sampleServer(t)
+	page := decode[Page[types.Earning]](t, get(t, server, "/owners/A/earnings"))
+	assert.Len(t, page.Items, 5)
+	for _, earning := range page.Items {
+		assert.EqualValues(t, "A", earning.OwnerID)
+	}
+
+	page = decode[Page[types.Earning]](t, get(t, server, "/owners/A/earnings?program=Other"))
+	assert.Len(t, page.Items, 0)
+
+	hash, err := types.MultisigScript{Signature: &types.Signature{KeyHash: []byte("B")}}.Hash()
+	assert.Nil(t, err)
+	page = decode[Page[types.Earning]](t, get(t, server, "/scripts/"+hash+"/earnings?limit=2"))
+	assert.Len(t, page.Items, 2)
+	assert.EqualValues(t, "B", page.Items[0].OwnerID)
+}
+
+func Test_ETag(t *testing.T) {
+	server := sampleServer(t)
+	rec := get(t, server, "/programs/TestYield/outputs/2024-01-01")
+	tag := rec.Header().Get("ETag")
+	assert.NotEqual(t, "", tag)
+
+	rec = get(t, server, "/programs/TestYield/outputs/2024-01-01", "If-None-Match", tag)
+	assert.EqualValues(t, http.StatusNotModified, rec.Code)
+	assert.EqualValues(t, 0, rec.Body.Len())
+
+	rec = get(t, server, "/programs/TestYield/outputs/2024-01-01", "If-None-Match", `"other", W/`+tag)
+	assert.EqualValues(t, http.StatusNotModified, rec.Code)
+
+	// A different response has a different tag
+	rec = get(t, server, "/programs/TestYield/outputs/2024-01-02", "If-None-Match", tag)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, tag, rec.Header().Get("ETag"))
+}
+
+func Test_EarningProof(t *testing.T) {
+	server := sampleServer(t)
+	rec := get(t, server, "/programs/TestYield/outputs/2024-01-02/proofs/B")
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	proof := decode[EarningProof](t, rec)
+	assert.EqualValues(t, "B", proof.Earning.OwnerID)
+
+	// The proof checks out against the root published with the outputs
+	outputs := decode[yield.CalculationOutputs](t, get(t, server, "/programs/TestYield/outputs/2024-01-02"))
+	assert.EqualValues(t, outputs.EarningsRoot, proof.Root)
+	assert.Nil(t, types.VerifyEarningProof(outputs.EarningsRoot, proof.Earning, proof.Proof))
+
+	assert.EqualValues(t, http.StatusNotFound, get(t, server, "/programs/TestYield/outputs/2024-01-02/proofs/C").Code)
+	assert.EqualValues(t, http.StatusNotFound, get(t, server, "/programs/TestYield/outputs/2024-02-01/proofs/B").Code)
+
+	// Outputs saved before earnings had a root can't be proven, and outputs that don't match their root shouldn't be
+	ctx := context.Background()
+	s := server.Store.(*store.FileStore)
+	earnings := []types.Earning{{OwnerID: "B", Owner: types.MultisigScript{Signature: &types.Signature{KeyHash: []byte("B")}}, Program: "TestYield", EarnedDate: "2024-01-06"}}
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-06", yield.CalculationOutputs{Earnings: earnings}))
+	assert.EqualValues(t, http.StatusNotFound, get(t, server, "/programs/TestYield/outputs/2024-01-06/proofs/B").Code)
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-07", yield.CalculationOutputs{Earnings: earnings, EarningsRoot: "00"}))
+	assert.EqualValues(t, http.StatusConflict, get(t, server, "/programs/TestYield/outputs/2024-01-07/proofs/B").Code)
+}
+
+type failingStore struct {
+	ResultStore
+}
+
+func (failingStore) Programs(ctx context.Context) ([]types.YieldProgram, error) {
+	return nil, errors.New("open /var/lib/yield/programs: permission denied")
+}
+
+func Test_InternalError(t *testing.T) {
+	var logged bytes.Buffer
+	server := New(failingStore{})
+	server.ErrorLog = log.New(&logged, "", 0)
+	rec := get(t, server, "/programs")
+	assert.EqualValues(t, http.StatusInternalServerError, rec.Code)
+
+	// The details are logged, but not served
+	assert.EqualValues(t, map[string]string{"error": "Internal Server Error"}, decode[map[string]string](t, rec))
+	assert.Contains(t, logged.String(), "/var/lib/yield/programs")
+}
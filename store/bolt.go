@@ -0,0 +1,276 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	programsBucket         = []byte("programs")
+	outputsBucket          = []byte("outputs")
+	earningsByOwnerBucket  = []byte("earnings-by-owner")
+	earningsByScriptBucket = []byte("earnings-by-script")
+)
+
+// A ResultStore in a single embedded database file; programs are kept in one bucket by ID,
+// and each programs records in a bucket of their own, keyed by date, so they're kept in date order.
+// Each record's earnings are also indexed, in a bucket per owner ID and per script hash, keyed by the
+// date and then the program ID, so they're kept in the order they're looked up in
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o644, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result store %v: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{programsBucket, outputsBucket, earningsByOwnerBucket, earningsByScriptBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize result store %v: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) SaveProgram(ctx context.Context, program types.YieldProgram, opts ...SaveOption) error {
+	o := applySaveOptions(opts)
+	if program.ID == "" {
+		return fmt.Errorf("program has no ID")
+	}
+	bytes, err := json.Marshal(program)
+	if err != nil {
+		return fmt.Errorf("failed to encode program %v: %w", program.ID, err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(programsBucket)
+		var existing *types.YieldProgram
+		if previous := bucket.Get([]byte(program.ID)); previous != nil {
+			existing = &types.YieldProgram{}
+			if err := json.Unmarshal(previous, existing); err != nil && !o.force {
+				return err
+			}
+		}
+		write, err := shouldWriteProgram(existing, program, o)
+		if err != nil || !write {
+			return err
+		}
+		return bucket.Put([]byte(program.ID), bytes)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save program %v: %w", program.ID, err)
+	}
+	return nil
+}
+
+func (s *BoltStore) Programs(ctx context.Context) ([]types.YieldProgram, error) {
+	var programs []types.YieldProgram
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(programsBucket).ForEach(func(id, bytes []byte) error {
+			var program types.YieldProgram
+			if err := json.Unmarshal(bytes, &program); err != nil {
+				return fmt.Errorf("failed to decode program %v: %w", string(id), err)
+			}
+			programs = append(programs, program)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list programs: %w", err)
+	}
+	return programs, nil
+}
+
+func (s *BoltStore) Program(ctx context.Context, programID string) (types.YieldProgram, error) {
+	var program types.YieldProgram
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bytes := tx.Bucket(programsBucket).Get([]byte(programID))
+		if bytes == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(bytes, &program)
+	})
+	if err != nil {
+		return types.YieldProgram{}, fmt.Errorf("failed to load program %v: %w", programID, err)
+	}
+	return program, nil
+}
+
+// Read the existing record and write the new one in the same transaction, so that two writers can't both think they were first,
+// and the earnings indexes always match the records
+func (s *BoltStore) SaveOutputs(ctx context.Context, programID string, date types.Date, outputs yield.CalculationOutputs, opts ...SaveOption) error {
+	o := applySaveOptions(opts)
+	record, err := newRecord(programID, date, outputs)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode outputs for %v on %v: %w", programID, date, err)
+	}
+	byOwnerID, byScriptHash, err := indexEarnings(record)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(outputsBucket).CreateBucketIfNotExists([]byte(programID))
+		if err != nil {
+			return err
+		}
+		var existing *Record
+		if previous := bucket.Get([]byte(date)); previous != nil {
+			existing = &Record{}
+			if err := json.Unmarshal(previous, existing); err != nil && !o.force {
+				return err
+			}
+		}
+		write, err := shouldWrite(existing, record, o)
+		if err != nil || !write {
+			return err
+		}
+		if err := bucket.Put([]byte(date), bytes); err != nil {
+			return err
+		}
+		// Drop whatever the replaced record indexed, since some of its owners may have no earnings in the new one
+		key := []byte(date + programID)
+		if existing != nil {
+			oldByOwnerID, oldByScriptHash, err := indexEarnings(*existing)
+			if err != nil {
+				return err
+			}
+			deleteEarnings(tx.Bucket(earningsByOwnerBucket), oldByOwnerID, key)
+			deleteEarnings(tx.Bucket(earningsByScriptBucket), oldByScriptHash, key)
+		}
+		if err := putEarnings(tx.Bucket(earningsByOwnerBucket), byOwnerID, key); err != nil {
+			return err
+		}
+		return putEarnings(tx.Bucket(earningsByScriptBucket), byScriptHash, key)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save outputs for %v on %v: %w", programID, date, err)
+	}
+	return nil
+}
+
+func (s *BoltStore) Dates(ctx context.Context, programID string) ([]types.Date, error) {
+	var dates []types.Date
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outputsBucket).Bucket([]byte(programID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(date, _ []byte) error {
+			dates = append(dates, string(date))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outputs for %v: %w", programID, err)
+	}
+	return dates, nil
+}
+
+func (s *BoltStore) Record(ctx context.Context, programID string, date types.Date) (Record, error) {
+	if err := validDate(date); err != nil {
+		return Record{}, err
+	}
+	var record Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outputsBucket).Bucket([]byte(programID))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		bytes := bucket.Get([]byte(date))
+		if bytes == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(bytes, &record)
+	})
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to load outputs for %v on %v: %w", programID, date, err)
+	}
+	if err := record.verify(programID, date); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+func (s *BoltStore) Outputs(ctx context.Context, programID string, date types.Date) (yield.CalculationOutputs, error) {
+	record, err := s.Record(ctx, programID, date)
+	if err != nil {
+		return yield.CalculationOutputs{}, err
+	}
+	return record.Outputs, nil
+}
+
+func putEarnings(index *bolt.Bucket, earningsByKey map[string][]types.Earning, key []byte) error {
+	for indexKey, earnings := range earningsByKey {
+		bucket, err := index.CreateBucketIfNotExists([]byte(indexKey))
+		if err != nil {
+			return err
+		}
+		bytes, err := json.Marshal(earnings)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(key, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteEarnings(index *bolt.Bucket, earningsByKey map[string][]types.Earning, key []byte) {
+	for indexKey := range earningsByKey {
+		if bucket := index.Bucket([]byte(indexKey)); bucket != nil {
+			bucket.Delete(key)
+		}
+	}
+}
+
+func (s *BoltStore) earnings(index []byte, indexKey string) ([]types.Earning, error) {
+	var earnings []types.Earning
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(index).Bucket([]byte(indexKey))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, bytes []byte) error {
+			var recordEarnings []types.Earning
+			if err := json.Unmarshal(bytes, &recordEarnings); err != nil {
+				return fmt.Errorf("failed to decode earnings for %v: %w", string(key), err)
+			}
+			earnings = append(earnings, recordEarnings...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load earnings for %v: %w", indexKey, err)
+	}
+	return earnings, nil
+}
+
+func (s *BoltStore) EarningsByOwnerID(ctx context.Context, ownerID string) ([]types.Earning, error) {
+	return s.earnings(earningsByOwnerBucket, ownerID)
+}
+
+func (s *BoltStore) EarningsByScriptHash(ctx context.Context, hash string) ([]types.Earning, error) {
+	return s.earnings(earningsByScriptBucket, strings.ToLower(hash))
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/tj/assert"
+)
+
+func openBoltStore(t *testing.T, path string) *BoltStore {
+	s, err := NewBoltStore(path)
+	assert.Nil(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func Test_BoltStore(t *testing.T) {
+	testResultStore(t, openBoltStore(t, filepath.Join(t.TempDir(), "results.db")))
+	testWriteOnce(t, openBoltStore(t, filepath.Join(t.TempDir(), "results.db")))
+}
+
+func Test_BoltStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "results.db")
+	s := openBoltStore(t, path)
+	program := utilities.SampleYieldProgram(1000)
+	assert.Nil(t, s.SaveProgram(ctx, program))
+	assert.Nil(t, s.Close())
+
+	s = openBoltStore(t, path)
+	saved, err := s.Program(ctx, program.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, program, saved)
+}
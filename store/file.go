@@ -0,0 +1,345 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// A ResultStore that keeps each program, and each days record, as JSON files under a directory:
+//
+//	<Dir>/programs/<program ID>/program.json
+//	<Dir>/programs/<program ID>/outputs/<date>.json
+//
+// Each owner's earnings, across every program and day, are indexed in a file of their own, as are those of each script hash:
+//
+//	<Dir>/earnings/owners/<owner ID>.json
+//	<Dir>/earnings/scripts/<script hash>.json
+//
+// Index files are rewritten as each day is saved, under a lock that only covers this FileStore, so only one process should
+// write to a directory at a time; this is best suited to local testing and small deployments
+type FileStore struct {
+	Dir string
+
+	indexLock sync.Mutex
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (s *FileStore) programDir(programID string) (string, error) {
+	// Escaping the ID keeps any "/" in it from reaching into another directory, but leaves "." and ".." as they are
+	switch programID {
+	case "", ".", "..":
+		return "", fmt.Errorf("invalid program ID %q", programID)
+	}
+	return filepath.Join(s.Dir, "programs", url.PathEscape(programID)), nil
+}
+
+func (s *FileStore) outputsPath(programID string, date types.Date) (string, error) {
+	dir, err := s.programDir(programID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "outputs", date+".json"), nil
+}
+
+// Write to a temporary file first, so a reader never sees a partially written file; unless replacing it,
+// the file is linked into place, which fails if another writer got there first
+func writeJSON(path string, value any, replace bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if replace {
+		return os.Rename(tmp.Name(), path)
+	}
+	if err := os.Link(tmp.Name(), path); errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%v: %w", filepath.Base(path), ErrAlreadyExists)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func readJSON(path string, value any) error {
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v: %w", filepath.Base(path), ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, value)
+}
+
+func (s *FileStore) SaveProgram(ctx context.Context, program types.YieldProgram, opts ...SaveOption) error {
+	o := applySaveOptions(opts)
+	dir, err := s.programDir(program.ID)
+	if err != nil {
+		return err
+	}
+	var existing *types.YieldProgram
+	if previous, err := s.Program(ctx, program.ID); err == nil {
+		existing = &previous
+	} else if !errors.Is(err, ErrNotFound) && !o.force {
+		return err
+	}
+	write, err := shouldWriteProgram(existing, program, o)
+	if err != nil || !write {
+		return err
+	}
+	if err := writeJSON(filepath.Join(dir, "program.json"), program, o.force); err != nil {
+		return fmt.Errorf("failed to save program %v: %w", program.ID, err)
+	}
+	return nil
+}
+
+func (s *FileStore) SaveOutputs(ctx context.Context, programID string, date types.Date, outputs yield.CalculationOutputs, opts ...SaveOption) error {
+	o := applySaveOptions(opts)
+	record, err := newRecord(programID, date, outputs)
+	if err != nil {
+		return err
+	}
+	var existing *Record
+	if previous, err := s.Record(ctx, programID, date); err == nil {
+		existing = &previous
+	} else if !errors.Is(err, ErrNotFound) && !o.force {
+		return err
+	}
+	write, err := shouldWrite(existing, record, o)
+	if err != nil || !write {
+		return err
+	}
+	path, err := s.outputsPath(programID, date)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(path, record, o.force); err != nil {
+		return fmt.Errorf("failed to save outputs for %v on %v: %w", programID, date, err)
+	}
+	if err := s.reindexEarnings(existing, record); err != nil {
+		return fmt.Errorf("failed to index earnings for %v on %v: %w", programID, date, err)
+	}
+	return nil
+}
+
+// The earnings one record holds under an index key
+type indexEntry struct {
+	ProgramID string
+	Date      types.Date
+	Earnings  []types.Earning
+}
+
+// Replace the record's entry in the index file of every owner and script hash with earnings in it, or in the record it replaced
+func (s *FileStore) reindexEarnings(existing *Record, record Record) error {
+	byOwnerID, byScriptHash, err := indexEarnings(record)
+	if err != nil {
+		return err
+	}
+	keys := map[string]map[string]bool{"owners": {}, "scripts": {}}
+	if existing != nil {
+		oldByOwnerID, oldByScriptHash, err := indexEarnings(*existing)
+		if err != nil {
+			return err
+		}
+		for key := range oldByOwnerID {
+			keys["owners"][key] = true
+		}
+		for key := range oldByScriptHash {
+			keys["scripts"][key] = true
+		}
+	}
+	for key := range byOwnerID {
+		keys["owners"][key] = true
+	}
+	for key := range byScriptHash {
+		keys["scripts"][key] = true
+	}
+
+	s.indexLock.Lock()
+	defer s.indexLock.Unlock()
+	for index, earningsByKey := range map[string]map[string][]types.Earning{"owners": byOwnerID, "scripts": byScriptHash} {
+		for key := range keys[index] {
+			if err := s.updateIndex(s.indexPath(index, key), record, earningsByKey[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) indexPath(index string, key string) string {
+	return filepath.Join(s.Dir, "earnings", index, url.PathEscape(key)+".json")
+}
+
+// Rewrite an index file with the record's earnings in place of any it had before, keeping it ordered by date and then program
+func (s *FileStore) updateIndex(path string, record Record, earnings []types.Earning) error {
+	var entries []indexEntry
+	if err := readJSON(path, &entries); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.ProgramID != record.ProgramID || entry.Date != record.Date {
+			kept = append(kept, entry)
+		}
+	}
+	if len(earnings) > 0 {
+		kept = append(kept, indexEntry{ProgramID: record.ProgramID, Date: record.Date, Earnings: earnings})
+	}
+	if len(kept) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Date != kept[j].Date {
+			return kept[i].Date < kept[j].Date
+		}
+		return kept[i].ProgramID < kept[j].ProgramID
+	})
+	return writeJSON(path, kept, true)
+}
+
+func (s *FileStore) earnings(index string, key string) ([]types.Earning, error) {
+	var entries []indexEntry
+	if err := readJSON(s.indexPath(index, key), &entries); errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load earnings for %v: %w", key, err)
+	}
+	var earnings []types.Earning
+	for _, entry := range entries {
+		earnings = append(earnings, entry.Earnings...)
+	}
+	return earnings, nil
+}
+
+// Every program in the store, ordered by ID
+func (s *FileStore) Programs(ctx context.Context) ([]types.YieldProgram, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, "programs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list programs: %w", err)
+	}
+	var programs []types.YieldProgram
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		programID, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+		program, err := s.Program(ctx, programID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+	sort.Slice(programs, func(i, j int) bool {
+		return programs[i].ID < programs[j].ID
+	})
+	return programs, nil
+}
+
+func (s *FileStore) Program(ctx context.Context, programID string) (types.YieldProgram, error) {
+	// No program can be saved under an invalid ID, so there's nothing to find
+	dir, err := s.programDir(programID)
+	if err != nil {
+		return types.YieldProgram{}, fmt.Errorf("%v: %w", err, ErrNotFound)
+	}
+	var program types.YieldProgram
+	if err := readJSON(filepath.Join(dir, "program.json"), &program); err != nil {
+		return types.YieldProgram{}, fmt.Errorf("failed to load program %v: %w", programID, err)
+	}
+	return program, nil
+}
+
+// Every date the program has outputs for, in order
+func (s *FileStore) Dates(ctx context.Context, programID string) ([]types.Date, error) {
+	dir, err := s.programDir(programID)
+	if err != nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "outputs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list outputs for %v: %w", programID, err)
+	}
+	var dates []types.Date
+	for _, entry := range entries {
+		date := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || date == entry.Name() || validDate(date) != nil {
+			continue
+		}
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+func (s *FileStore) Record(ctx context.Context, programID string, date types.Date) (Record, error) {
+	if err := validDate(date); err != nil {
+		return Record{}, err
+	}
+	path, err := s.outputsPath(programID, date)
+	if err != nil {
+		return Record{}, fmt.Errorf("%v: %w", err, ErrNotFound)
+	}
+	var record Record
+	if err := readJSON(path, &record); err != nil {
+		return Record{}, fmt.Errorf("failed to load outputs for %v on %v: %w", programID, date, err)
+	}
+	if err := record.verify(programID, date); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+func (s *FileStore) Outputs(ctx context.Context, programID string, date types.Date) (yield.CalculationOutputs, error) {
+	record, err := s.Record(ctx, programID, date)
+	if err != nil {
+		return yield.CalculationOutputs{}, err
+	}
+	return record.Outputs, nil
+}
+
+func (s *FileStore) EarningsByOwnerID(ctx context.Context, ownerID string) ([]types.Earning, error) {
+	return s.earnings("owners", ownerID)
+}
+
+func (s *FileStore) EarningsByScriptHash(ctx context.Context, hash string) ([]types.Earning, error) {
+	return s.earnings("scripts", strings.ToLower(hash))
+}
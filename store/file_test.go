@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func Test_FileStore(t *testing.T) {
+	testResultStore(t, NewFileStore(t.TempDir()))
+	testWriteOnce(t, NewFileStore(t.TempDir()))
+}
+
+func Test_FileStore_Tampered(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(t.TempDir())
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-01", yield.CalculationOutputs{EmissionsByPool: map[string]uint64{"01": 100}}))
+
+	path, err := s.outputsPath("TestYield", "2024-01-01")
+	assert.Nil(t, err)
+	bytes, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, []byte(strings.Replace(string(bytes), "100", "999", 1)), 0o644))
+
+	_, err = s.Outputs(ctx, "TestYield", "2024-01-01")
+	assert.True(t, errors.Is(err, ErrHashMismatch))
+	// A tampered record can't be silently replaced either
+	err = s.SaveOutputs(ctx, "TestYield", "2024-01-01", yield.CalculationOutputs{})
+	assert.True(t, errors.Is(err, ErrHashMismatch))
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-01", yield.CalculationOutputs{}, Force()))
+}
+
+func Test_FileStore_InvalidProgramID(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewFileStore(dir)
+	program := utilities.SampleYieldProgram(1000)
+	assert.Nil(t, s.SaveProgram(ctx, program))
+
+	// Escaping leaves these as they are, so they'd resolve to the store's own directories rather than a program's
+	for _, programID := range []string{"", ".", ".."} {
+		invalid := program
+		invalid.ID = programID
+		assert.NotNil(t, s.SaveProgram(ctx, invalid), programID)
+		assert.NotNil(t, s.SaveOutputs(ctx, programID, "2024-01-01", yield.CalculationOutputs{}), programID)
+		_, err := s.Program(ctx, programID)
+		assert.True(t, errors.Is(err, ErrNotFound), programID)
+		_, err = s.Outputs(ctx, programID, "2024-01-01")
+		assert.True(t, errors.Is(err, ErrNotFound), programID)
+		dates, err := s.Dates(ctx, programID)
+		assert.Nil(t, err)
+		assert.Len(t, dates, 0)
+	}
+
+	// Nothing was written outside the program's directory
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	entries, err = os.ReadDir(filepath.Join(dir, "programs"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	programs, err := s.Programs(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.YieldProgram{program}, programs)
+}
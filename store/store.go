@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+)
+
+// Returned (wrapped) when the store has no record of what was asked for
+var ErrNotFound = errors.New("not found")
+
+// Returned (wrapped) when saving a different program over one with the same ID, or different outputs for a day that
+// already has some, without forcing it
+var ErrAlreadyExists = errors.New("already exists")
+
+// Returned (wrapped) when a stored record no longer matches its hash
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// Durable storage for programs and their daily calculation results; each day is written once, and is immutable after that
+type ResultStore interface {
+	// Save a program; saving the same program again does nothing, but saving a different program with the same ID
+	// fails with ErrAlreadyExists, unless forced, since the days already saved were calculated with the stored one
+	SaveProgram(ctx context.Context, program types.YieldProgram, opts ...SaveOption) error
+	// Every program in the store, ordered by ID
+	Programs(ctx context.Context) ([]types.YieldProgram, error)
+	Program(ctx context.Context, programID string) (types.YieldProgram, error)
+
+	// Save the outputs for a day; saving the same outputs again does nothing, but saving
+	// different outputs fails with ErrAlreadyExists, unless forced
+	SaveOutputs(ctx context.Context, programID string, date types.Date, outputs yield.CalculationOutputs, opts ...SaveOption) error
+	// Every date the program has outputs for, in order
+	Dates(ctx context.Context, programID string) ([]types.Date, error)
+	Record(ctx context.Context, programID string, date types.Date) (Record, error)
+	Outputs(ctx context.Context, programID string, date types.Date) (yield.CalculationOutputs, error)
+
+	// Every earning with the given owner ID, ordered by date and then program; earnings are indexed as their
+	// outputs are saved, so this doesn't read every day's outputs
+	EarningsByOwnerID(ctx context.Context, ownerID string) ([]types.Earning, error)
+	// Every earning owned by the multisig script with the given hash, ordered the same way
+	EarningsByScriptHash(ctx context.Context, hash string) ([]types.Earning, error)
+}
+
+// A days outputs, as stored
+type Record struct {
+	ProgramID string
+	Date      types.Date
+	// The hex encoded sha256 of the outputs; see HashOutputs
+	Hash    string
+	Outputs yield.CalculationOutputs
+}
+
+type saveOptions struct {
+	force bool
+}
+
+type SaveOption func(o *saveOptions)
+
+func applySaveOptions(opts []SaveOption) saveOptions {
+	var o saveOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Replace any program or outputs already saved, for example to correct a bad calculation
+func Force() SaveOption {
+	return func(o *saveOptions) {
+		o.force = true
+	}
+}
+
+// Hash the outputs, ignoring the timestamp, so that re-running a calculation over the same inputs gives the same hash
+func HashOutputs(outputs yield.CalculationOutputs) (string, error) {
+	return outputs.Digest()
+}
+
+func newRecord(programID string, date types.Date, outputs yield.CalculationOutputs) (Record, error) {
+	if err := validDate(date); err != nil {
+		return Record{}, err
+	}
+	// Outputs that record which day they're for must be saved as that day
+	if (outputs.Date != "" && outputs.Date != date) || (outputs.ProgramID != "" && outputs.ProgramID != programID) {
+		return Record{}, fmt.Errorf("outputs for %v on %v can't be saved as %v on %v", outputs.ProgramID, outputs.Date, programID, date)
+	}
+	hash, err := HashOutputs(outputs)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{ProgramID: programID, Date: date, Hash: hash, Outputs: outputs}, nil
+}
+
+// Check that the record still matches its hash, and is for the day it was read as
+func (r Record) verify(programID string, date types.Date) error {
+	if r.ProgramID != programID || r.Date != date {
+		return fmt.Errorf("record for %v on %v was stored as %v on %v: %w", programID, date, r.ProgramID, r.Date, ErrHashMismatch)
+	}
+	hash, err := HashOutputs(r.Outputs)
+	if err != nil {
+		return err
+	}
+	if hash != r.Hash {
+		return fmt.Errorf("outputs for %v on %v hash to %v, but were stored with %v: %w", programID, date, hash, r.Hash, ErrHashMismatch)
+	}
+	return nil
+}
+
+// Decide whether to write a new record over an existing one
+func shouldWrite(existing *Record, record Record, o saveOptions) (bool, error) {
+	if existing == nil || o.force {
+		return true, nil
+	}
+	if existing.Hash == record.Hash {
+		return false, nil
+	}
+	// Say why they differ, so a rerun over the wrong inputs is obvious
+	reason := "calculated from the same inputs"
+	if diff := existing.Outputs.Inputs.Diff(record.Outputs.Inputs); len(diff) > 0 {
+		reason = "calculated from different " + strings.Join(diff, ", ")
+	}
+	return false, fmt.Errorf("outputs for %v on %v were already saved with hash %v, not %v (%v): %w", record.ProgramID, record.Date, existing.Hash, record.Hash, reason, ErrAlreadyExists)
+}
+
+// Decide whether to write a program over an existing one with the same ID
+func shouldWriteProgram(existing *types.YieldProgram, program types.YieldProgram, o saveOptions) (bool, error) {
+	if existing == nil || o.force {
+		return true, nil
+	}
+	existingDigest, err := types.Digest(*existing)
+	if err != nil {
+		return false, fmt.Errorf("failed to digest stored program: %w", err)
+	}
+	digest, err := types.Digest(program)
+	if err != nil {
+		return false, fmt.Errorf("failed to digest program: %w", err)
+	}
+	if existingDigest == digest {
+		return false, nil
+	}
+	return false, fmt.Errorf("program %v was already saved with digest %v, not %v: %w", program.ID, existingDigest, digest, ErrAlreadyExists)
+}
+
+func validDate(date types.Date) error {
+	if _, err := time.Parse(types.DateFormat, date); err != nil {
+		return fmt.Errorf("invalid date %v: %w", date, err)
+	}
+	return nil
+}
+
+// Load the outputs from the days before `date` that feed into its delegation window, oldest first, ready to pass to
+// yield.CalculateEarnings; the days are those of yield.DelegationWindowDates. Any missing day is an error, rather than
+// silently shrinking the window
+func PreviousResults(ctx context.Context, s ResultStore, program types.YieldProgram, date types.Date) ([]yield.CalculationOutputs, error) {
+	dates, err := yield.DelegationWindowDates(program, date)
+	if err != nil {
+		return nil, err
+	}
+	var previous []yield.CalculationOutputs
+	for _, previousDate := range dates {
+		outputs, err := s.Outputs(ctx, program.ID, previousDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the delegation window for %v: %w", date, err)
+		}
+		previous = append(previous, outputs)
+	}
+	return previous, nil
+}
+
+// A record's earnings, grouped by each key they're indexed under: their owner's ID, and the (lower case) hash of their
+// owner's multisig script. Earnings without an owner ID are only indexed by script hash
+func indexEarnings(record Record) (byOwnerID map[string][]types.Earning, byScriptHash map[string][]types.Earning, err error) {
+	byOwnerID = map[string][]types.Earning{}
+	byScriptHash = map[string][]types.Earning{}
+	for _, earning := range record.Outputs.Earnings {
+		hash, err := earning.Owner.Hash()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to hash owner of %v: %w", earning.OwnerID, err)
+		}
+		if earning.OwnerID != "" {
+			byOwnerID[earning.OwnerID] = append(byOwnerID[earning.OwnerID], earning)
+		}
+		hash = strings.ToLower(hash)
+		byScriptHash[hash] = append(byScriptHash[hash], earning)
+	}
+	return byOwnerID, byScriptHash, nil
+}
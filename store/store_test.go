@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/utilities"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/calculation/yield"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/tj/assert"
+)
+
+func sampleEarning(ownerID string, program string, date types.Date, amount int64) types.Earning {
+	return types.Earning{
+		OwnerID:    ownerID,
+		Owner:      types.MultisigScript{Signature: &types.Signature{KeyHash: []byte(ownerID)}},
+		Program:    program,
+		EarnedDate: date,
+		Value:      compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "99b071ce8580d6a3a11b4902145adb8bfd0d2a03935af8cf66403e15.53554e444145", Amount: num.Int64(amount)})),
+	}
+}
+
+// The behaviour every ResultStore should share
+func testResultStore(t *testing.T, s ResultStore) {
+	ctx := context.Background()
+
+	programs, err := s.Programs(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, programs, 0)
+
+	program := utilities.SampleYieldProgram(500_000_000)
+	other := utilities.SampleYieldProgram(100)
+	other.ID = "Other/Program"
+	assert.Nil(t, s.SaveProgram(ctx, program))
+	assert.Nil(t, s.SaveProgram(ctx, other))
+	assert.NotNil(t, s.SaveProgram(ctx, types.YieldProgram{}))
+
+	// Saving the same program again is fine, but a different one with the same ID is refused, unless forced
+	assert.Nil(t, s.SaveProgram(ctx, program))
+	changed := program
+	changed.EmittedAsset = "Other"
+	assert.True(t, errors.Is(s.SaveProgram(ctx, changed), ErrAlreadyExists))
+	saved, err := s.Program(ctx, program.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, program, saved)
+	assert.Nil(t, s.SaveProgram(ctx, changed, Force()))
+	saved, err = s.Program(ctx, program.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, changed, saved)
+	assert.Nil(t, s.SaveProgram(ctx, program, Force()))
+
+	programs, err = s.Programs(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, programs, 2)
+	assert.EqualValues(t, "Other/Program", programs[0].ID)
+	assert.EqualValues(t, program, programs[1])
+
+	_, err = s.Program(ctx, "Missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.Nil(t, s.SaveOutputs(ctx, program.ID, "2024-01-02", yield.CalculationOutputs{
+		EmissionsByPool: map[string]uint64{"01": 200},
+		Earnings:        []types.Earning{sampleEarning("A", program.ID, "2024-01-02", 200)},
+	}))
+	assert.Nil(t, s.SaveOutputs(ctx, program.ID, "2024-01-01", yield.CalculationOutputs{
+		EmissionsByPool: map[string]uint64{"01": 100},
+		Earnings: []types.Earning{
+			sampleEarning("A", program.ID, "2024-01-01", 100),
+			sampleEarning("B", program.ID, "2024-01-01", 50),
+		},
+	}))
+	assert.Nil(t, s.SaveOutputs(ctx, other.ID, "2024-01-01", yield.CalculationOutputs{
+		Earnings: []types.Earning{sampleEarning("A", other.ID, "2024-01-01", 1)},
+	}))
+	assert.NotNil(t, s.SaveOutputs(ctx, program.ID, "../../escape", yield.CalculationOutputs{}))
+
+	dates, err := s.Dates(ctx, program.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []types.Date{"2024-01-01", "2024-01-02"}, dates)
+
+	outputs, err := s.Outputs(ctx, program.ID, "2024-01-02")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 200, outputs.EmissionsByPool["01"])
+	_, err = s.Outputs(ctx, program.ID, "2024-01-03")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	earnings, err := s.EarningsByOwnerID(ctx, "A")
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 3)
+	assert.EqualValues(t, "2024-01-01", earnings[0].EarnedDate)
+	assert.EqualValues(t, other.ID, earnings[0].Program)
+	assert.EqualValues(t, program.ID, earnings[1].Program)
+	assert.EqualValues(t, "2024-01-02", earnings[2].EarnedDate)
+
+	hash, err := types.MultisigScript{Signature: &types.Signature{KeyHash: []byte("B")}}.Hash()
+	assert.Nil(t, err)
+	earnings, err = s.EarningsByScriptHash(ctx, hash)
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 1)
+	assert.EqualValues(t, "B", earnings[0].OwnerID)
+	earnings, err = s.EarningsByScriptHash(ctx, strings.ToUpper(hash))
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 1)
+
+	// Replacing a day replaces its earnings in the index, including for owners that no longer earn anything that day
+	assert.Nil(t, s.SaveOutputs(ctx, program.ID, "2024-01-01", yield.CalculationOutputs{
+		EmissionsByPool: map[string]uint64{"01": 100},
+		Earnings: []types.Earning{
+			sampleEarning("A", program.ID, "2024-01-01", 90),
+			sampleEarning("C", program.ID, "2024-01-01", 60),
+		},
+	}, Force()))
+	earnings, err = s.EarningsByOwnerID(ctx, "B")
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 0)
+	earnings, err = s.EarningsByScriptHash(ctx, hash)
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 0)
+	earnings, err = s.EarningsByOwnerID(ctx, "C")
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 1)
+	earnings, err = s.EarningsByOwnerID(ctx, "A")
+	assert.Nil(t, err)
+	assert.Len(t, earnings, 3)
+	assert.EqualValues(t, sampleEarning("A", program.ID, "2024-01-01", 90), earnings[1])
+}
+
+func testWriteOnce(t *testing.T, s ResultStore) {
+	ctx := context.Background()
+	outputs := yield.CalculationOutputs{
+		Timestamp:       "2024-01-01T00:00:00Z",
+		EmissionsByPool: map[string]uint64{"01": 100},
+		Earnings:        []types.Earning{sampleEarning("A", "TestYield", "2024-01-01", 100)},
+	}
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-01", outputs))
+	record, err := s.Record(ctx, "TestYield", "2024-01-01")
+	assert.Nil(t, err)
+	hash, err := HashOutputs(outputs)
+	assert.Nil(t, err)
+	assert.EqualValues(t, hash, record.Hash)
+
+	// Re-running the calculation gives the same outputs at a different time, which is fine, and keeps the original
+	rerun := outputs
+	rerun.Timestamp = "2024-01-02T00:00:00Z"
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-01", rerun))
+	saved, err := s.Outputs(ctx, "TestYield", "2024-01-01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "2024-01-01T00:00:00Z", saved.Timestamp)
+
+	// But different outputs are refused
+	changed := outputs
+	changed.EmissionsByPool = map[string]uint64{"01": 101}
+	err = s.SaveOutputs(ctx, "TestYield", "2024-01-01", changed)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	assert.Contains(t, err.Error(), "calculated from the same inputs")
+	saved, err = s.Outputs(ctx, "TestYield", "2024-01-01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 100, saved.EmissionsByPool["01"])
+
+	// And the error says which inputs changed, if any did
+	changedInputs := changed
+	changedInputs.Inputs.Positions = "changed"
+	err = s.SaveOutputs(ctx, "TestYield", "2024-01-01", changedInputs)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	assert.Contains(t, err.Error(), "calculated from different positions")
+
+	// Unless forced
+	assert.Nil(t, s.SaveOutputs(ctx, "TestYield", "2024-01-01", changed, Force()))
+	saved, err = s.Outputs(ctx, "TestYield", "2024-01-01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 101, saved.EmissionsByPool["01"])
+}
+
+func Test_PreviousResults(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(t.TempDir())
+	program := utilities.SampleYieldProgram(1000)
+	program.FirstDailyRewards = "2024-01-01"
+	program.ConsecutiveDelegationWindow = 3
+	for _, date := range []types.Date{"2024-01-01", "2024-01-02", "2024-01-03"} {
+		assert.Nil(t, s.SaveOutputs(ctx, program.ID, date, yield.CalculationOutputs{Date: date, ProgramID: program.ID, QualifyingDelegationByPool: map[string]uint64{date: 1}}))
+	}
+
+	// The two days before, oldest first
+	previous, err := PreviousResults(ctx, s, program, "2024-01-04")
+	assert.Nil(t, err)
+	assert.Len(t, previous, 2)
+	assert.EqualValues(t, "2024-01-02", previous[0].Date)
+	assert.EqualValues(t, "2024-01-03", previous[1].Date)
+
+	// While the program is starting up, there are fewer days
+	previous, err = PreviousResults(ctx, s, program, "2024-01-02")
+	assert.Nil(t, err)
+	assert.Len(t, previous, 1)
+	previous, err = PreviousResults(ctx, s, program, "2024-01-01")
+	assert.Nil(t, err)
+	assert.Len(t, previous, 0)
+
+	// Outputs can only be saved as the day they were calculated for
+	assert.NotNil(t, s.SaveOutputs(ctx, program.ID, "2024-01-05", yield.CalculationOutputs{Date: "2024-01-04", ProgramID: program.ID}))
+	assert.NotNil(t, s.SaveOutputs(ctx, "Other", "2024-01-04", yield.CalculationOutputs{Date: "2024-01-04", ProgramID: program.ID}))
+
+	// A missing day is an error
+	_, err = PreviousResults(ctx, s, program, "2024-01-06")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// A window of one day needs no history
+	program.ConsecutiveDelegationWindow = 1
+	previous, err = PreviousResults(ctx, s, program, "2024-01-06")
+	assert.Nil(t, err)
+	assert.Len(t, previous, 0)
+
+	// And the results feed straight into the calculation
+	program.ConsecutiveDelegationWindow = 3
+	previous, err = PreviousResults(ctx, s, program, "2024-01-04")
+	assert.Nil(t, err)
+	window, err := yield.SumDelegationWindow(program, "2024-01-04", map[string]uint64{"2024-01-04": 1}, previous)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]uint64{"2024-01-02": 1, "2024-01-03": 1, "2024-01-04": 1}, window)
+}
@@ -0,0 +1,312 @@
+package txbuilder
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Every output needs this many bytes of overhead, on top of its own size, to be covered by the minimum lovelace
+const outputOverhead = 160
+
+// The size of a single verification key witness: an array of a 32 byte key and a 64 byte signature
+const vkeyWitnessSize = 1 + 2 + 32 + 2 + 64
+
+// Balancing converges within a couple of rounds, since only the fee, change and collateral move
+const maxBalanceRounds = 10
+
+// What a transaction needs to do, before it's balanced
+type plan struct {
+	// Positions spent from the freezer
+	scriptInputs []shared.Utxo
+	outputs      []output
+	// Pays the fee and collateral, and receives the change
+	wallet string
+
+	signers    [][]byte
+	validFrom  *uint64
+	validUntil *uint64
+	exUnits    ExUnits
+}
+
+// The lovelace an output needs to hold; the amount is assumed to take the full 8 bytes, so adding it can't push the output over
+func (b *Builder) minLovelace(o output) (uint64, error) {
+	o.Value = withLovelace(o.Value, 1<<63)
+	encoded, err := encodeOutput(o)
+	if err != nil {
+		return 0, err
+	}
+	return (outputOverhead + uint64(len(encoded))) * b.Params.CoinsPerUTxOByte, nil
+}
+
+// The price of the scripts, rounded up
+func (b *Builder) scriptFee(p plan) uint64 {
+	if len(p.scriptInputs) == 0 {
+		return 0
+	}
+	count := int64(len(p.scriptInputs))
+	price := big.NewRat(0, 1)
+	if b.Params.PriceMemory != nil {
+		price.Add(price, big.NewRat(0, 1).Mul(b.Params.PriceMemory, big.NewRat(int64(p.exUnits.Memory)*count, 1)))
+	}
+	if b.Params.PriceSteps != nil {
+		price.Add(price, big.NewRat(0, 1).Mul(b.Params.PriceSteps, big.NewRat(int64(p.exUnits.Steps)*count, 1)))
+	}
+	fee, remainder := big.NewInt(0).QuoRem(price.Num(), price.Denom(), big.NewInt(0))
+	if remainder.Sign() != 0 {
+		fee.Add(fee, big.NewInt(1))
+	}
+	return fee.Uint64()
+}
+
+// The size the signatures will add to the unsigned transaction: one for the wallet, and one for each other signer
+func witnessSize(p plan) (uint64, error) {
+	keys := map[string]bool{}
+	address, err := types.ParseAddress(p.wallet)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wallet address %v: %w", p.wallet, err)
+	}
+	if address.Payment.Kind == types.KeyCredential {
+		keys[string(address.Payment.Hash)] = true
+	}
+	for _, signer := range p.signers {
+		keys[string(signer)] = true
+	}
+	// The map key and array header for the witnesses
+	return 4 + uint64(len(keys))*vkeyWitnessSize, nil
+}
+
+// Balance the plan with UTxOs from the wallet, raising the fee until it covers the final size of the transaction
+func (b *Builder) build(ctx context.Context, p plan) (*Transaction, error) {
+	walletUTxOs, err := b.UTxOs.UTxOsAt(ctx, p.wallet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the wallet's UTxOs: %w", err)
+	}
+	// Spend the largest UTxOs first, so as few as possible are needed
+	candidates := append([]shared.Utxo{}, walletUTxOs...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].Value.AdaLovelace(), candidates[j].Value.AdaLovelace()
+		if !a.Equal(b) {
+			return a.GreaterThan(b)
+		}
+		return refOf(candidates[i]).String() < refOf(candidates[j]).String()
+	})
+	witnesses, err := witnessSize(p)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := uint64(0)
+	for round := 0; round < maxBalanceRounds; round++ {
+		tx, err := b.assemble(p, candidates, fee)
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(len(tx.CBOR)) + witnesses
+		required := b.Params.MinFeeA*size + b.Params.MinFeeB + b.scriptFee(p)
+		if required <= fee {
+			if b.Params.MaxTxSize > 0 && size > b.Params.MaxTxSize {
+				return nil, fmt.Errorf("transaction is %v bytes, more than the maximum of %v", size, b.Params.MaxTxSize)
+			}
+			return tx, nil
+		}
+		fee = required
+	}
+	return nil, fmt.Errorf("failed to balance the transaction after %v rounds", maxBalanceRounds)
+}
+
+// Whether every amount is at least zero
+func nonNegative(value shared.Value) bool {
+	for _, policyMap := range value {
+		for _, amount := range policyMap {
+			if amount.BigInt().Sign() < 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// An asset the inputs are short of, other than lovelace
+func missingAsset(leftover shared.Value) (shared.AssetID, bool) {
+	for policy, policyMap := range leftover.AssetsExceptAda() {
+		for assetName, amount := range policyMap {
+			if amount.BigInt().Sign() < 0 {
+				return shared.FromSeparate(policy, assetName), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Select inputs to pay for the outputs and the fee, and assemble the transaction with the change going back to the wallet
+func (b *Builder) assemble(p plan, candidates []shared.Utxo, fee uint64) (*Transaction, error) {
+	spent := shared.CreateAdaValue(int64(fee))
+	for _, o := range p.outputs {
+		spent = shared.Add(spent, o.Value)
+	}
+
+	inputs := append([]shared.Utxo{}, p.scriptInputs...)
+	used := map[Ref]bool{}
+	for {
+		leftover := shared.Subtract(totalValue(inputs), spent)
+		change := output{Address: p.wallet, Value: leftover}
+		if nonNegative(leftover) {
+			minChange, err := b.minLovelace(change)
+			if err != nil {
+				return nil, err
+			}
+			if leftover.AdaLovelace().Uint64() >= minChange {
+				break
+			}
+		}
+		// Take a UTxO with whatever asset is missing, or else the largest remaining one
+		next := -1
+		missing, isMissing := missingAsset(leftover)
+		for i, candidate := range candidates {
+			if used[refOf(candidate)] {
+				continue
+			}
+			if !isMissing || candidate.Value.AssetAmount(missing).BigInt().Sign() > 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			if isMissing {
+				return nil, fmt.Errorf("wallet doesn't hold enough %v: %w", missing, shared.ErrInsufficientFunds)
+			}
+			return nil, fmt.Errorf("wallet doesn't hold enough lovelace: %w", shared.ErrInsufficientFunds)
+		}
+		used[refOf(candidates[next])] = true
+		inputs = append(inputs, candidates[next])
+	}
+	outputs := append(append([]output{}, p.outputs...), output{Address: p.wallet, Value: shared.Subtract(totalValue(inputs), spent)})
+
+	body := map[uint64]any{
+		bodyFee:       fee,
+		bodyNetworkID: uint64(b.Network),
+	}
+	sortInputs(inputs)
+	encodedInputs, err := encodeInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	body[bodyInputs] = encodedInputs
+	var encodedOutputs []any
+	for _, o := range outputs {
+		encoded, err := encodeOutput(o)
+		if err != nil {
+			return nil, err
+		}
+		encodedOutputs = append(encodedOutputs, encoded)
+	}
+	body[bodyOutputs] = encodedOutputs
+	if p.validFrom != nil {
+		body[bodyValidFrom] = *p.validFrom
+	}
+	if p.validUntil != nil {
+		body[bodyValidUntil] = *p.validUntil
+	}
+	if len(p.signers) > 0 {
+		body[bodyRequiredSigners] = p.signers
+	}
+
+	witnessSet := map[uint64]any{}
+	if len(p.scriptInputs) > 0 {
+		scriptRefs := map[Ref]bool{}
+		for _, utxo := range p.scriptInputs {
+			scriptRefs[refOf(utxo)] = true
+		}
+		var redeemerIndexes []int
+		for i, input := range inputs {
+			if scriptRefs[refOf(input)] {
+				redeemerIndexes = append(redeemerIndexes, i)
+			}
+		}
+		redeemers, err := encodeRedeemers(redeemerIndexes, p.exUnits)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := scriptDataHash(redeemers, b.Params.CostModelV2)
+		if err != nil {
+			return nil, err
+		}
+		body[bodyScriptDataHash] = hash
+		code, err := b.Freezer.Code()
+		if err != nil {
+			return nil, err
+		}
+		witnessSet[witnessPlutusV2Scripts] = [][]byte{code}
+		witnessSet[witnessRedeemers] = redeemers
+
+		if err := b.addCollateral(body, candidates, p.wallet, fee); err != nil {
+			return nil, err
+		}
+	}
+
+	encodedBody, err := canonical.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction body: %w", err)
+	}
+	encodedWitnesses, err := canonical.Marshal(witnessSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode witnesses: %w", err)
+	}
+	encoded, err := canonical.Marshal([]any{cbor.RawMessage(encodedBody), cbor.RawMessage(encodedWitnesses), true, nil})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction: %w", err)
+	}
+
+	tx := &Transaction{
+		CBOR:       encoded,
+		ID:         hex.EncodeToString(blake2b256(encodedBody)),
+		Fee:        fee,
+		ValidFrom:  p.validFrom,
+		ValidUntil: p.validUntil,
+	}
+	for _, signer := range p.signers {
+		tx.RequiredSigners = append(tx.RequiredSigners, hex.EncodeToString(signer))
+	}
+	return tx, nil
+}
+
+// Put up the largest UTxO of only lovelace as collateral, returning whatever's above the required amount
+func (b *Builder) addCollateral(body map[uint64]any, candidates []shared.Utxo, wallet string, fee uint64) error {
+	required := (fee*b.Params.CollateralPercent + 99) / 100
+	for _, candidate := range candidates {
+		if candidate.Value.AssetsExceptAdaCount() > 0 {
+			continue
+		}
+		returned := output{Address: wallet, Value: withLovelace(shared.Value{}, 0)}
+		minReturn, err := b.minLovelace(returned)
+		if err != nil {
+			return err
+		}
+		lovelace := candidate.Value.AdaLovelace().Uint64()
+		if lovelace < required+minReturn {
+			// The candidates are ordered largest first, so none of the rest will do either
+			break
+		}
+		returned.Value = withLovelace(shared.Value{}, lovelace-required)
+		encodedReturn, err := encodeOutput(returned)
+		if err != nil {
+			return err
+		}
+		collateral, err := encodeInputs([]shared.Utxo{candidate})
+		if err != nil {
+			return err
+		}
+		body[bodyCollateral] = collateral
+		body[bodyCollateralReturn] = encodedReturn
+		body[bodyTotalCollateral] = required
+		return nil
+	}
+	return fmt.Errorf("wallet has no UTxO of only lovelace to put up %v lovelace of collateral: %w", required, shared.ErrInsufficientFunds)
+}
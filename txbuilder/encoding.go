@@ -0,0 +1,169 @@
+package txbuilder
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Keys of the transaction body, and of the witness set, from the Babbage CDDL (unchanged in Conway)
+const (
+	bodyInputs           = 0
+	bodyOutputs          = 1
+	bodyFee              = 2
+	bodyValidUntil       = 3
+	bodyValidFrom        = 8
+	bodyScriptDataHash   = 11
+	bodyCollateral       = 13
+	bodyRequiredSigners  = 14
+	bodyNetworkID        = 15
+	bodyCollateralReturn = 16
+	bodyTotalCollateral  = 17
+
+	witnessPlutusV2Scripts = 6
+	witnessRedeemers       = 5
+
+	outputAddress = 0
+	outputValue   = 1
+	outputDatum   = 2
+
+	// A datum option holding the datum itself, rather than its hash
+	inlineDatum = 1
+	// CBOR tag for bytes that are themselves CBOR
+	encodedCBORTag = 24
+	// The redeemer tag for spending an input
+	spendRedeemer = 0
+)
+
+// The freezer ignores its redeemer, so it's always the unit constructor
+var voidRedeemer = cbor.RawMessage{0xd8, 0x79, 0x80}
+
+// Scripts, maps with bytes for keys and so on are encoded canonically, so the same transaction always has the same bytes
+var canonical = func() cbor.EncMode {
+	mode, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		panic(fmt.Sprintf("failed to create CBOR encoder: %v", err))
+	}
+	return mode
+}()
+
+func blake2b256(bytes []byte) []byte {
+	hash := blake2b.Sum256(bytes)
+	return hash[:]
+}
+
+// An output, before it's encoded
+type output struct {
+	Address string
+	Value   shared.Value
+	// The CBOR encoded inline datum, if any
+	Datum []byte
+}
+
+func addressBytes(address string) ([]byte, error) {
+	if _, err := types.ParseAddress(address); err != nil {
+		return nil, err
+	}
+	_, bytes, err := types.DecodeBech32(address)
+	return bytes, err
+}
+
+// Encode a value as either plain lovelace, or lovelace alongside a map from policy to asset name to amount
+func encodeValue(value shared.Value) (any, error) {
+	lovelace := value.AdaLovelace()
+	if lovelace.BigInt().Sign() < 0 || !lovelace.BigInt().IsUint64() {
+		return nil, fmt.Errorf("invalid lovelace amount %v", lovelace)
+	}
+	assets := map[cbor.ByteString]map[cbor.ByteString]uint64{}
+	for policy, policyMap := range value.AssetsExceptAda() {
+		policyBytes, err := hex.DecodeString(policy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy %v: %w", policy, err)
+		}
+		for assetName, amount := range policyMap {
+			if amount.BigInt().Sign() == 0 {
+				continue
+			}
+			if amount.BigInt().Sign() < 0 || !amount.BigInt().IsUint64() {
+				return nil, fmt.Errorf("invalid amount %v of %v.%v", amount, policy, assetName)
+			}
+			assetNameBytes, err := hex.DecodeString(assetName)
+			if err != nil {
+				return nil, fmt.Errorf("invalid asset name %v: %w", assetName, err)
+			}
+			if _, ok := assets[cbor.ByteString(policyBytes)]; !ok {
+				assets[cbor.ByteString(policyBytes)] = map[cbor.ByteString]uint64{}
+			}
+			assets[cbor.ByteString(policyBytes)][cbor.ByteString(assetNameBytes)] = amount.Uint64()
+		}
+	}
+	if len(assets) == 0 {
+		return lovelace.Uint64(), nil
+	}
+	return []any{lovelace.Uint64(), assets}, nil
+}
+
+func encodeOutput(o output) (cbor.RawMessage, error) {
+	address, err := addressBytes(o.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output address %v: %w", o.Address, err)
+	}
+	value, err := encodeValue(o.Value)
+	if err != nil {
+		return nil, err
+	}
+	encoded := map[uint64]any{outputAddress: address, outputValue: value}
+	if o.Datum != nil {
+		encoded[outputDatum] = []any{inlineDatum, cbor.Tag{Number: encodedCBORTag, Content: o.Datum}}
+	}
+	return canonical.Marshal(encoded)
+}
+
+func encodeInputs(utxos []shared.Utxo) ([]any, error) {
+	inputs := make([]any, 0, len(utxos))
+	for _, utxo := range utxos {
+		txHash, err := hex.DecodeString(utxo.Transaction.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction hash %v: %w", utxo.Transaction.ID, err)
+		}
+		inputs = append(inputs, []any{txHash, utxo.Index})
+	}
+	return inputs, nil
+}
+
+// The ledger treats inputs as a set, ordered by transaction hash and then index; redeemers point into that order
+func sortInputs(utxos []shared.Utxo) {
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].Transaction.ID != utxos[j].Transaction.ID {
+			return utxos[i].Transaction.ID < utxos[j].Transaction.ID
+		}
+		return utxos[i].Index < utxos[j].Index
+	})
+}
+
+// The redeemers, in the legacy list format that both Babbage and Conway accept
+func encodeRedeemers(redeemerIndexes []int, exUnits ExUnits) (cbor.RawMessage, error) {
+	redeemers := make([]any, 0, len(redeemerIndexes))
+	for _, index := range redeemerIndexes {
+		redeemers = append(redeemers, []any{spendRedeemer, index, voidRedeemer, []any{exUnits.Memory, exUnits.Steps}})
+	}
+	return canonical.Marshal(redeemers)
+}
+
+// The hash that commits the body to the redeemers and the cost models they run under; there are no datums to include,
+// since every datum is inline
+func scriptDataHash(redeemers cbor.RawMessage, costModel []int64) ([]byte, error) {
+	languageViews, err := canonical.Marshal(map[uint64][]int64{plutusV2Language: costModel})
+	if err != nil {
+		return nil, err
+	}
+	return blake2b256(append(append([]byte{}, redeemers...), languageViews...)), nil
+}
+
+// The key of the Plutus V2 cost model, in the language views
+const plutusV2Language = 1
@@ -0,0 +1,55 @@
+package txbuilder
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/tj/assert"
+)
+
+func Test_EncodeValue(t *testing.T) {
+	value, err := encodeValue(shared.CreateAdaValue(2_000_000))
+	assert.Nil(t, err)
+	encoded, err := canonical.Marshal(value)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "1a001e8480", hex.EncodeToString(encoded))
+
+	// Assets that have been spent down to nothing are left out
+	withZero := shared.Add(shared.CreateAdaValue(2_000_000), shared.Value{testPolicy: {testAsset: num.Int64(0)}})
+	value, err = encodeValue(withZero)
+	assert.Nil(t, err)
+	assert.EqualValues(t, uint64(2_000_000), value)
+
+	value, err = encodeValue(shared.Add(shared.CreateAdaValue(2_000_000), shared.Value{testPolicy: {testAsset: num.Int64(5)}}))
+	assert.Nil(t, err)
+	encoded, err = canonical.Marshal(value)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "821a001e8480a1581c"+testPolicy+"a146"+testAsset+"05", hex.EncodeToString(encoded))
+
+	_, err = encodeValue(shared.Value{testPolicy: {testAsset: num.Int64(-1)}})
+	assert.NotNil(t, err)
+	_, err = encodeValue(shared.CreateAdaValue(-1))
+	assert.NotNil(t, err)
+}
+
+func Test_SortInputs(t *testing.T) {
+	utxos := []shared.Utxo{
+		utxo(txHash(2), 0, testWallet, 1, ""),
+		utxo(txHash(1), 10, testWallet, 1, ""),
+		utxo(txHash(1), 2, testWallet, 1, ""),
+	}
+	sortInputs(utxos)
+	assert.EqualValues(t, []Ref{{txHash(1), 2}, {txHash(1), 10}, {txHash(2), 0}}, []Ref{refOf(utxos[0]), refOf(utxos[1]), refOf(utxos[2])})
+}
+
+func Test_EncodeOutput(t *testing.T) {
+	encoded, err := encodeOutput(output{Address: testWallet, Value: shared.CreateAdaValue(1), Datum: []byte{0xd8, 0x79, 0x80}})
+	assert.Nil(t, err)
+	address := "60" + "9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e"
+	assert.EqualValues(t, "a300581d"+address+"0101028201d81843d87980", hex.EncodeToString(encoded))
+
+	_, err = encodeOutput(output{Address: "not an address", Value: shared.CreateAdaValue(1)})
+	assert.NotNil(t, err)
+}
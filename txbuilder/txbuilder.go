@@ -0,0 +1,381 @@
+package txbuilder
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/blueprint"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/owner"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// The execution budget of a script
+type ExUnits struct {
+	Memory uint64
+	Steps  uint64
+}
+
+// A generous budget for spending a single freezer input, which only checks the owner script; callers that can evaluate
+// the transaction (for example with Ogmios) should pass the actual units instead
+var DefaultSpendExUnits = ExUnits{Memory: 1_000_000, Steps: 500_000_000}
+
+// The protocol parameters that go into sizing and balancing a transaction
+type ProtocolParameters struct {
+	// The fee is MinFeeA lovelace per byte, plus MinFeeB, plus the price of any scripts
+	MinFeeA uint64
+	MinFeeB uint64
+	// Every output must hold at least this much lovelace per byte
+	CoinsPerUTxOByte uint64
+	// The price of each unit of script memory and steps, in lovelace
+	PriceMemory *big.Rat
+	PriceSteps  *big.Rat
+	// The collateral for a transaction with scripts, as a percentage of the fee
+	CollateralPercent uint64
+	// The largest transaction allowed, in bytes; 0 for no limit
+	MaxTxSize   uint64
+	CostModelV2 []int64
+}
+
+// Supplies the unspent outputs at an address, such as from Ogmios, Kupo or Blockfrost
+type UTxOProvider interface {
+	UTxOsAt(ctx context.Context, address string) ([]shared.Utxo, error)
+}
+
+type UTxOProviderFunc func(ctx context.Context, address string) ([]shared.Utxo, error)
+
+func (f UTxOProviderFunc) UTxOsAt(ctx context.Context, address string) ([]shared.Utxo, error) {
+	return f(ctx, address)
+}
+
+// Builds unsigned transactions to lock, unlock and re-delegate positions in the freezer; the transactions are valid in
+// both the Babbage and Conway eras, and are left for the owner (and the wallet paying the fees) to sign
+type Builder struct {
+	Network types.Network
+	// How the times in owner scripts map to slots
+	Slots   types.SlotConfig
+	Params  ProtocolParameters
+	UTxOs   UTxOProvider
+	Freezer *blueprint.Validator
+}
+
+// Create a builder for the network; testnet addresses don't say which testnet they're on, so the network's slot
+// config (such as types.PreviewSlotConfig) is given separately
+func NewBuilder(network types.Network, slots types.SlotConfig, params ProtocolParameters, utxos UTxOProvider) (*Builder, error) {
+	if err := slots.Validate(); err != nil {
+		return nil, err
+	}
+	freezer, err := blueprint.Freezer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the freezer: %w", err)
+	}
+	return &Builder{Network: network, Slots: slots, Params: params, UTxOs: utxos, Freezer: freezer}, nil
+}
+
+// An unsigned transaction
+type Transaction struct {
+	CBOR []byte
+	// The hash of the transaction body
+	ID  string
+	Fee uint64
+
+	// The hex encoded key hashes that must sign the transaction, besides the wallet paying for it
+	RequiredSigners []string
+	// The slots the transaction is valid from, and until (exclusive)
+	ValidFrom  *uint64
+	ValidUntil *uint64
+}
+
+func (t *Transaction) Hex() string {
+	return hex.EncodeToString(t.CBOR)
+}
+
+// A reference to an output of an earlier transaction
+type Ref struct {
+	TxHash string
+	Index  uint32
+}
+
+// Parse a reference in the form used by builder/unlock.ts, "<tx hash>#<index>"
+func ParseRef(ref string) (Ref, error) {
+	txHash, index, ok := strings.Cut(ref, "#")
+	if !ok {
+		return Ref{}, fmt.Errorf("invalid reference %v; expected <tx hash>#<index>", ref)
+	}
+	if _, err := hex.DecodeString(txHash); err != nil || len(txHash) != 64 {
+		return Ref{}, fmt.Errorf("invalid transaction hash in %v", ref)
+	}
+	i, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return Ref{}, fmt.Errorf("invalid index in %v: %w", ref, err)
+	}
+	return Ref{TxHash: strings.ToLower(txHash), Index: uint32(i)}, nil
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%v#%v", r.TxHash, r.Index)
+}
+
+func refOf(utxo shared.Utxo) Ref {
+	return Ref{TxHash: utxo.Transaction.ID, Index: utxo.Index}
+}
+
+// How positions are spent from the freezer; the owner script of every position has to be satisfied, with as few of the
+// signers as possible, and within the validity range
+type SpendOptions struct {
+	// The hex encoded key hashes that are able to sign for the owners; by default, any key in the owner scripts
+	Signers []string
+	// The slots the transaction may be valid from, and until (exclusive); the range is narrowed to whatever the owners'
+	// time locks need
+	ValidFrom  *uint64
+	ValidUntil *uint64
+	// The budget for spending each position; DefaultSpendExUnits if not set
+	ExUnits *ExUnits
+}
+
+// Lock assets in the freezer, delegated as given; the wallet pays for it, and receives any change
+type LockRequest struct {
+	Owner       types.MultisigScript
+	Delegations []types.Delegation
+	Value       shared.Value
+	Wallet      string
+}
+
+// Unlock positions from the freezer, sending everything they held to an address; the wallet pays the fees and collateral
+type UnlockRequest struct {
+	Positions []Ref
+	// Where to send the unlocked assets; the wallet, if not set
+	To     string
+	Wallet string
+	SpendOptions
+}
+
+// Unlock positions and lock everything they held again, with new delegations, in a single transaction;
+// every position must have the same owner, who keeps ownership
+type RedelegateRequest struct {
+	Positions   []Ref
+	Delegations []types.Delegation
+	Wallet      string
+	// Send the lovelace above the minimum back to the wallet, rather than locking it again; merging several positions
+	// frees the minimum lovelace each of them had to hold
+	ReturnExcessLovelace bool
+	SpendOptions
+}
+
+func (b *Builder) Lock(ctx context.Context, request LockRequest) (*Transaction, error) {
+	locked, err := b.freezerOutput(request.Owner, request.Delegations, request.Value)
+	if err != nil {
+		return nil, err
+	}
+	return b.build(ctx, plan{outputs: []output{locked}, wallet: request.Wallet})
+}
+
+func (b *Builder) Unlock(ctx context.Context, request UnlockRequest) (*Transaction, error) {
+	positions, owners, err := b.positions(ctx, request.Positions)
+	if err != nil {
+		return nil, err
+	}
+	to := request.To
+	if to == "" {
+		to = request.Wallet
+	}
+	unlocked := output{Address: to, Value: totalValue(positions)}
+	return b.spend(ctx, positions, owners, []output{unlocked}, request.Wallet, request.SpendOptions)
+}
+
+func (b *Builder) Redelegate(ctx context.Context, request RedelegateRequest) (*Transaction, error) {
+	positions, owners, err := b.positions(ctx, request.Positions)
+	if err != nil {
+		return nil, err
+	}
+	ownerHash, err := owners[0].Hash()
+	if err != nil {
+		return nil, err
+	}
+	for i, owner := range owners[1:] {
+		hash, err := owner.Hash()
+		if err != nil {
+			return nil, err
+		}
+		if hash != ownerHash {
+			return nil, fmt.Errorf("position %v has a different owner than %v", refOf(positions[i+1]), refOf(positions[0]))
+		}
+	}
+	value := totalValue(positions)
+	if request.ReturnExcessLovelace {
+		// The freezer output is topped back up to the minimum, and the rest ends up in the change
+		value = withLovelace(value, 0)
+	}
+	relocked, err := b.freezerOutput(owners[0], request.Delegations, value)
+	if err != nil {
+		return nil, err
+	}
+	return b.spend(ctx, positions, owners, []output{relocked}, request.Wallet, request.SpendOptions)
+}
+
+// An output locking the value in the freezer, topped up to the minimum lovelace if needed
+func (b *Builder) freezerOutput(owner types.MultisigScript, delegations []types.Delegation, value shared.Value) (output, error) {
+	datum := types.StakeDatum{Owner: owner, Delegations: delegations}
+	if err := b.Freezer.ValidateStakeDatum(datum); err != nil {
+		return output{}, err
+	}
+	encoded, err := cbor.Marshal(&datum)
+	if err != nil {
+		return output{}, fmt.Errorf("failed to encode datum: %w", err)
+	}
+	address, err := b.Freezer.Address(b.Network)
+	if err != nil {
+		return output{}, err
+	}
+	locked := output{Address: address, Value: shared.Add(shared.Value{}, value), Datum: encoded}
+	minLovelace, err := b.minLovelace(locked)
+	if err != nil {
+		return output{}, err
+	}
+	if locked.Value.AdaLovelace().Uint64() < minLovelace {
+		locked.Value = withLovelace(locked.Value, minLovelace)
+	}
+	return locked, nil
+}
+
+// Find the positions in the freezer locked by each transaction; positions are usually known by the transaction that
+// locked them, rather than by reference
+func (b *Builder) PositionRefs(ctx context.Context, txHashes []string) ([]Ref, error) {
+	address, err := b.Freezer.Address(b.Network)
+	if err != nil {
+		return nil, err
+	}
+	utxos, err := b.UTxOs.UTxOsAt(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the freezer's UTxOs: %w", err)
+	}
+	byTxHash := map[string][]Ref{}
+	for _, utxo := range utxos {
+		txHash := strings.ToLower(utxo.Transaction.ID)
+		byTxHash[txHash] = append(byTxHash[txHash], refOf(utxo))
+	}
+	var refs []Ref
+	for _, txHash := range txHashes {
+		found := byTxHash[strings.ToLower(txHash)]
+		switch len(found) {
+		case 0:
+			return nil, fmt.Errorf("no position locked by %v is in the freezer", txHash)
+		case 1:
+			refs = append(refs, found[0])
+		default:
+			return nil, fmt.Errorf("%v locked %v positions; pick them by reference instead", txHash, len(found))
+		}
+	}
+	return refs, nil
+}
+
+// Find the positions in the freezer, and their owners
+func (b *Builder) positions(ctx context.Context, refs []Ref) ([]shared.Utxo, []types.MultisigScript, error) {
+	if len(refs) == 0 {
+		return nil, nil, fmt.Errorf("no positions to spend")
+	}
+	address, err := b.Freezer.Address(b.Network)
+	if err != nil {
+		return nil, nil, err
+	}
+	utxos, err := b.UTxOs.UTxOsAt(ctx, address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch the freezer's UTxOs: %w", err)
+	}
+	byRef := map[Ref]shared.Utxo{}
+	for _, utxo := range utxos {
+		byRef[refOf(utxo)] = utxo
+	}
+
+	var positions []shared.Utxo
+	var owners []types.MultisigScript
+	seen := map[Ref]bool{}
+	for _, ref := range refs {
+		if seen[ref] {
+			return nil, nil, fmt.Errorf("position %v is spent more than once", ref)
+		}
+		seen[ref] = true
+		utxo, ok := byRef[ref]
+		if !ok {
+			return nil, nil, fmt.Errorf("position %v is not in the freezer", ref)
+		}
+		datum, err := decodeDatum(utxo)
+		if err != nil {
+			return nil, nil, err
+		}
+		positions = append(positions, utxo)
+		owners = append(owners, datum.Owner)
+	}
+	return positions, owners, nil
+}
+
+func decodeDatum(utxo shared.Utxo) (types.StakeDatum, error) {
+	if utxo.Datum == "" {
+		return types.StakeDatum{}, fmt.Errorf("position %v has no inline datum", refOf(utxo))
+	}
+	bytes, err := hex.DecodeString(utxo.Datum)
+	if err != nil {
+		return types.StakeDatum{}, fmt.Errorf("invalid datum on position %v: %w", refOf(utxo), err)
+	}
+	var datum types.StakeDatum
+	if err := cbor.Unmarshal(bytes, &datum); err != nil {
+		return types.StakeDatum{}, fmt.Errorf("invalid datum on position %v: %w", refOf(utxo), err)
+	}
+	return datum, nil
+}
+
+// Spend positions from the freezer into the outputs
+func (b *Builder) spend(ctx context.Context, positions []shared.Utxo, owners []types.MultisigScript, outputs []output, wallet string, opts SpendOptions) (*Transaction, error) {
+	for _, signer := range opts.Signers {
+		if keyHash, err := hex.DecodeString(signer); err != nil || len(keyHash) != 28 {
+			return nil, fmt.Errorf("invalid signer %v", signer)
+		}
+	}
+	satisfaction, err := owner.SatisfyAll(owners, owner.Constraints{
+		Keys:  opts.Signers,
+		Slots: b.Slots,
+		From:  opts.ValidFrom,
+		Until: opts.ValidUntil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var signers [][]byte
+	for _, signer := range satisfaction.Signers {
+		keyHash, _ := hex.DecodeString(signer)
+		signers = append(signers, keyHash)
+	}
+	exUnits := DefaultSpendExUnits
+	if opts.ExUnits != nil {
+		exUnits = *opts.ExUnits
+	}
+	return b.build(ctx, plan{
+		scriptInputs: positions,
+		outputs:      outputs,
+		wallet:       wallet,
+		signers:      signers,
+		validFrom:    satisfaction.ValidFrom,
+		validUntil:   satisfaction.ValidUntil,
+		exUnits:      exUnits,
+	})
+}
+
+func totalValue(utxos []shared.Utxo) shared.Value {
+	total := shared.Value{}
+	for _, utxo := range utxos {
+		total = shared.Add(total, utxo.Value)
+	}
+	return total
+}
+
+func withLovelace(value shared.Value, lovelace uint64) shared.Value {
+	value = shared.Add(shared.Value{}, value)
+	value[shared.AdaPolicy] = map[string]num.Int{shared.AdaAsset: num.Uint64(lovelace)}
+	return value
+}
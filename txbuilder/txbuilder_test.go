@@ -0,0 +1,639 @@
+package txbuilder
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/owner"
+	"github.com/SundaeSwap-finance/sundae-yield-v2/types"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tj/assert"
+)
+
+const (
+	testWallet = "addr_test1vz2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzerspjrlsz"
+	testPolicy = "99b071ce8580d6a3a11b4902145adb8bfd0d2a03935af8cf66403e15"
+	testAsset  = "534245525259"
+	ownerKey   = "c279a3fb3b4e62bbc78e288783b58045d4ae82a18867d8352d02775a"
+	otherKey   = "121fd22e0b57ac206fefc763f8bfa0771919f5218b40691eea4514d0"
+)
+
+var testParams = ProtocolParameters{
+	MinFeeA:           44,
+	MinFeeB:           155381,
+	CoinsPerUTxOByte:  4310,
+	PriceMemory:       big.NewRat(577, 10_000),
+	PriceSteps:        big.NewRat(721, 10_000_000),
+	CollateralPercent: 150,
+	MaxTxSize:         16384,
+	CostModelV2:       []int64{205665, 812, 1, 1, 1000, 571, 0, 1},
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	bytes, err := hex.DecodeString(s)
+	assert.Nil(t, err)
+	return bytes
+}
+
+func signatureOwner(t *testing.T, keyHash string) types.MultisigScript {
+	return types.MultisigScript{Signature: &types.Signature{KeyHash: mustDecode(t, keyHash)}}
+}
+
+func txHash(i int) string {
+	return fmt.Sprintf("%064x", i)
+}
+
+func utxo(txID string, index uint32, address string, lovelace int64, datum string) shared.Utxo {
+	return shared.Utxo{
+		Transaction: shared.UtxoTxID{ID: txID},
+		Index:       index,
+		Address:     address,
+		Value:       shared.CreateAdaValue(lovelace),
+		Datum:       datum,
+	}
+}
+
+func withAsset(u shared.Utxo, amount int64) shared.Utxo {
+	u.Value = shared.Add(u.Value, shared.Value{testPolicy: {testAsset: num.Int64(amount)}})
+	return u
+}
+
+func encodedDatum(t *testing.T, datum types.StakeDatum) string {
+	bytes, err := cbor.Marshal(&datum)
+	assert.Nil(t, err)
+	return hex.EncodeToString(bytes)
+}
+
+// A builder over a fixed set of UTxOs
+func testBuilder(t *testing.T, utxos ...shared.Utxo) *Builder {
+	builder, err := NewBuilder(types.Testnet, types.PreprodSlotConfig, testParams, UTxOProviderFunc(func(ctx context.Context, address string) ([]shared.Utxo, error) {
+		var at []shared.Utxo
+		for _, u := range utxos {
+			if u.Address == address {
+				at = append(at, u)
+			}
+		}
+		return at, nil
+	}))
+	assert.Nil(t, err)
+	return builder
+}
+
+func freezerAddress(t *testing.T, builder *Builder) string {
+	address, err := builder.Freezer.Address(types.Testnet)
+	assert.Nil(t, err)
+	return address
+}
+
+type decodedOutput struct {
+	Address []byte
+	Value   shared.Value
+	Datum   []byte
+}
+
+type decodedTx struct {
+	Body       map[uint64]cbor.RawMessage
+	Witnesses  map[uint64]cbor.RawMessage
+	Inputs     []Ref
+	Outputs    []decodedOutput
+	Fee        uint64
+	Collateral []Ref
+}
+
+func decodeRefs(t *testing.T, raw cbor.RawMessage) []Ref {
+	var inputs []struct {
+		_      struct{} `cbor:",toarray"`
+		TxHash []byte
+		Index  uint32
+	}
+	assert.Nil(t, cbor.Unmarshal(raw, &inputs))
+	var refs []Ref
+	for _, input := range inputs {
+		refs = append(refs, Ref{TxHash: hex.EncodeToString(input.TxHash), Index: input.Index})
+	}
+	return refs
+}
+
+func decodeOutput(t *testing.T, raw cbor.RawMessage) decodedOutput {
+	var fields map[uint64]cbor.RawMessage
+	assert.Nil(t, cbor.Unmarshal(raw, &fields))
+	var o decodedOutput
+	assert.Nil(t, cbor.Unmarshal(fields[outputAddress], &o.Address))
+
+	var lovelace uint64
+	if err := cbor.Unmarshal(fields[outputValue], &lovelace); err == nil {
+		o.Value = shared.CreateAdaValue(int64(lovelace))
+	} else {
+		var value struct {
+			_        struct{} `cbor:",toarray"`
+			Lovelace uint64
+			Assets   map[cbor.ByteString]map[cbor.ByteString]uint64
+		}
+		assert.Nil(t, cbor.Unmarshal(fields[outputValue], &value))
+		o.Value = shared.CreateAdaValue(int64(value.Lovelace))
+		for policy, assets := range value.Assets {
+			for assetName, amount := range assets {
+				o.Value = shared.Add(o.Value, shared.Value{
+					hex.EncodeToString([]byte(policy)): {hex.EncodeToString([]byte(assetName)): num.Uint64(amount)},
+				})
+			}
+		}
+	}
+
+	if datum, ok := fields[outputDatum]; ok {
+		var option struct {
+			_     struct{} `cbor:",toarray"`
+			Kind  uint64
+			Datum cbor.Tag
+		}
+		assert.Nil(t, cbor.Unmarshal(datum, &option))
+		assert.EqualValues(t, inlineDatum, option.Kind)
+		assert.EqualValues(t, encodedCBORTag, option.Datum.Number)
+		o.Datum = option.Datum.Content.([]byte)
+	}
+	return o
+}
+
+func decodeTx(t *testing.T, tx *Transaction) decodedTx {
+	var parts []cbor.RawMessage
+	assert.Nil(t, cbor.Unmarshal(tx.CBOR, &parts))
+	assert.Equal(t, 4, len(parts))
+	assert.EqualValues(t, tx.ID, hex.EncodeToString(blake2b256(parts[0])))
+
+	var decoded decodedTx
+	assert.Nil(t, cbor.Unmarshal(parts[0], &decoded.Body))
+	assert.Nil(t, cbor.Unmarshal(parts[1], &decoded.Witnesses))
+	decoded.Inputs = decodeRefs(t, decoded.Body[bodyInputs])
+	var outputs []cbor.RawMessage
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyOutputs], &outputs))
+	for _, o := range outputs {
+		decoded.Outputs = append(decoded.Outputs, decodeOutput(t, o))
+	}
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyFee], &decoded.Fee))
+	assert.EqualValues(t, tx.Fee, decoded.Fee)
+	if collateral, ok := decoded.Body[bodyCollateral]; ok {
+		decoded.Collateral = decodeRefs(t, collateral)
+	}
+	return decoded
+}
+
+// Check that the inputs pay for exactly the outputs and the fee
+func assertBalanced(t *testing.T, decoded decodedTx, utxos ...shared.Utxo) {
+	byRef := map[Ref]shared.Utxo{}
+	for _, u := range utxos {
+		byRef[refOf(u)] = u
+	}
+	in := shared.Value{}
+	for _, ref := range decoded.Inputs {
+		u, ok := byRef[ref]
+		assert.True(t, ok, "unknown input %v", ref)
+		in = shared.Add(in, u.Value)
+	}
+	out := shared.CreateAdaValue(int64(decoded.Fee))
+	for _, o := range decoded.Outputs {
+		out = shared.Add(out, o.Value)
+	}
+	assert.True(t, shared.Equal(in, out), "inputs %v don't balance outputs %v", in, out)
+}
+
+func addressBytesOf(t *testing.T, address string) []byte {
+	bytes, err := addressBytes(address)
+	assert.Nil(t, err)
+	return bytes
+}
+
+func Test_NewBuilder(t *testing.T) {
+	builder, err := NewBuilder(types.Testnet, types.PreviewSlotConfig, testParams, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.PreviewSlotConfig, builder.Slots)
+
+	// Without a slot config, time locks can't be turned into slots
+	_, err = NewBuilder(types.Testnet, types.SlotConfig{}, testParams, nil)
+	assert.NotNil(t, err)
+}
+
+func Test_Lock(t *testing.T) {
+	wallet := []shared.Utxo{
+		utxo(txHash(1), 0, testWallet, 2_000_000, ""),
+		withAsset(utxo(txHash(1), 1, testWallet, 1_500_000, ""), 1000),
+		utxo(txHash(2), 0, testWallet, 50_000_000, ""),
+	}
+	builder := testBuilder(t, wallet...)
+	delegations := []types.Delegation{{Program: "SBERRY", PoolIdent: "01", Weight: 1}}
+	tx, err := builder.Lock(context.Background(), LockRequest{
+		Owner:       signatureOwner(t, ownerKey),
+		Delegations: delegations,
+		Value:       shared.Value{testPolicy: {testAsset: num.Int64(600)}},
+		Wallet:      testWallet,
+	})
+	assert.Nil(t, err)
+	decoded := decodeTx(t, tx)
+	assertBalanced(t, decoded, wallet...)
+
+	// The assets go to the freezer, with enough lovelace to hold them, under the owner's datum
+	locked := decoded.Outputs[0]
+	assert.EqualValues(t, addressBytesOf(t, freezerAddress(t, builder)), locked.Address)
+	assert.EqualValues(t, 600, locked.Value.AssetAmount(shared.FromSeparate(testPolicy, testAsset)).Int64())
+	minLovelace, err := builder.minLovelace(output{Address: freezerAddress(t, builder), Value: locked.Value, Datum: locked.Datum})
+	assert.Nil(t, err)
+	assert.EqualValues(t, minLovelace, locked.Value.AdaLovelace().Uint64())
+	var datum types.StakeDatum
+	assert.Nil(t, cbor.Unmarshal(locked.Datum, &datum))
+	assert.EqualValues(t, types.StakeDatum{Owner: signatureOwner(t, ownerKey), Delegations: delegations}, datum)
+
+	// The change, including the rest of the asset, goes back to the wallet
+	change := decoded.Outputs[1]
+	assert.EqualValues(t, addressBytesOf(t, testWallet), change.Address)
+	assert.EqualValues(t, 400, change.Value.AssetAmount(shared.FromSeparate(testPolicy, testAsset)).Int64())
+
+	// Nothing to run, so no scripts, collateral or signers
+	assert.Equal(t, 0, len(decoded.Witnesses))
+	assert.Equal(t, 0, len(decoded.Collateral))
+	assert.Equal(t, 0, len(tx.RequiredSigners))
+	_, ok := decoded.Body[bodyScriptDataHash]
+	assert.False(t, ok)
+
+	// The fee covers the transaction once it's signed by the wallet
+	assert.True(t, tx.Fee >= testParams.MinFeeA*uint64(len(tx.CBOR)+vkeyWitnessSize)+testParams.MinFeeB)
+}
+
+func Test_Lock_InsufficientFunds(t *testing.T) {
+	builder := testBuilder(t, utxo(txHash(1), 0, testWallet, 5_000_000, ""))
+	_, err := builder.Lock(context.Background(), LockRequest{
+		Owner:  signatureOwner(t, ownerKey),
+		Value:  shared.Value{testPolicy: {testAsset: num.Int64(600)}},
+		Wallet: testWallet,
+	})
+	assert.True(t, errors.Is(err, shared.ErrInsufficientFunds))
+
+	_, err = builder.Lock(context.Background(), LockRequest{
+		Owner:  signatureOwner(t, ownerKey),
+		Value:  shared.CreateAdaValue(10_000_000),
+		Wallet: testWallet,
+	})
+	assert.True(t, errors.Is(err, shared.ErrInsufficientFunds))
+}
+
+func Test_Unlock(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	datum := encodedDatum(t, types.StakeDatum{Owner: signatureOwner(t, ownerKey)})
+	utxos := []shared.Utxo{
+		withAsset(utxo(txHash(9), 0, freezer, 2_000_000, datum), 500),
+		withAsset(utxo(txHash(3), 2, freezer, 2_000_000, datum), 250),
+		withAsset(utxo(txHash(3), 3, freezer, 2_000_000, datum), 100),
+		utxo(txHash(5), 0, testWallet, 20_000_000, ""),
+		withAsset(utxo(txHash(6), 0, testWallet, 30_000_000, ""), 1),
+	}
+	builder = testBuilder(t, utxos...)
+	tx, err := builder.Unlock(context.Background(), UnlockRequest{
+		Positions: []Ref{refOf(utxos[0]), refOf(utxos[1])},
+		Wallet:    testWallet,
+	})
+	assert.Nil(t, err)
+	decoded := decodeTx(t, tx)
+	assertBalanced(t, decoded, utxos...)
+
+	// The positions go back to the wallet, and the owner has to sign
+	unlocked := decoded.Outputs[0]
+	assert.EqualValues(t, addressBytesOf(t, testWallet), unlocked.Address)
+	assert.EqualValues(t, 750, unlocked.Value.AssetAmount(shared.FromSeparate(testPolicy, testAsset)).Int64())
+	assert.EqualValues(t, 4_000_000, unlocked.Value.AdaLovelace().Int64())
+	assert.EqualValues(t, []string{ownerKey}, tx.RequiredSigners)
+	var signers [][]byte
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyRequiredSigners], &signers))
+	assert.EqualValues(t, [][]byte{mustDecode(t, ownerKey)}, signers)
+
+	// Inputs are sorted, and there's a redeemer pointing at each position
+	for i := 1; i < len(decoded.Inputs); i++ {
+		assert.True(t, decoded.Inputs[i-1].String() < decoded.Inputs[i].String())
+	}
+	var redeemers []struct {
+		_       struct{} `cbor:",toarray"`
+		Tag     uint64
+		Index   uint64
+		Data    cbor.RawMessage
+		ExUnits []uint64
+	}
+	assert.Nil(t, cbor.Unmarshal(decoded.Witnesses[witnessRedeemers], &redeemers))
+	assert.Equal(t, 2, len(redeemers))
+	var pointed []Ref
+	for _, redeemer := range redeemers {
+		assert.EqualValues(t, spendRedeemer, redeemer.Tag)
+		assert.EqualValues(t, voidRedeemer, redeemer.Data)
+		assert.EqualValues(t, []uint64{DefaultSpendExUnits.Memory, DefaultSpendExUnits.Steps}, redeemer.ExUnits)
+		pointed = append(pointed, decoded.Inputs[redeemer.Index])
+	}
+	assert.EqualValues(t, []Ref{refOf(utxos[1]), refOf(utxos[0])}, pointed)
+
+	// The script and its data hash are included
+	var scripts [][]byte
+	assert.Nil(t, cbor.Unmarshal(decoded.Witnesses[witnessPlutusV2Scripts], &scripts))
+	code, err := builder.Freezer.Code()
+	assert.Nil(t, err)
+	assert.EqualValues(t, [][]byte{code}, scripts)
+	var hash []byte
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyScriptDataHash], &hash))
+	expected, err := scriptDataHash(decoded.Witnesses[witnessRedeemers], testParams.CostModelV2)
+	assert.Nil(t, err)
+	assert.EqualValues(t, expected, hash)
+
+	// Collateral comes from the largest UTxO holding only lovelace, and covers the fee
+	assert.EqualValues(t, []Ref{refOf(utxos[3])}, decoded.Collateral)
+	var total uint64
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyTotalCollateral], &total))
+	assert.True(t, total*100 >= tx.Fee*testParams.CollateralPercent)
+	collateralReturn := decodeOutput(t, decoded.Body[bodyCollateralReturn])
+	assert.EqualValues(t, 20_000_000-total, collateralReturn.Value.AdaLovelace().Uint64())
+
+	var networkID uint64
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyNetworkID], &networkID))
+	assert.EqualValues(t, types.Testnet, networkID)
+
+	// The fee pays for the scripts too
+	assert.True(t, tx.Fee > builder.scriptFee(plan{scriptInputs: utxos[:2], exUnits: DefaultSpendExUnits}))
+}
+
+// A golden vector for unlocking a single position, transcribed field by field from the Babbage CDDL rather than produced by
+// the encoder, so a key or encoding the ledger doesn't expect shows up here
+func Test_Unlock_Golden(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	utxos := []shared.Utxo{
+		utxo(txHash(1), 0, freezer, 2_000_000, encodedDatum(t, types.StakeDatum{Owner: signatureOwner(t, ownerKey)})),
+		utxo(txHash(2), 1, testWallet, 20_000_000, ""),
+	}
+	builder = testBuilder(t, utxos...)
+	tx, err := builder.Unlock(context.Background(), UnlockRequest{Positions: []Ref{refOf(utxos[0])}, Wallet: testWallet})
+	assert.Nil(t, err)
+
+	// bytes(29): an enterprise key address, on testnet
+	wallet := "581d609493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e"
+	body := "a9" + // map(9)
+		// 0: inputs, sorted
+		"00" + "82" +
+		"825820" + txHash(1) + "00" +
+		"825820" + txHash(2) + "01" +
+		// 1: outputs; the position back to the wallet, then the change
+		"01" + "82" +
+		"a2" + "00" + wallet + "01" + "1a001e8480" + // 2_000_000
+		"a2" + "00" + wallet + "01" + "1a012bfecd" + // 19_660_493
+		// 2: fee
+		"02" + "1a00052e33" + // 339_507
+		// 11: script data hash
+		"0b" + "5820" + "67eb65cc8c333b5a0fdbe3d3b447deb143ed285c5e95e8be242993a47c4d0e35" +
+		// 13: collateral
+		"0d" + "81" + "825820" + txHash(2) + "01" +
+		// 14: required signers
+		"0e" + "81" + "581c" + ownerKey +
+		// 15: network id
+		"0f" + "00" +
+		// 16: collateral return
+		"10" + "a2" + "00" + wallet + "01" + "1a012967b3" + // 19_490_739
+		// 17: total collateral
+		"11" + "1a0007c54d" // 509_261, 150% of the fee
+
+	// [spend, input 0, void, [memory, steps]]
+	redeemers := "81" + "84" + "00" + "00" + "d87980" + "82" + "1a000f4240" + "1a1dcd6500"
+	// {PlutusV2: cost model}
+	languageViews := "a1" + "01" + "88" + "1a00032361" + "19032c" + "01" + "01" + "1903e8" + "19023b" + "00" + "01"
+	preimage := mustDecode(t, redeemers+languageViews)
+	assert.EqualValues(t, "67eb65cc8c333b5a0fdbe3d3b447deb143ed285c5e95e8be242993a47c4d0e35", hex.EncodeToString(blake2b256(preimage)))
+
+	code, err := builder.Freezer.Code()
+	assert.Nil(t, err)
+	witnesses := "a2" + // map(2)
+		"05" + redeemers +
+		// 6: PlutusV2 scripts
+		"06" + "81" + "5905e2" + hex.EncodeToString(code)
+
+	var parts []cbor.RawMessage
+	assert.Nil(t, cbor.Unmarshal(tx.CBOR, &parts))
+	assert.EqualValues(t, body, hex.EncodeToString(parts[0]))
+	assert.EqualValues(t, witnesses, hex.EncodeToString(parts[1]))
+	// Valid, with no auxiliary data
+	assert.EqualValues(t, "f5", hex.EncodeToString(parts[2]))
+	assert.EqualValues(t, "f6", hex.EncodeToString(parts[3]))
+	assert.EqualValues(t, "f2583bcbfda20aa8bbb7a512fb95c5ce1be7ac9b12087facaebf48e0faf6925a", tx.ID)
+}
+
+func Test_Unlock_Options(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	eitherKey := types.MultisigScript{AnyOf: &types.AnyOf{Scripts: []types.MultisigScript{
+		signatureOwner(t, ownerKey),
+		signatureOwner(t, otherKey),
+	}}}
+	utxos := []shared.Utxo{
+		utxo(txHash(1), 0, freezer, 2_000_000, encodedDatum(t, types.StakeDatum{Owner: eitherKey})),
+		utxo(txHash(2), 0, testWallet, 20_000_000, ""),
+	}
+	builder = testBuilder(t, utxos...)
+	request := UnlockRequest{
+		Positions: []Ref{refOf(utxos[0])},
+		To:        "addr_test1qz2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzer3n0d3vllmyqwsx5wktcd8cc3sq835lu7drv2xwl2wywfgs68faae",
+		Wallet:    testWallet,
+	}
+
+	// Either key will do, so one is picked
+	tx, err := builder.Unlock(context.Background(), request)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{otherKey}, tx.RequiredSigners)
+	_, ok := decodeTx(t, tx).Body[bodyValidFrom]
+	assert.False(t, ok)
+
+	// Unless only one of them is available
+	from, until := uint64(100), uint64(200)
+	request.SpendOptions = SpendOptions{
+		Signers:    []string{ownerKey},
+		ValidFrom:  &from,
+		ValidUntil: &until,
+		ExUnits:    &ExUnits{Memory: 10, Steps: 20},
+	}
+	tx, err = builder.Unlock(context.Background(), request)
+	assert.Nil(t, err)
+	decoded := decodeTx(t, tx)
+	assertBalanced(t, decoded, utxos...)
+	assert.EqualValues(t, addressBytesOf(t, request.To), decoded.Outputs[0].Address)
+	assert.EqualValues(t, addressBytesOf(t, testWallet), decoded.Outputs[1].Address)
+	assert.EqualValues(t, []string{ownerKey}, tx.RequiredSigners)
+	var validFrom, validUntil uint64
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyValidFrom], &validFrom))
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyValidUntil], &validUntil))
+	assert.EqualValues(t, 100, validFrom)
+	assert.EqualValues(t, 200, validUntil)
+
+	request.Signers = []string{"not a key"}
+	_, err = builder.Unlock(context.Background(), request)
+	assert.NotNil(t, err)
+
+	// A key that can't sign for the owner
+	request.Signers = []string{testPolicy}
+	_, err = builder.Unlock(context.Background(), request)
+	assert.True(t, errors.Is(err, owner.ErrUnsatisfiable))
+}
+
+func Test_Unlock_BadPositions(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	utxos := []shared.Utxo{
+		utxo(txHash(1), 0, freezer, 2_000_000, encodedDatum(t, types.StakeDatum{Owner: signatureOwner(t, ownerKey)})),
+		utxo(txHash(1), 1, freezer, 2_000_000, ""),
+		utxo(txHash(2), 0, testWallet, 20_000_000, ""),
+	}
+	builder = testBuilder(t, utxos...)
+	for _, positions := range [][]Ref{
+		nil,
+		{refOf(utxos[0]), refOf(utxos[0])},
+		{{TxHash: txHash(7), Index: 0}},
+		{refOf(utxos[1])},
+		// In the wallet, not the freezer
+		{refOf(utxos[2])},
+	} {
+		_, err := builder.Unlock(context.Background(), UnlockRequest{Positions: positions, Wallet: testWallet})
+		assert.NotNil(t, err, "%v", positions)
+	}
+}
+
+func Test_Redelegate(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	owner := signatureOwner(t, ownerKey)
+	old := []types.Delegation{{Program: "SBERRY", PoolIdent: "01", Weight: 1}}
+	utxos := []shared.Utxo{
+		withAsset(utxo(txHash(1), 0, freezer, 2_000_000, encodedDatum(t, types.StakeDatum{Owner: owner, Delegations: old})), 500),
+		withAsset(utxo(txHash(1), 1, freezer, 3_000_000, encodedDatum(t, types.StakeDatum{Owner: owner})), 100),
+		utxo(txHash(1), 2, freezer, 2_000_000, encodedDatum(t, types.StakeDatum{Owner: signatureOwner(t, otherKey)})),
+		utxo(txHash(2), 0, testWallet, 20_000_000, ""),
+	}
+	builder = testBuilder(t, utxos...)
+	delegations := []types.Delegation{
+		{Program: "SBERRY", PoolIdent: "0d", Weight: 2},
+		{Program: "RBERRY", PoolIdent: "01", Weight: 1},
+	}
+	tx, err := builder.Redelegate(context.Background(), RedelegateRequest{
+		Positions:   []Ref{refOf(utxos[0]), refOf(utxos[1])},
+		Delegations: delegations,
+		Wallet:      testWallet,
+	})
+	assert.Nil(t, err)
+	decoded := decodeTx(t, tx)
+	assertBalanced(t, decoded, utxos...)
+
+	// Everything is locked again in one position, for the same owner, with the new delegations
+	relocked := decoded.Outputs[0]
+	assert.EqualValues(t, addressBytesOf(t, freezer), relocked.Address)
+	assert.EqualValues(t, 5_000_000, relocked.Value.AdaLovelace().Int64())
+	assert.EqualValues(t, 600, relocked.Value.AssetAmount(shared.FromSeparate(testPolicy, testAsset)).Int64())
+	var datum types.StakeDatum
+	assert.Nil(t, cbor.Unmarshal(relocked.Datum, &datum))
+	assert.EqualValues(t, types.StakeDatum{Owner: owner, Delegations: delegations}, datum)
+	assert.EqualValues(t, []string{ownerKey}, tx.RequiredSigners)
+
+	// Positions with different owners can't be merged
+	_, err = builder.Redelegate(context.Background(), RedelegateRequest{
+		Positions:   []Ref{refOf(utxos[0]), refOf(utxos[2])},
+		Delegations: delegations,
+		Wallet:      testWallet,
+	})
+	assert.NotNil(t, err)
+
+	// Or the lovelace can go back to the wallet, leaving only the minimum locked
+	tx, err = builder.Redelegate(context.Background(), RedelegateRequest{
+		Positions:            []Ref{refOf(utxos[0]), refOf(utxos[1])},
+		Delegations:          delegations,
+		Wallet:               testWallet,
+		ReturnExcessLovelace: true,
+	})
+	assert.Nil(t, err)
+	decoded = decodeTx(t, tx)
+	assertBalanced(t, decoded, utxos...)
+	relocked = decoded.Outputs[0]
+	assert.EqualValues(t, 600, relocked.Value.AssetAmount(shared.FromSeparate(testPolicy, testAsset)).Int64())
+	minLovelace, err := builder.minLovelace(output{Address: freezer, Value: relocked.Value, Datum: relocked.Datum})
+	assert.Nil(t, err)
+	assert.EqualValues(t, minLovelace, relocked.Value.AdaLovelace().Uint64())
+	assert.True(t, minLovelace < 5_000_000)
+}
+
+func Test_PositionRefs(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	datum := encodedDatum(t, types.StakeDatum{Owner: signatureOwner(t, ownerKey)})
+	utxos := []shared.Utxo{
+		utxo(txHash(1), 3, freezer, 2_000_000, datum),
+		utxo(txHash(2), 0, freezer, 2_000_000, datum),
+		utxo(txHash(2), 1, freezer, 2_000_000, datum),
+		utxo(txHash(3), 0, testWallet, 2_000_000, ""),
+	}
+	builder = testBuilder(t, utxos...)
+	refs, err := builder.PositionRefs(context.Background(), []string{txHash(1)})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []Ref{{TxHash: txHash(1), Index: 3}}, refs)
+
+	// Ambiguous, or not in the freezer
+	for _, txHashes := range [][]string{{txHash(2)}, {txHash(3)}, {txHash(1), txHash(4)}} {
+		_, err := builder.PositionRefs(context.Background(), txHashes)
+		assert.NotNil(t, err, "%v", txHashes)
+	}
+}
+
+func Test_Redelegate_TimeLockedOwner(t *testing.T) {
+	builder := testBuilder(t)
+	freezer := freezerAddress(t, builder)
+	timeLocked := types.MultisigScript{AllOf: &types.AllOf{Scripts: []types.MultisigScript{
+		signatureOwner(t, ownerKey),
+		{After: &types.After{Time: time.Unix(1_700_000_000, 0)}},
+	}}}
+	utxos := []shared.Utxo{
+		utxo(txHash(1), 0, freezer, 2_000_000, encodedDatum(t, types.StakeDatum{Owner: timeLocked})),
+		utxo(txHash(2), 0, testWallet, 20_000_000, ""),
+	}
+	builder = testBuilder(t, utxos...)
+	tx, err := builder.Redelegate(context.Background(), RedelegateRequest{
+		Positions: []Ref{refOf(utxos[0])},
+		Wallet:    testWallet,
+	})
+	assert.Nil(t, err)
+	decoded := decodeTx(t, tx)
+	var datum types.StakeDatum
+	assert.Nil(t, cbor.Unmarshal(decoded.Outputs[0].Datum, &datum))
+	assert.EqualValues(t, timeLocked.AllOf.Scripts[1].After.Time.Unix(), datum.Owner.AllOf.Scripts[1].After.Time.Unix())
+
+	// The transaction can't be valid until the time lock has passed
+	unlocksAt, err := types.PreprodSlotConfig.SlotAt(time.Unix(1_700_000_000, 0))
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{ownerKey}, tx.RequiredSigners)
+	assert.EqualValues(t, unlocksAt, *tx.ValidFrom)
+	var validFrom uint64
+	assert.Nil(t, cbor.Unmarshal(decoded.Body[bodyValidFrom], &validFrom))
+	assert.EqualValues(t, unlocksAt, validFrom)
+
+	// And can't be built at all if it has to be valid before then
+	until := unlocksAt - 10
+	_, err = builder.Redelegate(context.Background(), RedelegateRequest{
+		Positions:    []Ref{refOf(utxos[0])},
+		Wallet:       testWallet,
+		SpendOptions: SpendOptions{ValidUntil: &until},
+	})
+	assert.True(t, errors.Is(err, owner.ErrUnsatisfiable))
+}
+
+func Test_ParseRef(t *testing.T) {
+	ref, err := ParseRef(txHash(10) + "#3")
+	assert.Nil(t, err)
+	assert.EqualValues(t, Ref{TxHash: txHash(10), Index: 3}, ref)
+	assert.EqualValues(t, txHash(10)+"#3", ref.String())
+
+	for _, invalid := range []string{txHash(10), "abc#1", txHash(10) + "#x", txHash(10) + "#-1"} {
+		_, err := ParseRef(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,198 @@
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// The network ID encoded in an address; the test networks (preprod and preview) share the same ID
+type Network byte
+
+const (
+	Testnet Network = 0
+	Mainnet Network = 1
+)
+
+// The bech32 prefix of addresses on the network
+func (n Network) AddressPrefix() string {
+	if n == Mainnet {
+		return "addr"
+	}
+	return "addr_test"
+}
+
+func (n Network) String() string {
+	if n == Mainnet {
+		return "mainnet"
+	}
+	return "testnet"
+}
+
+// Whether a credential is the hash of a verification key, or of a script
+type CredentialKind int
+
+const (
+	KeyCredential CredentialKind = iota
+	ScriptCredential
+)
+
+// A payment or staking credential; the 28 byte hash of a verification key or script
+type Credential struct {
+	Kind CredentialKind
+	Hash []byte
+}
+
+const credentialHashLength = 28
+
+func (c Credential) validate() error {
+	if len(c.Hash) != credentialHashLength {
+		return fmt.Errorf("credential hash must be %v bytes, not %v", credentialHashLength, len(c.Hash))
+	}
+	if c.Kind != KeyCredential && c.Kind != ScriptCredential {
+		return fmt.Errorf("unrecognized credential kind %v", c.Kind)
+	}
+	return nil
+}
+
+// The bech32 encoding of the credential, as a payment credential (CIP-5)
+func (c Credential) Bech32() (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	if c.Kind == ScriptCredential {
+		return EncodeBech32("script", c.Hash)
+	}
+	return EncodeBech32("addr_vkh", c.Hash)
+}
+
+func (c Credential) String() string {
+	return hex.EncodeToString(c.Hash)
+}
+
+// Parse a bech32 payment credential (CIP-5); either the hash of a verification key ("addr_vkh"), or of a script ("script")
+func ParseCredential(encoded string) (Credential, error) {
+	prefix, hash, err := DecodeBech32(encoded)
+	if err != nil {
+		return Credential{}, err
+	}
+	var credential Credential
+	switch prefix {
+	case "addr_vkh":
+		credential = Credential{Kind: KeyCredential, Hash: hash}
+	case "script":
+		credential = Credential{Kind: ScriptCredential, Hash: hash}
+	default:
+		return Credential{}, fmt.Errorf("%v is not a payment credential", encoded)
+	}
+	if err := credential.validate(); err != nil {
+		return Credential{}, fmt.Errorf("invalid credential %v: %w", encoded, err)
+	}
+	return credential, nil
+}
+
+// The owner script for a credential: a single signature by the key. Only a key can sign, so a script credential has no owner script
+func (c Credential) MultisigScript() (MultisigScript, error) {
+	if err := c.validate(); err != nil {
+		return MultisigScript{}, err
+	}
+	if c.Kind != KeyCredential {
+		return MultisigScript{}, fmt.Errorf("script credential %v can't sign", c)
+	}
+	return MultisigScript{Signature: &Signature{KeyHash: append([]byte{}, c.Hash...)}}, nil
+}
+
+// Address header types, from the Shelley address format (CIP-19); the low bits of the base address type say which
+// credentials are scripts, and likewise for enterprise addresses
+const (
+	baseAddressType       = 0b0000
+	enterpriseAddressType = 0b0110
+)
+
+// A Shelley address, with a payment credential and, unless it's an enterprise address, a staking credential
+type Address struct {
+	Network Network
+	Payment Credential
+	Stake   *Credential
+}
+
+// Parse a bech32 base or enterprise address, with either key or script credentials
+func ParseAddress(encoded string) (Address, error) {
+	prefix, bytes, err := DecodeBech32(encoded)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(bytes) == 0 {
+		return Address{}, fmt.Errorf("empty address %v", encoded)
+	}
+	header := bytes[0]
+	address := Address{Network: Network(header & 0x0f)}
+	if address.Network != Mainnet && address.Network != Testnet {
+		return Address{}, fmt.Errorf("address %v is for unrecognized network %v", encoded, header&0x0f)
+	}
+	if prefix != address.Network.AddressPrefix() {
+		return Address{}, fmt.Errorf("address %v has prefix %v, but is for %v", encoded, prefix, address.Network)
+	}
+
+	kind := func(bit int) CredentialKind {
+		return CredentialKind((header >> (4 + bit)) & 1)
+	}
+	switch addressType := header >> 4; {
+	case addressType <= 0b0011:
+		if len(bytes) != 1+2*credentialHashLength {
+			return Address{}, fmt.Errorf("base address %v has %v bytes", encoded, len(bytes))
+		}
+		address.Payment = Credential{Kind: kind(0), Hash: bytes[1 : 1+credentialHashLength]}
+		address.Stake = &Credential{Kind: kind(1), Hash: bytes[1+credentialHashLength:]}
+	case addressType == enterpriseAddressType || addressType == enterpriseAddressType+1:
+		if len(bytes) != 1+credentialHashLength {
+			return Address{}, fmt.Errorf("enterprise address %v has %v bytes", encoded, len(bytes))
+		}
+		address.Payment = Credential{Kind: kind(0), Hash: bytes[1:]}
+	default:
+		return Address{}, fmt.Errorf("address %v is of unsupported type %v", encoded, addressType)
+	}
+	return address, nil
+}
+
+// The bech32 encoding of the address
+func (a Address) Bech32() (string, error) {
+	if a.Stake == nil {
+		return EnterpriseAddress(a.Network, a.Payment)
+	}
+	return BaseAddress(a.Network, a.Payment, *a.Stake)
+}
+
+// The owner script for whoever can spend from the address, the same way builder/lock.ts builds the datum
+func OwnerFromAddress(encoded string) (MultisigScript, error) {
+	address, err := ParseAddress(encoded)
+	if err != nil {
+		return MultisigScript{}, err
+	}
+	owner, err := address.Payment.MultisigScript()
+	if err != nil {
+		return MultisigScript{}, fmt.Errorf("no owner for address %v: %w", encoded, err)
+	}
+	return owner, nil
+}
+
+// An address with only a payment credential, which can't be delegated
+func EnterpriseAddress(network Network, payment Credential) (string, error) {
+	if err := payment.validate(); err != nil {
+		return "", fmt.Errorf("invalid payment credential: %w", err)
+	}
+	header := byte(enterpriseAddressType|int(payment.Kind))<<4 | byte(network)
+	return EncodeBech32(network.AddressPrefix(), append([]byte{header}, payment.Hash...))
+}
+
+// An address with both a payment and a staking credential
+func BaseAddress(network Network, payment Credential, stake Credential) (string, error) {
+	if err := payment.validate(); err != nil {
+		return "", fmt.Errorf("invalid payment credential: %w", err)
+	}
+	if err := stake.validate(); err != nil {
+		return "", fmt.Errorf("invalid staking credential: %w", err)
+	}
+	header := byte(baseAddressType|int(payment.Kind)|int(stake.Kind)<<1)<<4 | byte(network)
+	bytes := append([]byte{header}, payment.Hash...)
+	return EncodeBech32(network.AddressPrefix(), append(bytes, stake.Hash...))
+}
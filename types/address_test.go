@@ -0,0 +1,88 @@
+package types
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func Test_Addresses(t *testing.T) {
+	// Test vectors from CIP-19
+	paymentHash, _ := hex.DecodeString("9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e")
+	stakeHash, _ := hex.DecodeString("337b62cfff6403a06a3acbc34f8c46003c69fe79a3628cefa9c47251")
+	payment := Credential{Kind: KeyCredential, Hash: paymentHash}
+	stake := Credential{Kind: KeyCredential, Hash: stakeHash}
+
+	address, err := EnterpriseAddress(Mainnet, payment)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "addr1vx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzers66hrl8", address)
+	address, err = EnterpriseAddress(Testnet, payment)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "addr_test1vz2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzerspjrlsz", address)
+	address, err = BaseAddress(Mainnet, payment, stake)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "addr1qx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzer3n0d3vllmyqwsx5wktcd8cc3sq835lu7drv2xwl2wywfgse35a3x", address)
+
+	credential, err := payment.Bech32()
+	assert.Nil(t, err)
+	prefix, hash, err := DecodeBech32(credential)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "addr_vkh", prefix)
+	assert.EqualValues(t, paymentHash, hash)
+
+	_, err = EnterpriseAddress(Mainnet, Credential{Kind: KeyCredential, Hash: paymentHash[:10]})
+	assert.NotNil(t, err)
+}
+
+func Test_ParseAddress(t *testing.T) {
+	// Test vectors from CIP-19
+	keyHash, _ := hex.DecodeString("9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e")
+	scriptHash, _ := hex.DecodeString("c37b1b5dc0669f1d3c61a6fddb2e8fde96be87b881c60bce8e8d542f")
+	stakeKeyHash, _ := hex.DecodeString("337b62cfff6403a06a3acbc34f8c46003c69fe79a3628cefa9c47251")
+	key := Credential{Kind: KeyCredential, Hash: keyHash}
+	script := Credential{Kind: ScriptCredential, Hash: scriptHash}
+	stakeKey := Credential{Kind: KeyCredential, Hash: stakeKeyHash}
+	for encoded, expected := range map[string]Address{
+		"addr1qx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzer3n0d3vllmyqwsx5wktcd8cc3sq835lu7drv2xwl2wywfgse35a3x": {Network: Mainnet, Payment: key, Stake: &stakeKey},
+		"addr1z8phkx6acpnf78fuvxn0mkew3l0fd058hzquvz7w36x4gten0d3vllmyqwsx5wktcd8cc3sq835lu7drv2xwl2wywfgs9yc0hh": {Network: Mainnet, Payment: script, Stake: &stakeKey},
+		"addr1yx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzerkr0vd4msrxnuwnccdxlhdjar77j6lg0wypcc9uar5d2shs2z78ve": {Network: Mainnet, Payment: key, Stake: &script},
+		"addr1x8phkx6acpnf78fuvxn0mkew3l0fd058hzquvz7w36x4gt7r0vd4msrxnuwnccdxlhdjar77j6lg0wypcc9uar5d2shskhj42g": {Network: Mainnet, Payment: script, Stake: &script},
+		"addr1vx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzers66hrl8":                                              {Network: Mainnet, Payment: key},
+		"addr1w8phkx6acpnf78fuvxn0mkew3l0fd058hzquvz7w36x4gtcyjy7wx":                                              {Network: Mainnet, Payment: script},
+		"addr_test1vz2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzerspjrlsz":                                         {Network: Testnet, Payment: key},
+	} {
+		address, err := ParseAddress(encoded)
+		assert.Nil(t, err, encoded)
+		assert.EqualValues(t, expected, address, encoded)
+		roundTrip, err := address.Bech32()
+		assert.Nil(t, err)
+		assert.EqualValues(t, encoded, roundTrip)
+	}
+
+	// Reward addresses have no payment credential
+	_, err := ParseAddress("stake1uyehkck0lajq8gr28t9uxnuvgcqrc6070x3k9r8048z8y5gh6ffgw")
+	assert.NotNil(t, err)
+	// Nor do credentials parse as addresses, or vice versa
+	_, err = ParseAddress("addr_vkh1jjfnzhxe966a33psfenm0ct2udkkr569qf55v4uprgkgu8zsvmg")
+	assert.NotNil(t, err)
+	_, err = ParseCredential("addr1vx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzers66hrl8")
+	assert.NotNil(t, err)
+}
+
+func Test_OwnerFromAddress(t *testing.T) {
+	keyHash, _ := hex.DecodeString("9493315cd92eb5d8c4304e67b7e16ae36d61d34502694657811a2c8e")
+	owner, err := OwnerFromAddress("addr1qx2fxv2umyhttkxyxp8x0dlpdt3k6cwng5pxj3jhsydzer3n0d3vllmyqwsx5wktcd8cc3sq835lu7drv2xwl2wywfgse35a3x")
+	assert.Nil(t, err)
+	assert.EqualValues(t, MultisigScript{Signature: &Signature{KeyHash: keyHash}}, owner)
+
+	credential, err := ParseCredential("addr_vkh1jjfnzhxe966a33psfenm0ct2udkkr569qf55v4uprgkgu8zsvmg")
+	assert.Nil(t, err)
+	owner, err = credential.MultisigScript()
+	assert.Nil(t, err)
+	assert.EqualValues(t, MultisigScript{Signature: &Signature{KeyHash: keyHash}}, owner)
+
+	// A script address can't sign for itself
+	_, err = OwnerFromAddress("addr1w8phkx6acpnf78fuvxn0mkew3l0fd058hzquvz7w36x4gtcyjy7wx")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bech32, as described in BIP-173; Cardano uses it for addresses and credentials, without the 90 character limit
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+func bech32ExpandPrefix(prefix string) []byte {
+	expanded := make([]byte, 0, len(prefix)*2+1)
+	for i := 0; i < len(prefix); i++ {
+		expanded = append(expanded, prefix[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(prefix); i++ {
+		expanded = append(expanded, prefix[i]&31)
+	}
+	return expanded
+}
+
+// Regroup bits, for example from bytes into the 5 bit groups bech32 encodes
+func convertBits(data []byte, from uint, to uint, pad bool) ([]byte, error) {
+	var result []byte
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<to - 1
+	for _, value := range data {
+		if uint32(value)>>from != 0 {
+			return nil, fmt.Errorf("invalid data value %v", value)
+		}
+		acc = acc<<from | uint32(value)
+		bits += from
+		for bits >= to {
+			bits -= to
+			result = append(result, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(to-bits)&maxValue))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return result, nil
+}
+
+// Encode bytes as bech32, with the given human readable prefix
+func EncodeBech32(prefix string, data []byte) (string, error) {
+	if prefix == "" || strings.ToLower(prefix) != prefix {
+		return "", fmt.Errorf("invalid bech32 prefix %q", prefix)
+	}
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	checksumInput := append(bech32ExpandPrefix(prefix), values...)
+	polymod := bech32Polymod(append(checksumInput, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var encoded strings.Builder
+	encoded.WriteString(prefix)
+	encoded.WriteByte('1')
+	for _, value := range values {
+		encoded.WriteByte(bech32Charset[value])
+	}
+	for i := 0; i < 6; i++ {
+		encoded.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+	return encoded.String(), nil
+}
+
+// Decode a bech32 string into its human readable prefix and bytes
+func DecodeBech32(encoded string) (string, []byte, error) {
+	if strings.ToLower(encoded) != encoded && strings.ToUpper(encoded) != encoded {
+		return "", nil, fmt.Errorf("bech32 string %q has mixed case", encoded)
+	}
+	encoded = strings.ToLower(encoded)
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 || separator+7 > len(encoded) {
+		return "", nil, fmt.Errorf("invalid bech32 string %q", encoded)
+	}
+	prefix := encoded[:separator]
+	for i := 0; i < len(prefix); i++ {
+		if prefix[i] < 33 || prefix[i] > 126 {
+			return "", nil, fmt.Errorf("invalid character in bech32 prefix %q", prefix)
+		}
+	}
+	var values []byte
+	for _, c := range encoded[separator+1:] {
+		value := strings.IndexRune(bech32Charset, c)
+		if value < 0 {
+			return "", nil, fmt.Errorf("invalid character %q in bech32 string %q", c, encoded)
+		}
+		values = append(values, byte(value))
+	}
+	if bech32Polymod(append(bech32ExpandPrefix(prefix), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid checksum in bech32 string %q", encoded)
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid bech32 string %q: %w", encoded, err)
+	}
+	return prefix, data, nil
+}
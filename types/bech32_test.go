@@ -0,0 +1,33 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func Test_Bech32(t *testing.T) {
+	// Test vectors from BIP-173
+	for _, valid := range []string{"A12UEL5L", "a12uel5l", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", "split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w"} {
+		prefix, data, err := DecodeBech32(valid)
+		assert.Nil(t, err, valid)
+		encoded, err := EncodeBech32(prefix, data)
+		assert.Nil(t, err)
+		assert.EqualValues(t, strings.ToLower(valid), encoded)
+	}
+	for _, invalid := range []string{"pzry9x0s0muk", "1pzry9x0s0muk", "x1b4n0q5v", "li1dgmt3", "A1G7SGD8", "10a06t8", "1qzzfhee", "a12UEL5L"} {
+		_, _, err := DecodeBech32(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+
+	encoded, err := EncodeBech32("test", []byte{0x00, 0x01, 0xff})
+	assert.Nil(t, err)
+	prefix, data, err := DecodeBech32(encoded)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "test", prefix)
+	assert.EqualValues(t, []byte{0x00, 0x01, 0xff}, data)
+
+	_, err = EncodeBech32("Test", nil)
+	assert.NotNil(t, err)
+}
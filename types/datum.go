@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/hex"
+	"fmt"
 
 	"github.com/fxamacker/cbor/v2"
 )
@@ -44,3 +45,47 @@ func (s *StakeDatum) UnmarshalCBOR(bytes []byte) error {
 	}
 	return nil
 }
+
+// Encode the datum the same way it's found on-chain; the delegations are encoded as an indefinite length list, unless there are none
+func (s *StakeDatum) MarshalCBOR() ([]byte, error) {
+	var bytes []byte
+	bytes = append(bytes, 0x9f) // indefinite length array for the struct
+	owner, err := cbor.Marshal(&s.Owner)
+	if err != nil {
+		return nil, err
+	}
+	bytes = append(bytes, owner...)
+	if len(s.Delegations) == 0 {
+		bytes = append(bytes, 0x80) // empty array
+	} else {
+		bytes = append(bytes, 0x9f) // indefinite length array for the delegations
+		for _, delegation := range s.Delegations {
+			encoded, err := delegation.MarshalCBOR()
+			if err != nil {
+				return nil, err
+			}
+			bytes = append(bytes, encoded...)
+		}
+		bytes = append(bytes, 0xff) // end indefinite length array for the delegations
+	}
+	bytes = append(bytes, 0xff) // end indefinite length array for the struct
+	return cbor.Marshal(cbor.RawTag{Number: 1 + tagBase, Content: bytes})
+}
+
+func (d *Delegation) MarshalCBOR() ([]byte, error) {
+	poolIdent, err := hex.DecodeString(d.PoolIdent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pool ident %v: %w", d.PoolIdent, err)
+	}
+	var bytes []byte
+	bytes = append(bytes, 0x9f) // indefinite length array for the struct
+	for _, field := range []any{[]byte(d.Program), poolIdent, d.Weight} {
+		encoded, err := cbor.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		bytes = append(bytes, encoded...)
+	}
+	bytes = append(bytes, 0xff) // end indefinite length array for the struct
+	return cbor.Marshal(cbor.RawTag{Number: 1 + tagBase, Content: bytes})
+}
@@ -19,6 +19,11 @@ func Test_UnmarshalDatum(t *testing.T) {
 			{Program: "SBERRY", PoolIdent: "01", Weight: 1},
 		},
 	}, datum)
+
+	// And it encodes back to exactly the same bytes
+	encoded, err := cbor.Marshal(&datum)
+	assert.Nil(t, err)
+	assert.EqualValues(t, bytes, encoded)
 }
 func Test_UnmarshalNil(t *testing.T) {
 	bytes := mustDecode(t, "d8799fd8799f581c121fd22e0b57ac206fefc763f8bfa0771919f5218b40691eea4514d0ff80ff")
@@ -28,4 +33,8 @@ func Test_UnmarshalNil(t *testing.T) {
 		Owner:       MultisigScript{Signature: &Signature{KeyHash: mustDecode(t, "121fd22e0b57ac206fefc763f8bfa0771919f5218b40691eea4514d0")}},
 		Delegations: nil,
 	}, datum)
+
+	encoded, err := cbor.Marshal(&datum)
+	assert.Nil(t, err)
+	assert.EqualValues(t, bytes, encoded)
 }
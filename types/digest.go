@@ -0,0 +1,214 @@
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+)
+
+// The hex encoded sha256 of the canonical encoding of a value; encoding/json writes struct fields in declaration order,
+// and map keys sorted, so equal values always have the same digest
+func Digest(value any) (string, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	hash := sha256.Sum256(bytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// The digest of a set of values, regardless of their order: the digest of their sorted digests
+func digestSet[T any](values []T) (string, error) {
+	digests := make([]string, 0, len(values))
+	for _, value := range values {
+		digest, err := Digest(value)
+		if err != nil {
+			return "", err
+		}
+		digests = append(digests, digest)
+	}
+	return DigestSorted(digests)
+}
+
+// The digest of a set of digests, regardless of their order
+func DigestSorted(digests []string) (string, error) {
+	sorted := append([]string{}, digests...)
+	sort.Strings(sorted)
+	return Digest(sorted)
+}
+
+// Accumulates the digest of a set of values one at a time, regardless of their order, in a fixed amount of memory:
+// the digest of each value is added, as a 256 bit number modulo 2^256, into a running sum alongside a count, so a
+// set of any size can be digested without holding on to every value's digest to sort at the end
+type SetDigest struct {
+	count uint64
+	sum   [sha256.Size]byte
+}
+
+// Add a value to the set
+func (d *SetDigest) Add(value any) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	hash := sha256.Sum256(bytes)
+	carry := uint16(0)
+	for i := len(d.sum) - 1; i >= 0; i-- {
+		total := uint16(d.sum[i]) + uint16(hash[i]) + carry
+		d.sum[i] = byte(total)
+		carry = total >> 8
+	}
+	d.count += 1
+	return nil
+}
+
+// The digest of every value added so far
+func (d *SetDigest) Digest() (string, error) {
+	return Digest(struct {
+		Count uint64
+		Sum   string
+	}{Count: d.count, Sum: hex.EncodeToString(d.sum[:])})
+}
+
+// The digest of a set of positions, regardless of the order they were fetched in
+func DigestPositions(positions []Position) (string, error) {
+	var digest SetDigest
+	for _, position := range positions {
+		if err := digest.Add(position); err != nil {
+			return "", err
+		}
+	}
+	return digest.Digest()
+}
+
+// The digest of a pool snapshot, regardless of the order the pools were looked up in
+func DigestPools(pools []Pool) (string, error) {
+	return digestSet(pools)
+}
+
+// Digests of everything a calculation read, embedded in its outputs, so that the outputs can be matched
+// to the exact inputs that produced them, and a rerun over different inputs is caught
+type InputDigests struct {
+	Program   string
+	Positions string
+	// The pools the calculation actually looked up; see PoolRecorder
+	Pools string
+	// The outputs of earlier days the calculation depended on, if any
+	PreviousResults string `json:",omitempty"`
+}
+
+// The names of the inputs that differ between the two, in a consistent order
+func (d InputDigests) Diff(other InputDigests) []string {
+	var diff []string
+	if d.Program != other.Program {
+		diff = append(diff, "program")
+	}
+	if d.Positions != other.Positions {
+		diff = append(diff, "positions")
+	}
+	if d.Pools != other.Pools {
+		diff = append(diff, "pools")
+	}
+	if d.PreviousResults != other.PreviousResults {
+		diff = append(diff, "previous results")
+	}
+	return diff
+}
+
+// Check that two calculations were over the same inputs, and say which ones changed if not
+func (d InputDigests) Verify(other InputDigests) error {
+	if diff := d.Diff(other); len(diff) > 0 {
+		return fmt.Errorf("calculated from different %v", strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+// A PoolLookup that remembers every pool it returns, so that the pool snapshot a calculation actually used can be digested
+type PoolRecorder struct {
+	PoolLookup PoolLookup
+
+	mu    sync.Mutex
+	pools map[Pool]bool
+}
+
+func NewPoolRecorder(poolLookup PoolLookup) *PoolRecorder {
+	return &PoolRecorder{PoolLookup: poolLookup}
+}
+
+func (r *PoolRecorder) record(pools ...Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pools == nil {
+		r.pools = map[Pool]bool{}
+	}
+	for _, pool := range pools {
+		r.pools[pool] = true
+	}
+}
+
+func (r *PoolRecorder) PoolByIdent(ctx context.Context, poolIdent string) (Pool, error) {
+	pool, err := r.PoolLookup.PoolByIdent(ctx, poolIdent)
+	if err != nil {
+		return Pool{}, err
+	}
+	r.record(pool)
+	return pool, nil
+}
+
+func (r *PoolRecorder) PoolByLPToken(ctx context.Context, lpToken shared.AssetID) (Pool, error) {
+	pool, err := r.PoolLookup.PoolByLPToken(ctx, lpToken)
+	if err != nil {
+		return Pool{}, err
+	}
+	r.record(pool)
+	return pool, nil
+}
+
+func (r *PoolRecorder) IsLPToken(assetId shared.AssetID) bool {
+	return r.PoolLookup.IsLPToken(assetId)
+}
+
+func (r *PoolRecorder) LPTokenToPoolIdent(lpToken shared.AssetID) (string, error) {
+	return r.PoolLookup.LPTokenToPoolIdent(lpToken)
+}
+
+func (r *PoolRecorder) AllPools(ctx context.Context) ([]Pool, error) {
+	snapshot, ok := r.PoolLookup.(PoolSnapshot)
+	if !ok {
+		return nil, fmt.Errorf("recording a %T: %w", r.PoolLookup, ErrSnapshotUnsupported)
+	}
+	pools, err := snapshot.AllPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.record(pools...)
+	return pools, nil
+}
+
+// Every distinct pool returned so far, ordered by ident
+func (r *PoolRecorder) Pools() []Pool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pools := make([]Pool, 0, len(r.pools))
+	for pool := range r.pools {
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		if pools[i].PoolIdent != pools[j].PoolIdent {
+			return pools[i].PoolIdent < pools[j].PoolIdent
+		}
+		return pools[i].Slot < pools[j].Slot
+	})
+	return pools
+}
+
+func (r *PoolRecorder) Digest() (string, error) {
+	return DigestPools(r.Pools())
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/tj/assert"
+)
+
+type testLookup map[string]Pool
+
+func (l testLookup) PoolByIdent(ctx context.Context, poolIdent string) (Pool, error) {
+	pool, ok := l[poolIdent]
+	if !ok {
+		return Pool{}, fmt.Errorf("pool %v not found", poolIdent)
+	}
+	return pool, nil
+}
+
+func (l testLookup) PoolByLPToken(ctx context.Context, lpToken shared.AssetID) (Pool, error) {
+	for _, pool := range l {
+		if pool.LPAsset == lpToken {
+			return pool, nil
+		}
+	}
+	return Pool{}, fmt.Errorf("no pool for %v", lpToken)
+}
+
+func (l testLookup) IsLPToken(assetId shared.AssetID) bool {
+	_, err := l.PoolByLPToken(context.Background(), assetId)
+	return err == nil
+}
+
+func (l testLookup) LPTokenToPoolIdent(lpToken shared.AssetID) (string, error) {
+	pool, err := l.PoolByLPToken(context.Background(), lpToken)
+	return pool.PoolIdent, err
+}
+
+func Test_Digest(t *testing.T) {
+	a, err := Digest(map[string]uint64{"A": 1, "B": 2})
+	assert.Nil(t, err)
+	b, err := Digest(map[string]uint64{"B": 2, "A": 1})
+	assert.Nil(t, err)
+	assert.EqualValues(t, a, b)
+	assert.Len(t, a, 64)
+
+	c, err := Digest(map[string]uint64{"A": 1, "B": 3})
+	assert.Nil(t, err)
+	assert.NotEqual(t, a, c)
+}
+
+func Test_DigestPositions(t *testing.T) {
+	positions := []Position{{OwnerID: "A", Slot: 1}, {OwnerID: "B", Slot: 2}, {OwnerID: "C", Slot: 3}}
+	digest, err := DigestPositions(positions)
+	assert.Nil(t, err)
+
+	// The order positions are fetched in doesn't matter
+	reordered, err := DigestPositions([]Position{positions[2], positions[0], positions[1]})
+	assert.Nil(t, err)
+	assert.EqualValues(t, digest, reordered)
+
+	// But their contents do, as does how many there are
+	changed, err := DigestPositions([]Position{positions[0], positions[1], {OwnerID: "C", Slot: 4}})
+	assert.Nil(t, err)
+	assert.NotEqual(t, digest, changed)
+	duplicated, err := DigestPositions(append(positions, positions[0]))
+	assert.Nil(t, err)
+	assert.NotEqual(t, digest, duplicated)
+
+	// Streaming the positions gives the same digest
+	source := NewDigestingPositionSource(NewSlicePositionSource(positions))
+	assert.Nil(t, ForEachPosition(context.Background(), source, func(position Position) error { return nil }))
+	streamed, err := source.Digest()
+	assert.Nil(t, err)
+	assert.EqualValues(t, digest, streamed)
+}
+
+func Test_InputDigests(t *testing.T) {
+	inputs := InputDigests{Program: "p", Positions: "a", Pools: "b", PreviousResults: "c"}
+	assert.Nil(t, inputs.Verify(inputs))
+	assert.Empty(t, inputs.Diff(inputs))
+
+	other := inputs
+	other.Positions = "x"
+	other.PreviousResults = "y"
+	assert.EqualValues(t, []string{"positions", "previous results"}, inputs.Diff(other))
+	assert.EqualError(t, inputs.Verify(other), "calculated from different positions, previous results")
+}
+
+func Test_PoolRecorder(t *testing.T) {
+	ctx := context.Background()
+	lookup := testLookup{
+		"01": {PoolIdent: "01", LPAsset: "LP_01", TotalLPTokens: 100},
+		"02": {PoolIdent: "02", LPAsset: "LP_02", TotalLPTokens: 200},
+		"03": {PoolIdent: "03", LPAsset: "LP_03", TotalLPTokens: 300},
+	}
+	recorder := NewPoolRecorder(lookup)
+	_, err := recorder.PoolByLPToken(ctx, "LP_02")
+	assert.Nil(t, err)
+	_, err = recorder.PoolByIdent(ctx, "01")
+	assert.Nil(t, err)
+	_, err = recorder.PoolByIdent(ctx, "02")
+	assert.Nil(t, err)
+	_, err = recorder.PoolByIdent(ctx, "04")
+	assert.NotNil(t, err)
+
+	// Only the pools that were used are part of the snapshot
+	assert.EqualValues(t, []Pool{lookup["01"], lookup["02"]}, recorder.Pools())
+	digest, err := recorder.Digest()
+	assert.Nil(t, err)
+	expected, err := DigestPools([]Pool{lookup["02"], lookup["01"]})
+	assert.Nil(t, err)
+	assert.EqualValues(t, expected, digest)
+
+	// The underlying lookup can't list every pool, so neither can the recorder
+	_, err = recorder.AllPools(ctx)
+	assert.True(t, errors.Is(err, ErrSnapshotUnsupported))
+}
@@ -0,0 +1,216 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Leaves and interior nodes are hashed with different prefixes, so a leaf can never be passed off as a node
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// Maps with bytes for keys are encoded canonically, so the same earning always has the same leaf
+var canonical = func() cbor.EncMode {
+	mode, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		panic(fmt.Sprintf("failed to create CBOR encoder: %v", err))
+	}
+	return mode
+}()
+
+// Encode an earning as a merkle leaf, in the same style as the on-chain datums: constructor 0, as an indefinite length array of
+//
+//	program:     bytes
+//	owner ID:    bytes
+//	owner:       MultisigScript
+//	earned date: bytes
+//	value:       a map from policy to a map from asset name to amount, as bytes, the same way a value is found on-chain, in
+//	             canonical key order, leaving out zero amounts; ada has an empty policy and asset name
+func (e Earning) MerkleLeaf() ([]byte, error) {
+	amounts := map[cbor.ByteString]map[cbor.ByteString]*big.Int{}
+	for policy, policyMap := range e.Value {
+		for assetName, amount := range policyMap {
+			if amount.BigInt().Sign() == 0 {
+				continue
+			}
+			var policyBytes, assetNameBytes []byte
+			if policy != shared.AdaPolicy {
+				var err error
+				if policyBytes, err = hex.DecodeString(policy); err != nil {
+					return nil, fmt.Errorf("invalid policy %v earned by %v: %w", policy, e.OwnerID, err)
+				}
+				if assetNameBytes, err = hex.DecodeString(assetName); err != nil {
+					return nil, fmt.Errorf("invalid asset name %v earned by %v: %w", assetName, e.OwnerID, err)
+				}
+			}
+			if _, ok := amounts[cbor.ByteString(policyBytes)]; !ok {
+				amounts[cbor.ByteString(policyBytes)] = map[cbor.ByteString]*big.Int{}
+			}
+			amounts[cbor.ByteString(policyBytes)][cbor.ByteString(assetNameBytes)] = amount.BigInt()
+		}
+	}
+
+	var fields [][]byte
+	for _, field := range []any{[]byte(e.Program), []byte(e.OwnerID), &e.Owner, []byte(e.EarnedDate)} {
+		encoded, err := cbor.Marshal(field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode earning of %v: %w", e.OwnerID, err)
+		}
+		fields = append(fields, encoded)
+	}
+	value, err := canonical.Marshal(amounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value earned by %v: %w", e.OwnerID, err)
+	}
+	fields = append(fields, value)
+
+	var leaf []byte
+	leaf = append(leaf, 0x9f) // indefinite length array for the struct
+	for _, field := range fields {
+		leaf = append(leaf, field...)
+	}
+	leaf = append(leaf, 0xff) // end indefinite length array for the struct
+	return cbor.Marshal(cbor.RawTag{Number: 1 + tagBase, Content: leaf})
+}
+
+func merkleHash(prefix byte, parts ...[]byte) []byte {
+	b2, err := blake2b.New256(nil)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create hash: %v", err))
+	}
+	b2.Write([]byte{prefix})
+	for _, part := range parts {
+		b2.Write(part)
+	}
+	return b2.Sum(nil)
+}
+
+// One step up a merkle proof; the sibling to hash with, and which side it's on
+type MerkleProofStep struct {
+	Sibling string `json:"sibling"`
+	Left    bool   `json:"left"`
+}
+
+// Proof that a single earning is included under a merkle root
+type MerkleProof struct {
+	Program string            `json:"program"`
+	OwnerID string            `json:"ownerId"`
+	Steps   []MerkleProofStep `json:"steps"`
+}
+
+// A merkle tree over a days earnings, with one leaf per program and owner, ordered by program and then owner ID;
+// a level with an odd number of nodes carries the last one up unchanged
+type EarningsTree struct {
+	earnings []Earning
+	// Each level of the tree, from the leaves up to the root
+	levels [][][]byte
+}
+
+func NewEarningsTree(earnings []Earning) (*EarningsTree, error) {
+	sorted := append([]Earning{}, earnings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Program != sorted[j].Program {
+			return sorted[i].Program < sorted[j].Program
+		}
+		return sorted[i].OwnerID < sorted[j].OwnerID
+	})
+	var leaves [][]byte
+	for i, earning := range sorted {
+		if i > 0 && earning.Program == sorted[i-1].Program && earning.OwnerID == sorted[i-1].OwnerID {
+			return nil, fmt.Errorf("more than one earning for %v in program %v", earning.OwnerID, earning.Program)
+		}
+		leaf, err := earning.MerkleLeaf()
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, merkleHash(merkleLeafPrefix, leaf))
+	}
+
+	tree := &EarningsTree{earnings: sorted, levels: [][][]byte{leaves}}
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, merkleHash(merkleNodePrefix, level[i], level[i+1]))
+			}
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return tree, nil
+}
+
+// The hex encoded root of the tree, or empty if there are no earnings
+func (t *EarningsTree) Root() string {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(top[0])
+}
+
+// Prove that the owners earning from the program is in the tree
+func (t *EarningsTree) Proof(program string, ownerID string) (MerkleProof, error) {
+	index := sort.Search(len(t.earnings), func(i int) bool {
+		if t.earnings[i].Program != program {
+			return t.earnings[i].Program >= program
+		}
+		return t.earnings[i].OwnerID >= ownerID
+	})
+	if index == len(t.earnings) || t.earnings[index].Program != program || t.earnings[index].OwnerID != ownerID {
+		return MerkleProof{}, fmt.Errorf("no earning for %v in program %v", ownerID, program)
+	}
+
+	proof := MerkleProof{Program: program, OwnerID: ownerID, Steps: []MerkleProofStep{}}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		// The last node of an odd level has no sibling, and is carried up as is
+		if sibling < len(level) {
+			proof.Steps = append(proof.Steps, MerkleProofStep{Sibling: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Check that the earning is included under the root
+func VerifyEarningProof(root string, earning Earning, proof MerkleProof) error {
+	if earning.Program != proof.Program || earning.OwnerID != proof.OwnerID {
+		return fmt.Errorf("proof is for %v in program %v, not %v in program %v", proof.OwnerID, proof.Program, earning.OwnerID, earning.Program)
+	}
+	expected, err := hex.DecodeString(root)
+	if err != nil {
+		return fmt.Errorf("invalid merkle root %v: %w", root, err)
+	}
+	leaf, err := earning.MerkleLeaf()
+	if err != nil {
+		return err
+	}
+	hash := merkleHash(merkleLeafPrefix, leaf)
+	for i, step := range proof.Steps {
+		sibling, err := hex.DecodeString(step.Sibling)
+		if err != nil {
+			return fmt.Errorf("invalid sibling in step %v of the proof: %w", i, err)
+		}
+		if step.Left {
+			hash = merkleHash(merkleNodePrefix, sibling, hash)
+		} else {
+			hash = merkleHash(merkleNodePrefix, hash, sibling)
+		}
+	}
+	if !bytes.Equal(hash, expected) {
+		return fmt.Errorf("earning of %v in program %v is not included under root %v", earning.OwnerID, earning.Program, root)
+	}
+	return nil
+}
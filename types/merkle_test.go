@@ -0,0 +1,98 @@
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/tj/assert"
+)
+
+func sampleEarning(program string, ownerID string, amount uint64) Earning {
+	return Earning{
+		OwnerID:    ownerID,
+		Owner:      MultisigScript{Signature: &Signature{KeyHash: []byte(ownerID)}},
+		Program:    program,
+		EarnedDate: "2024-01-01",
+		Value:      compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "99b071ce8580d6a3a11b4902145adb8bfd0d2a03935af8cf66403e15.53554e444145", Amount: num.Uint64(amount)})),
+	}
+}
+
+func Test_MerkleLeaf(t *testing.T) {
+	leaf, err := sampleEarning("P", "A", 100).MerkleLeaf()
+	assert.Nil(t, err)
+	// Constructor 0, with the fields in an indefinite length array, and the value as a map from policy to asset name to amount
+	assert.EqualValues(t, "d8799f41504141d8799f4141ff4a323032342d30312d3031a1581c99b071ce8580d6a3a11b4902145adb8bfd0d2a03935af8cf66403e15a14653554e4441451864ff", hex.EncodeToString(leaf))
+
+	// Zero amounts, such as an empty ada entry, don't change the leaf
+	earning := sampleEarning("P", "A", 100)
+	value := shared.Value(earning.Value)
+	value.AddAsset(shared.Coin{AssetId: shared.AdaAssetID, Amount: num.Uint64(0)})
+	earning.Value = compatibility.CompatibleValue(value)
+	withZero, err := earning.MerkleLeaf()
+	assert.Nil(t, err)
+	assert.EqualValues(t, leaf, withZero)
+
+	// Ada has an empty policy and asset name, as on-chain
+	earning.Value = compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: shared.AdaAssetID, Amount: num.Uint64(100)}))
+	lovelace, err := earning.MerkleLeaf()
+	assert.Nil(t, err)
+	assert.Contains(t, hex.EncodeToString(lovelace), "a140a1401864ff")
+
+	// And anything that isn't a real policy and asset name can't be committed to
+	earning.Value = compatibility.CompatibleValue(shared.ValueFromCoins(shared.Coin{AssetId: "Emitted", Amount: num.Uint64(100)}))
+	_, err = earning.MerkleLeaf()
+	assert.NotNil(t, err)
+}
+
+func Test_EarningsTree(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 5, 8, 13} {
+		var earnings []Earning
+		for i := 0; i < count; i++ {
+			earnings = append(earnings, sampleEarning("P", fmt.Sprintf("Owner%02d", count-i), uint64(i+1)))
+		}
+		earnings = append(earnings, sampleEarning("Q", "Owner01", 7))
+		tree, err := NewEarningsTree(earnings)
+		assert.Nil(t, err)
+		root := tree.Root()
+		assert.Len(t, root, 64)
+
+		for _, earning := range earnings {
+			proof, err := tree.Proof(earning.Program, earning.OwnerID)
+			assert.Nil(t, err)
+			assert.Nil(t, VerifyEarningProof(root, earning, proof), "%v earnings", count)
+
+			// A different amount isn't included
+			tampered := earning
+			tampered.Value = sampleEarning(earning.Program, earning.OwnerID, 1_000_000).Value
+			assert.NotNil(t, VerifyEarningProof(root, tampered, proof))
+		}
+
+		// The order the earnings come in doesn't matter
+		reversed := make([]Earning, len(earnings))
+		for i := range earnings {
+			reversed[len(earnings)-1-i] = earnings[i]
+		}
+		other, err := NewEarningsTree(reversed)
+		assert.Nil(t, err)
+		assert.EqualValues(t, root, other.Root())
+	}
+
+	tree, err := NewEarningsTree([]Earning{sampleEarning("P", "A", 1), sampleEarning("P", "B", 2)})
+	assert.Nil(t, err)
+	_, err = tree.Proof("P", "C")
+	assert.NotNil(t, err)
+	proof, err := tree.Proof("P", "A")
+	assert.Nil(t, err)
+	assert.NotNil(t, VerifyEarningProof(tree.Root(), sampleEarning("P", "B", 2), proof))
+
+	_, err = NewEarningsTree([]Earning{sampleEarning("P", "A", 1), sampleEarning("P", "A", 2)})
+	assert.NotNil(t, err)
+
+	empty, err := NewEarningsTree(nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "", empty.Root())
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A sequence of positions that is read once, in order, so that they don't all have to be held in memory at once
+type PositionSource interface {
+	// Returns the next position, or false once there are none left
+	Next(ctx context.Context) (Position, bool, error)
+}
+
+// A PositionSource over positions that are already in memory
+type SlicePositionSource struct {
+	Positions []Position
+	next      int
+}
+
+func NewSlicePositionSource(positions []Position) *SlicePositionSource {
+	return &SlicePositionSource{Positions: positions}
+}
+
+func (s *SlicePositionSource) Next(ctx context.Context) (Position, bool, error) {
+	if s.next >= len(s.Positions) {
+		return Position{}, false, nil
+	}
+	position := s.Positions[s.next]
+	s.next += 1
+	return position, true, nil
+}
+
+// A PositionSource that digests each position as it's read, so a stream of positions can be digested in the same pass
+// that calculates from it; the digest is the same as DigestPositions over the same positions
+type DigestingPositionSource struct {
+	Source PositionSource
+	digest SetDigest
+}
+
+func NewDigestingPositionSource(source PositionSource) *DigestingPositionSource {
+	return &DigestingPositionSource{Source: source}
+}
+
+func (s *DigestingPositionSource) Next(ctx context.Context) (Position, bool, error) {
+	position, ok, err := s.Source.Next(ctx)
+	if err != nil || !ok {
+		return position, ok, err
+	}
+	if err := s.digest.Add(position); err != nil {
+		return Position{}, false, err
+	}
+	return position, true, nil
+}
+
+// The digest of every position read so far
+func (s *DigestingPositionSource) Digest() (string, error) {
+	return s.digest.Digest()
+}
+
+// A PositionSource that decodes a stream of JSON positions, such as a file with one position per line
+type JSONPositionSource struct {
+	decoder *json.Decoder
+	read    int
+}
+
+func NewJSONPositionSource(r io.Reader) *JSONPositionSource {
+	return &JSONPositionSource{decoder: json.NewDecoder(r)}
+}
+
+func (s *JSONPositionSource) Next(ctx context.Context) (Position, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Position{}, false, err
+	}
+	var position Position
+	if err := s.decoder.Decode(&position); errors.Is(err, io.EOF) {
+		return Position{}, false, nil
+	} else if err != nil {
+		return Position{}, false, fmt.Errorf("failed to decode position %v: %w", s.read, err)
+	}
+	s.read += 1
+	return position, true, nil
+}
+
+// Call fn with each position from the source, in order, stopping at the first error
+func ForEachPosition(ctx context.Context, source PositionSource, fn func(position Position) error) error {
+	for {
+		position, ok, err := source.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if err := fn(position); err != nil {
+			return err
+		}
+	}
+}
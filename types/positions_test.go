@@ -0,0 +1,58 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func Test_SlicePositionSource(t *testing.T) {
+	source := NewSlicePositionSource([]Position{{OwnerID: "A"}, {OwnerID: "B"}})
+	var owners []string
+	err := ForEachPosition(context.Background(), source, func(position Position) error {
+		owners = append(owners, position.OwnerID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"A", "B"}, owners)
+
+	_, ok, err := source.Next(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func Test_JSONPositionSource(t *testing.T) {
+	file := `{"OwnerID":"A","Slot":1,"Delegation":[{"Program":"P","PoolIdent":"01","Weight":1}]}
+{"OwnerID":"B","Slot":2}
+`
+	var positions []Position
+	err := ForEachPosition(context.Background(), NewJSONPositionSource(strings.NewReader(file)), func(position Position) error {
+		positions = append(positions, position)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, positions, 2)
+	assert.EqualValues(t, "A", positions[0].OwnerID)
+	assert.EqualValues(t, []Delegation{{Program: "P", PoolIdent: "01", Weight: 1}}, positions[0].Delegation)
+	assert.EqualValues(t, 2, positions[1].Slot)
+
+	// Malformed input is reported, along with which position it was
+	err = ForEachPosition(context.Background(), NewJSONPositionSource(strings.NewReader(`{"OwnerID":"A"} {"OwnerID":`)), func(position Position) error {
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "position 1")
+
+	// Errors from the callback stop the iteration
+	stop := errors.New("stop")
+	count := 0
+	err = ForEachPosition(context.Background(), NewJSONPositionSource(strings.NewReader(file)), func(position Position) error {
+		count += 1
+		return stop
+	})
+	assert.True(t, errors.Is(err, stop))
+	assert.EqualValues(t, 1, count)
+}
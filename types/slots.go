@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// How slots map to wall-clock time on a network, from a known slot onwards (the start of the Shelley era, after which every slot is one second)
+type SlotConfig struct {
+	ZeroTime   time.Time
+	ZeroSlot   uint64
+	SlotLength time.Duration
+}
+
+var (
+	MainnetSlotConfig = SlotConfig{ZeroTime: time.Unix(1596059091, 0).UTC(), ZeroSlot: 4492800, SlotLength: time.Second}
+	PreprodSlotConfig = SlotConfig{ZeroTime: time.Unix(1655769600, 0).UTC(), ZeroSlot: 86400, SlotLength: time.Second}
+	PreviewSlotConfig = SlotConfig{ZeroTime: time.Unix(1666656000, 0).UTC(), ZeroSlot: 0, SlotLength: time.Second}
+)
+
+// Check that the config can map times to slots at all; the zero value, for one, can't
+func (c SlotConfig) Validate() error {
+	if c.SlotLength <= 0 {
+		return fmt.Errorf("invalid slot config: slot length %v isn't positive", c.SlotLength)
+	}
+	return nil
+}
+
+// The first slot at or after the given time
+func (c SlotConfig) SlotAt(t time.Time) (uint64, error) {
+	if err := c.Validate(); err != nil {
+		return 0, err
+	}
+	if t.Before(c.ZeroTime) {
+		return 0, fmt.Errorf("%v is before the slot config starts at %v", t, c.ZeroTime)
+	}
+	elapsed := t.Sub(c.ZeroTime)
+	slots := uint64(elapsed / c.SlotLength)
+	if elapsed%c.SlotLength != 0 {
+		slots += 1
+	}
+	return c.ZeroSlot + slots, nil
+}
+
+func (c SlotConfig) TimeOf(slot uint64) time.Time {
+	if slot < c.ZeroSlot {
+		return c.ZeroTime
+	}
+	return c.ZeroTime.Add(time.Duration(slot-c.ZeroSlot) * c.SlotLength)
+}
+
+// The slots covering a (UTC) day, from the first slot of the day, up to the first slot of the next day
+func (c SlotConfig) DaySlots(date Date) (uint64, uint64, error) {
+	day, err := time.Parse(DateFormat, date)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid date %v: %w", date, err)
+	}
+	startSlot, err := c.SlotAt(day)
+	if err != nil {
+		return 0, 0, err
+	}
+	endSlot, err := c.SlotAt(day.AddDate(0, 0, 1))
+	if err != nil {
+		return 0, 0, err
+	}
+	return startSlot, endSlot, nil
+}
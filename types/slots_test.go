@@ -0,0 +1,38 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func Test_SlotConfig(t *testing.T) {
+	// Mainnet slots are a fixed offset from unix time since Shelley
+	slot, err := MainnetSlotConfig.SlotAt(time.Unix(1700000000, 0))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1700000000-1591566291, slot)
+	assert.EqualValues(t, 1700000000, MainnetSlotConfig.TimeOf(slot).Unix())
+
+	start, end, err := MainnetSlotConfig.DaySlots("2024-01-01")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1704067200-1591566291, start)
+	assert.EqualValues(t, 86400, end-start)
+
+	// Partial slots round up, so a time is never counted in the slot before it
+	config := SlotConfig{ZeroTime: time.Unix(0, 0), SlotLength: 2 * time.Second}
+	slot, err = config.SlotAt(time.Unix(3, 0))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, slot)
+
+	_, err = MainnetSlotConfig.SlotAt(time.Unix(0, 0))
+	assert.NotNil(t, err)
+	_, _, err = MainnetSlotConfig.DaySlots("yesterday")
+	assert.NotNil(t, err)
+
+	// A config without a slot length can't map anything
+	_, err = SlotConfig{}.SlotAt(time.Unix(0, 0))
+	assert.NotNil(t, err)
+	_, _, err = SlotConfig{}.DaySlots("2024-01-01")
+	assert.NotNil(t, err)
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/compatibility"
@@ -37,9 +38,13 @@ type YieldProgram struct {
 	// The maximum emissions, outside of the fixed emissions above,
 	// that any pool may receive for its delegation
 	// For example, this is set to 62176.1, as 14% of 444115
-	// Any remaining emissions above this are *not* emitted, and instead rever to the treasury
+	// Any remaining emissions above this are *not* emitted, and instead rever to the treasury,
+	// unless the CapOverflowPolicy says otherwise
 	EmissionCap uint64
 
+	// What to do with any emissions above the EmissionCap; defaults to returning them to the treasury
+	CapOverflowPolicy CapOverflowPolicy
+
 	// A list of eligible protocol versions
 	EligibleVersions []string
 
@@ -76,8 +81,62 @@ type YieldProgram struct {
 	MinLPIntegerPercent   int
 	MaxPoolCount          int
 	MaxPoolIntegerPercent int
+
+	// Which strategy to use when choosing the pools that receive emissions; defaults to the top N pools or top P%, whichever is fewer
+	PoolSelectionStrategy PoolSelectionStrategy
+	// For the MinimumDelegation strategy, the delegation (summed over the window) a pool needs to receive emissions
+	MinPoolDelegation uint64
+	// For the MinimumLockedLovelace strategy, the estimated lovelace value of LP a pool needs locked to receive emissions
+	MinPoolLockedLovelace uint64
+	// For the RankedDecay strategy, each pool's weight is reduced by this percent compared to the pool ranked above it
+	RankDecayIntegerPercent int
+
+	// How the emissions are split among the selected pools; defaults to in proportion to their delegation
+	EmissionWeighting EmissionWeightingCurve
+	// For the Blend curve, the percent of each pool's weight that comes from its share of delegation;
+	// the rest comes from its share of the estimated lovelace value locked
+	BlendDelegationIntegerPercent int
 }
 
+type PoolSelectionStrategy string
+
+const (
+	// Select the top MaxPoolCount pools, or the top pools covering MaxPoolIntegerPercent of delegation, whichever is fewer
+	PoolSelectionTopPools PoolSelectionStrategy = "TopPools"
+	// Select every pool with at least MinPoolDelegation delegated to it
+	PoolSelectionMinimumDelegation PoolSelectionStrategy = "MinimumDelegation"
+	// Select every pool with at least MinPoolLockedLovelace worth of LP locked
+	PoolSelectionMinimumLockedLovelace PoolSelectionStrategy = "MinimumLockedLovelace"
+	// Select the top MaxPoolCount pools (or all, if 0), discounting each pool's weight by RankDecayIntegerPercent per rank
+	PoolSelectionRankedDecay PoolSelectionStrategy = "RankedDecay"
+	// Select every qualifying pool
+	PoolSelectionAll PoolSelectionStrategy = "All"
+)
+
+type CapOverflowPolicy string
+
+const (
+	// Emissions above the cap revert to the treasury
+	CapOverflowTreasury CapOverflowPolicy = "Treasury"
+	// Emissions above the cap are split among the remaining uncapped pools, in proportion to their emission weight
+	// (their delegation, after the EmissionWeighting curve), until no pool is above the cap; only if every pool is
+	// capped does the rest revert to the treasury
+	CapOverflowRedistribute CapOverflowPolicy = "Redistribute"
+)
+
+type EmissionWeightingCurve string
+
+const (
+	// Split emissions in proportion to each pool's delegation
+	EmissionWeightingLinear EmissionWeightingCurve = "Linear"
+	// Split emissions in proportion to the square root of each pool's delegation, favoring smaller pools
+	EmissionWeightingSquareRoot EmissionWeightingCurve = "SquareRoot"
+	// Split emissions in proportion to the estimated lovelace value of the LP locked for each pool
+	EmissionWeightingLockedLovelace EmissionWeightingCurve = "LockedLovelace"
+	// Split emissions in proportion to a blend of each pool's share of delegation and share of locked value
+	EmissionWeightingBlend EmissionWeightingCurve = "Blend"
+)
+
 type IncentiveProgram struct {
 	ID                   string
 	FirstDailyRewards    Date
@@ -135,3 +194,23 @@ type PoolLookup interface {
 	IsLPToken(assetId shared.AssetID) bool
 	LPTokenToPoolIdent(lpToken shared.AssetID) (string, error)
 }
+
+// Optionally implemented by a PoolLookup that can list every pool as of the snapshot,
+// so that assets without a pool directly against ADA can be priced through intermediate pools
+type PoolSnapshot interface {
+	AllPools(ctx context.Context) ([]Pool, error)
+}
+
+// Returned (wrapped) by AllPools when a decorator's underlying lookup can't actually list every pool
+var ErrSnapshotUnsupported = errors.New("pool lookup can't list every pool")
+
+// Optionally implemented by a PoolLookup that can fetch many pools in a single round trip
+type BatchPoolLookup interface {
+	PoolsByLPTokens(ctx context.Context, lpTokens []shared.AssetID) (map[shared.AssetID]Pool, error)
+}
+
+// A record of how each pool changed over time, for estimating prices that are harder to manipulate than the spot price
+type PoolHistory interface {
+	// The state of the pool as of startSlot, followed by each later state up to endSlot, ordered by slot
+	PoolStates(ctx context.Context, poolIdent string, startSlot, endSlot uint64) ([]Pool, error)
+}
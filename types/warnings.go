@@ -0,0 +1,89 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Identifies a kind of warning, so that a new kind can be alerted on
+type WarningCode string
+
+const (
+	// We couldn't estimate the lovelace value of a pool's LP, so it counts as worthless
+	WarningMissingPrice WarningCode = "MissingPrice"
+	// A position held LP for a pool that has since been deleted, so the LP was skipped
+	WarningDeletedPoolLP WarningCode = "DeletedPoolLP"
+	// An owner was skipped when handing out the rounding dust, since they earned nothing to add it to
+	WarningOwnerSkippedForDust WarningCode = "OwnerSkippedForDust"
+)
+
+// Something unusual the calculation worked around, rather than failing on
+type Warning struct {
+	Code      WarningCode `json:"code"`
+	PoolIdent string      `json:"poolIdent,omitempty"`
+	OwnerID   string      `json:"ownerID,omitempty"`
+	Message   string      `json:"message"`
+}
+
+func (w Warning) String() string {
+	s := fmt.Sprintf("WARNING [%v]", w.Code)
+	if w.PoolIdent != "" {
+		s += fmt.Sprintf(" pool=%v", w.PoolIdent)
+	}
+	if w.OwnerID != "" {
+		s += fmt.Sprintf(" owner=%v", w.OwnerID)
+	}
+	return s + ": " + w.Message
+}
+
+// Observes warnings as the calculation encounters them
+type WarningLogger interface {
+	Warn(warning Warning)
+}
+
+// Adapts a plain function (for example, one that forwards to slog) into a WarningLogger
+type WarningLoggerFunc func(warning Warning)
+
+func (f WarningLoggerFunc) Warn(warning Warning) {
+	f(warning)
+}
+
+// Collects every warning logged to it, forwarding each to Next if set; safe for concurrent use
+type WarningCollector struct {
+	Next WarningLogger
+
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+func (c *WarningCollector) Warn(warning Warning) {
+	c.mu.Lock()
+	c.warnings = append(c.warnings, warning)
+	c.mu.Unlock()
+	if c.Next != nil {
+		c.Next.Warn(warning)
+	}
+}
+
+// The warnings collected so far, in a canonical order
+func (c *WarningCollector) Warnings() []Warning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	warnings := make([]Warning, len(c.warnings))
+	copy(warnings, c.warnings)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		if a.PoolIdent != b.PoolIdent {
+			return a.PoolIdent < b.PoolIdent
+		}
+		if a.OwnerID != b.OwnerID {
+			return a.OwnerID < b.OwnerID
+		}
+		return a.Message < b.Message
+	})
+	return warnings
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func Test_WarningCollector(t *testing.T) {
+	var forwarded []Warning
+	collector := &WarningCollector{Next: WarningLoggerFunc(func(warning Warning) {
+		forwarded = append(forwarded, warning)
+	})}
+	collector.Warn(Warning{Code: WarningOwnerSkippedForDust, OwnerID: "B"})
+	collector.Warn(Warning{Code: WarningMissingPrice, PoolIdent: "02"})
+	collector.Warn(Warning{Code: WarningOwnerSkippedForDust, OwnerID: "A"})
+
+	assert.EqualValues(t, []Warning{
+		{Code: WarningOwnerSkippedForDust, OwnerID: "B"},
+		{Code: WarningMissingPrice, PoolIdent: "02"},
+		{Code: WarningOwnerSkippedForDust, OwnerID: "A"},
+	}, forwarded)
+	assert.EqualValues(t, []Warning{
+		{Code: WarningMissingPrice, PoolIdent: "02"},
+		{Code: WarningOwnerSkippedForDust, OwnerID: "A"},
+		{Code: WarningOwnerSkippedForDust, OwnerID: "B"},
+	}, collector.Warnings())
+	assert.EqualValues(t, "WARNING [MissingPrice] pool=02: no route", Warning{Code: WarningMissingPrice, PoolIdent: "02", Message: "no route"}.String())
+}